@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/ebiiim/eq/filter"
+	"github.com/ebiiim/eq/filter/biquad"
+	"github.com/ebiiim/eq/pipeline"
+	"github.com/ebiiim/eq/streamio/wav"
+)
+
+func main() {
+	if len(os.Args) != 3 {
+		fmt.Fprintln(os.Stderr, "usage: offline in.wav out.wav")
+		os.Exit(2)
+	}
+	r, err := wav.OpenRecorder(os.Args[1])
+	if err != nil {
+		panic(err)
+	}
+	p, err := wav.CreatePlayer(os.Args[2], r.OutputFormat())
+	if err != nil {
+		panic(err)
+	}
+	eq := &biquad.Filter{Format: r.OutputFormat()}
+	_, err = eq.Add(biquad.Band{Type: biquad.Peaking, Freq: 80, Q: 5.0, Gain: +3})
+	if err != nil {
+		panic(err)
+	}
+
+	pl := pipeline.Pipeline{Recorder: r, Filters: []filter.Filter{eq}, Player: p}
+	err = pl.Run(context.Background())
+	if err != nil {
+		panic(err)
+	}
+}
@@ -3,14 +3,16 @@ package main
 import (
 	"bufio"
 	"context"
-	"encoding/binary"
 	"fmt"
 	"os"
 	"strconv"
+	"time"
 
+	"github.com/ebiiim/eq/filter"
+	"github.com/ebiiim/eq/filter/biquad"
 	"github.com/ebiiim/eq/filter/function"
-	"github.com/ebiiim/eq/filter/pipe"
-	"github.com/ebiiim/eq/filter/pipe/sox"
+	"github.com/ebiiim/eq/pcm"
+	"github.com/ebiiim/eq/pipeline"
 	"github.com/ebiiim/eq/streamio"
 	"github.com/ebiiim/eq/streamio/portaudio"
 	term "github.com/nsf/termbox-go"
@@ -20,28 +22,28 @@ type TUI struct {
 	r      streamio.Recorder
 	p      streamio.Player
 	vf     *function.Filter
-	sf     *pipe.Filter
-	volume float64
-	isMute bool
+	ef     *biquad.Filter
+	gain   *function.Gain
+	pl     *pipeline.Pipeline
+	volume float64 // dB
 	// sound processing settings
-	buffer   int
-	channels int
-	bit      int
-	rate     int
+	buffer int
+	format pcm.Format
 }
 
 var tui TUI
 
 func initialize() error {
-	var scanIDLoop = func(s string) int {
+	// scanIDLoop accepts a device ID or (a part of) a device name
+	var scanIDLoop = func(s string, lookup func(string) (int, error)) int {
 		fmt.Print(s)
 		sc := bufio.NewScanner(os.Stdin)
 		for sc.Scan() {
-			s := sc.Text()
-			if s == "" {
-				return -1
+			in := sc.Text()
+			if id, err := strconv.Atoi(in); err == nil {
+				return id
 			}
-			id, err := strconv.Atoi(s)
+			id, err := lookup(in) // returns -1 (default) if empty
 			if err != nil {
 				fmt.Println(err)
 				fmt.Print(s)
@@ -52,10 +54,8 @@ func initialize() error {
 		return 9999 // unreachable
 	}
 
-	tui.buffer = 4096 // buffer size
-	tui.channels = 2  // channels
-	tui.bit = 16      // bit rate
-	tui.rate = 48000  // sampling rate
+	tui.buffer = 4096        // buffer size
+	tui.format = pcm.Default // 2ch, 48000Hz, signed 16-bit little-endian
 
 	ds, err := portaudio.ListDevices()
 	if err != nil {
@@ -64,86 +64,56 @@ func initialize() error {
 	for _, v := range ds {
 		fmt.Println(v)
 	}
-	inID := scanIDLoop("Select an input device > ")
-	outID := scanIDLoop("Select an output device > ")
+	inID := scanIDLoop("Select an input device (ID or name) > ", portaudio.InputDeviceID)
+	outID := scanIDLoop("Select an output device (ID or name) > ", portaudio.OutputDeviceID)
 
-	r, err := portaudio.NewRecorder(inID, tui.buffer, tui.channels, tui.bit, tui.rate, binary.LittleEndian)
+	r, err := portaudio.NewRecorder(inID, tui.buffer, tui.format)
 	if err != nil {
 		return err
 	}
 
-	p, err := portaudio.NewPlayer(outID, tui.buffer, tui.channels, tui.bit, tui.rate, binary.LittleEndian)
+	p, err := portaudio.NewPlayer(outID, tui.buffer, tui.format)
 	if err != nil {
 		return err
 	}
 
 	var volumeFilter function.Filter
-	var soxFilter pipe.Filter
+	var eqFilter biquad.Filter
 
 	tui.r = r
 	tui.p = p
 	tui.vf = &volumeFilter
-	tui.sf = &soxFilter
-	tui.volume = 1
+	tui.ef = &eqFilter
+	tui.volume = 0
 
-	var soxCommand sox.Command
-	soxCommand.BufferSize = tui.buffer / 2
-	soxCommand.Effects = []sox.Effect{sox.NewGain(-3.0), sox.NewEQ(80, 5.0, +3)}
+	tui.ef.Format = tui.format
+	tui.vf.Format = tui.format
+	_, err = tui.ef.Add(biquad.Band{Type: biquad.Peaking, Freq: 80, Q: 5.0, Gain: +3})
+	if err != nil {
+		return err
+	}
 
-	fn, err := function.Volume(tui.volume)
+	tui.gain, err = function.NewGain(tui.format, function.FromDB(tui.volume), 20*time.Millisecond)
 	if err != nil {
 		return err
 	}
-	tui.vf.Func.Set(fn)
-	tui.sf.Cmd = soxCommand.String()
-	return nil
+	tui.gain.SetClipping(function.SoftClip) // never wraps around even if the volume is too high
+	tui.vf.Func.Set(tui.gain.Func())
+	tui.pl = &pipeline.Pipeline{
+		Recorder:   tui.r,
+		Filters:    []filter.Filter{tui.ef, tui.vf},
+		Player:     tui.p,
+		BufferSize: tui.buffer * 2,
+	}
+	return tui.pl.Check()
 }
 
-func play(ctx context.Context) {
-	defer func() {
-		err := tui.p.Close()
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-		}
-	}()
-	defer func() {
-		err := tui.r.Close()
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-		}
-	}()
-	b := make([]byte, tui.buffer*2)
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			_, err := tui.r.Read(b)
-			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
-			}
-			_, err = tui.sf.Write(b)
-			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
-			}
-			_, err = tui.sf.Read(b)
-			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
-			}
-			_, err = tui.vf.Write(b)
-			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
-			}
-			_, err = tui.vf.Read(b)
-			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
-			}
-			_, err = tui.p.Write(b)
-			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
-			}
-		}
+func play(ctx context.Context) error {
+	err := tui.pl.Run(ctx)
+	if err == context.Canceled {
+		return nil
 	}
+	return err
 }
 
 func startTUI() error {
@@ -159,46 +129,34 @@ func startTUI() error {
 				"\n[Esc]   Exit\n\n")
 	}
 
-	var setVolume = func(vol float64) error {
-		fn, err := function.Volume(vol)
-		if err != nil {
-			return err
-		}
-		tui.vf.Func.Set(fn)
-		return nil
+	var setVolume = func(db float64) error {
+		return tui.gain.SetDB(db) // ramps to db
 	}
 
 	var mute = func() {
-		if !tui.isMute {
+		if !tui.gain.IsMuted() {
 			fmt.Println("Mute")
-			tui.isMute = true
-			setVolume(0) // safe
+			tui.gain.Mute()
 		}
 	}
 
 	var unmute = func() {
-		if tui.isMute {
+		if tui.gain.IsMuted() {
 			fmt.Println("Unmute")
-			tui.isMute = false
-			setVolume(tui.volume) // safe
+			tui.gain.Unmute()
 		}
 	}
 
 	var volumeUp = func() {
-		tui.volume += 0.1
+		tui.volume++
 		setVolume(tui.volume) // safe
-		fmt.Printf("Volume Up %.2f\n", tui.volume)
+		fmt.Printf("Volume Up %+.0fdB (clipped %d samples)\n", tui.volume, tui.gain.Clipped())
 	}
 
 	var volumeDown = func() {
-		vol := tui.volume - 0.1
-		err := setVolume(vol)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "err %v", err)
-			return
-		}
-		tui.volume = vol
-		fmt.Printf("Volume Down %.2f\n", tui.volume)
+		tui.volume--
+		setVolume(tui.volume) // safe
+		fmt.Printf("Volume Down %+.0fdB (clipped %d samples)\n", tui.volume, tui.gain.Clipped())
 	}
 
 	err := term.Init()
@@ -226,7 +184,7 @@ keyboardListenerLoop:
 				volumeDown()
 			case term.KeySpace:
 				clearTerm()
-				if tui.isMute {
+				if tui.gain.IsMuted() {
 					unmute()
 				} else {
 					mute()
@@ -243,6 +201,13 @@ keyboardListenerLoop:
 	return nil
 }
 
+func printStats(name string, s interface{}) {
+	if sr, ok := s.(streamio.StatsReporter); ok {
+		st := sr.Stats()
+		fmt.Printf("%s: underruns %d, overruns %d, dropped %d bytes, last error %v\n", name, st.Underruns, st.Overruns, st.DroppedBytes, st.LastError)
+	}
+}
+
 func main() {
 	err := initialize()
 	if err != nil {
@@ -251,9 +216,18 @@ func main() {
 	}
 	bc := context.Background()
 	ctx, cancel := context.WithCancel(bc)
-	defer cancel()
-	go play(ctx)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- play(ctx)
+	}()
 	err = startTUI()
+	cancel()
+	if pErr := <-errCh; pErr != nil {
+		fmt.Fprintln(os.Stderr, pErr)
+	}
+	printStats("Recorder", tui.r)
+	printStats("Player", tui.p)
+	fmt.Printf("Volume: clipped %d samples\n", tui.gain.Clipped())
 	if err != nil {
 		fmt.Fprint(os.Stderr, err)
 		os.Exit(1)
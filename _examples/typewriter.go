@@ -15,6 +15,7 @@ func main() {
 	)
 	// recorder
 	r := alice.Recorder{}
+	defer r.Close()
 	// player
 	f, err := os.Create("out.txt")
 	if err != nil {
@@ -24,6 +25,7 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	defer p.Close()
 
 	buf := make([]byte, bufferSize)
 
@@ -0,0 +1,379 @@
+// Package biquad provides an implementation of filter.Filter
+// that using RBJ-cookbook biquad filters for parametric equalization.
+package biquad
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ebiiim/eq/filter/function"
+	"github.com/ebiiim/eq/pcm"
+	"github.com/pkg/errors"
+)
+
+// Type is a type of biquad filter.
+type Type int
+
+const (
+	Peaking Type = iota
+	LowShelf
+	HighShelf
+	LowPass
+	HighPass
+	BandPass
+	Notch
+	AllPass
+)
+
+func (t Type) String() string {
+	switch t {
+	case Peaking:
+		return "peaking"
+	case LowShelf:
+		return "lowshelf"
+	case HighShelf:
+		return "highshelf"
+	case LowPass:
+		return "lowpass"
+	case HighPass:
+		return "highpass"
+	case BandPass:
+		return "bandpass"
+	case Notch:
+		return "notch"
+	case AllPass:
+		return "allpass"
+	}
+	return fmt.Sprintf("Type(%d)", int(t))
+}
+
+// Band holds parameters of a biquad filter.
+type Band struct {
+	Type Type
+	Freq float64 // center or corner frequency in Hz
+	Q    float64 // quality factor (must be >0)
+	Gain float64 // gain in dB (used by Peaking, LowShelf and HighShelf)
+}
+
+// Filter is a parametric equalizer that processes
+// a signed 16-bit little-endian interleaved PCM stream.
+//
+// Bands can be added and changed while audio is flowing.
+type Filter struct {
+	// Format is the format of the stream (default: pcm.Default).
+	//
+	// Any number of channels and any sample rate are supported,
+	// but samples must be signed 16-bit little-endian.
+	Format pcm.Format
+
+	// Ramp is the time over which Set changes Freq, Q and Gain of a band
+	// (default: 20ms, negative means immediately),
+	// so that changes while playing do not cause zipper noise.
+	Ramp time.Duration
+
+	initOnce sync.Once
+	initErr  error
+	fn       function.Filter
+
+	mu       sync.Mutex
+	sections []*section
+}
+
+func (f *Filter) initialize() {
+	if f.Format.IsZero() {
+		f.Format = pcm.Default
+	}
+	if f.Ramp == 0 {
+		f.Ramp = 20 * time.Millisecond
+	}
+	if f.Ramp < 0 {
+		f.Ramp = 0
+	}
+	s16le := pcm.Format{
+		Channels:   f.Format.Channels,
+		SampleRate: f.Format.SampleRate,
+		BitDepth:   16,
+		Encoding:   pcm.Signed,
+		ByteOrder:  binary.LittleEndian,
+	}
+	f.initErr = f.Format.Validate()
+	if f.initErr == nil && !f.Format.Equal(s16le) {
+		f.initErr = errors.Errorf("unsupported format %v", f.Format)
+	}
+	f.fn.Format = f.Format
+	f.fn.Frames = 8
+	f.fn.Func.Set(f.process)
+}
+
+// Add appends a band and returns its index.
+func (f *Filter) Add(b Band) (int, error) {
+	f.initOnce.Do(f.initialize)
+	if f.initErr != nil {
+		return 0, f.initErr
+	}
+	c, err := newCoefs(b, f.Format.SampleRate)
+	if err != nil {
+		return 0, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sections = append(f.sections, &section{
+		band: b,
+		cur:  b,
+		c:    c,
+		freq: function.NewParam(b.Freq, f.Ramp),
+		q:    function.NewParam(b.Q, f.Ramp),
+		gain: function.NewParam(b.Gain, f.Ramp),
+		z1:   make([]float64, f.Format.Channels),
+		z2:   make([]float64, f.Format.Channels),
+	})
+	return len(f.sections) - 1, nil
+}
+
+// Set replaces the parameters of the i-th band.
+//
+// Freq, Q and Gain ramp to the new values over Ramp
+// (the coefficients are recalculated for each frame while ramping),
+// and the filter state is kept, so that the change does not reset the stream.
+// A change of Type takes effect from the next sample.
+func (f *Filter) Set(i int, b Band) error {
+	f.initOnce.Do(f.initialize)
+	if f.initErr != nil {
+		return f.initErr
+	}
+	c, err := newCoefs(b, f.Format.SampleRate)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if i < 0 || i >= len(f.sections) {
+		return fmt.Errorf("band %d out of range", i)
+	}
+	s := f.sections[i]
+	s.band = b
+	if s.cur.Type != b.Type {
+		s.cur, s.c = b, c
+		s.freq.Reset(b.Freq)
+		s.q.Reset(b.Q)
+		s.gain.Reset(b.Gain)
+		return nil
+	}
+	s.freq.Set(b.Freq)
+	s.q.Set(b.Q)
+	s.gain.Set(b.Gain)
+	return nil
+}
+
+// Bands returns a copy of the current bands.
+func (f *Filter) Bands() []Band {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	bs := make([]Band, len(f.sections))
+	for i, s := range f.sections {
+		bs[i] = s.band
+	}
+	return bs
+}
+
+// Read reads len(b) bytes from
+// the output buffer (contains equalized data) into b.
+//
+// The function blocks until it reads len(b) bytes or more,
+// and returns io.EOF after CloseWrite and all data are read.
+func (f *Filter) Read(b []byte) (n int, err error) {
+	f.initOnce.Do(f.initialize)
+	if f.initErr != nil {
+		return 0, f.initErr
+	}
+	return f.fn.Read(b)
+}
+
+// Write writes len(b) bytes from b to the input buffer
+// that contains pre-processed data.
+func (f *Filter) Write(b []byte) (n int, err error) {
+	f.initOnce.Do(f.initialize)
+	if f.initErr != nil {
+		return 0, f.initErr
+	}
+	return f.fn.Write(b)
+}
+
+// CloseWrite equalizes the data remaining in the input buffer
+// and closes the input, so that Read returns io.EOF after all data are read.
+func (f *Filter) CloseWrite() error {
+	f.initOnce.Do(f.initialize)
+	if f.initErr != nil {
+		return f.initErr
+	}
+	return f.fn.CloseWrite()
+}
+
+// Close closes the Filter object.
+func (f *Filter) Close() error {
+	f.initOnce.Do(f.initialize)
+	return f.fn.Close()
+}
+
+// InputFormat returns f.Format.
+func (f *Filter) InputFormat() pcm.Format {
+	f.initOnce.Do(f.initialize)
+	return f.Format
+}
+
+// OutputFormat returns f.Format.
+func (f *Filter) OutputFormat() pcm.Format {
+	f.initOnce.Do(f.initialize)
+	return f.Format
+}
+
+func (f *Filter) process(b []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.sections) == 0 {
+		return
+	}
+	fs := f.Format.FrameSize()
+	frames := len(b) / fs
+	for _, s := range f.sections {
+		s.fill(frames, f.Format.SampleRate)
+	}
+	for i := 0; i < frames; i++ {
+		for _, s := range f.sections {
+			s.update(i, f.Format.SampleRate)
+		}
+		for ch := 0; ch < f.Format.Channels; ch++ {
+			p := b[i*fs+ch*2:]
+			x := float64(int16(binary.LittleEndian.Uint16(p))) / 32768
+			for _, s := range f.sections {
+				x = s.next(ch, x)
+			}
+			binary.LittleEndian.PutUint16(p, uint16(toInt16(x)))
+		}
+	}
+}
+
+func toInt16(x float64) int16 {
+	v := math.Round(x * 32768)
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(v)
+}
+
+// section is a biquad filter in transposed direct form II
+// with a state per channel.
+type section struct {
+	band   Band // the parameters set by Add or Set
+	cur    Band // the parameters of c (differs from band while ramping)
+	c      coefs
+	z1, z2 []float64
+
+	freq, q, gain    *function.Param
+	freqs, qs, gains []float64 // the values of the params of each frame in a chunk
+}
+
+// fill reads the values of the params of frames frames.
+func (s *section) fill(frames, sampleRate int) {
+	for _, v := range []*[]float64{&s.freqs, &s.qs, &s.gains} {
+		if cap(*v) < frames {
+			*v = make([]float64, frames)
+		}
+		*v = (*v)[:frames]
+	}
+	s.freq.Fill(s.freqs, sampleRate)
+	s.q.Fill(s.qs, sampleRate)
+	s.gain.Fill(s.gains, sampleRate)
+}
+
+// update recalculates the coefficients if the params of the i-th frame differ from cur.
+func (s *section) update(i, sampleRate int) {
+	b := Band{Type: s.cur.Type, Freq: s.freqs[i], Q: s.qs[i], Gain: s.gains[i]}
+	if b == s.cur {
+		return
+	}
+	c, err := newCoefs(b, sampleRate)
+	if err != nil {
+		return // does not happen (the values between valid ones are valid)
+	}
+	s.cur, s.c = b, c
+}
+
+func (s *section) next(ch int, x float64) float64 {
+	y := s.c.b0*x + s.z1[ch]
+	s.z1[ch] = s.c.b1*x - s.c.a1*y + s.z2[ch]
+	s.z2[ch] = s.c.b2*x - s.c.a2*y
+	return y
+}
+
+// coefs holds biquad coefficients normalized by a0.
+type coefs struct {
+	b0, b1, b2, a1, a2 float64
+}
+
+// newCoefs calculates coefficients
+// based on the Audio EQ Cookbook by Robert Bristow-Johnson.
+func newCoefs(b Band, sampleRate int) (coefs, error) {
+	for _, v := range []float64{b.Freq, b.Q, b.Gain} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return coefs{}, errors.Errorf("freq, q and gain must be finite: %+v", b)
+		}
+	}
+	if b.Freq <= 0 || b.Freq >= float64(sampleRate)/2 {
+		return coefs{}, errors.Errorf("freq must be >0 and <%d", sampleRate/2)
+	}
+	if b.Q <= 0 {
+		return coefs{}, errors.New("q must be >0")
+	}
+
+	A := math.Pow(10, b.Gain/40)
+	w0 := 2 * math.Pi * b.Freq / float64(sampleRate)
+	cos, sin := math.Cos(w0), math.Sin(w0)
+	alpha := sin / (2 * b.Q)
+	sqA := 2 * math.Sqrt(A) * alpha
+
+	var b0, b1, b2, a0, a1, a2 float64
+	switch b.Type {
+	case Peaking:
+		b0, b1, b2 = 1+alpha*A, -2*cos, 1-alpha*A
+		a0, a1, a2 = 1+alpha/A, -2*cos, 1-alpha/A
+	case LowShelf:
+		b0 = A * ((A + 1) - (A-1)*cos + sqA)
+		b1 = 2 * A * ((A - 1) - (A+1)*cos)
+		b2 = A * ((A + 1) - (A-1)*cos - sqA)
+		a0 = (A + 1) + (A-1)*cos + sqA
+		a1 = -2 * ((A - 1) + (A+1)*cos)
+		a2 = (A + 1) + (A-1)*cos - sqA
+	case HighShelf:
+		b0 = A * ((A + 1) + (A-1)*cos + sqA)
+		b1 = -2 * A * ((A - 1) + (A+1)*cos)
+		b2 = A * ((A + 1) + (A-1)*cos - sqA)
+		a0 = (A + 1) - (A-1)*cos + sqA
+		a1 = 2 * ((A - 1) - (A+1)*cos)
+		a2 = (A + 1) - (A-1)*cos - sqA
+	case LowPass:
+		b0, b1, b2 = (1-cos)/2, 1-cos, (1-cos)/2
+		a0, a1, a2 = 1+alpha, -2*cos, 1-alpha
+	case HighPass:
+		b0, b1, b2 = (1+cos)/2, -(1 + cos), (1+cos)/2
+		a0, a1, a2 = 1+alpha, -2*cos, 1-alpha
+	case BandPass:
+		b0, b1, b2 = alpha, 0, -alpha
+		a0, a1, a2 = 1+alpha, -2*cos, 1-alpha
+	case Notch:
+		b0, b1, b2 = 1, -2*cos, 1
+		a0, a1, a2 = 1+alpha, -2*cos, 1-alpha
+	case AllPass:
+		b0, b1, b2 = 1-alpha, -2*cos, 1+alpha
+		a0, a1, a2 = 1+alpha, -2*cos, 1-alpha
+	default:
+		return coefs{}, errors.Errorf("unknown filter type %v", b.Type)
+	}
+	return coefs{b0 / a0, b1 / a0, b2 / a0, a1 / a0, a2 / a0}, nil
+}
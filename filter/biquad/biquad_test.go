@@ -0,0 +1,234 @@
+package biquad_test
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ebiiim/eq/filter/biquad"
+	"github.com/ebiiim/eq/pcm"
+	"github.com/google/go-cmp/cmp"
+)
+
+// sine returns n frames of a stereo int16 sine wave.
+func sine(freq float64, amp float64, n int) []byte {
+	b := make([]byte, n*4)
+	for i := 0; i < n; i++ {
+		v := uint16(int16(amp * math.Sin(2*math.Pi*freq*float64(i)/48000)))
+		binary.LittleEndian.PutUint16(b[i*4:], v)
+		binary.LittleEndian.PutUint16(b[i*4+2:], v)
+	}
+	return b
+}
+
+// peak returns the maximum absolute sample value in the second half of b.
+func peak(b []byte) float64 {
+	var max float64
+	for i := len(b) / 2; i < len(b)-1; i += 2 {
+		v := math.Abs(float64(int16(binary.LittleEndian.Uint16(b[i : i+2]))))
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+func TestFilter(t *testing.T) {
+	cases := []struct {
+		name  string
+		bands []biquad.Band
+		freq  float64
+		ratio float64 // expected output/input amplitude ratio
+	}{
+		{"no_band", nil, 1000, 1},
+		{"peaking_0dB", []biquad.Band{{biquad.Peaking, 1000, 1, 0}}, 1000, 1},
+		{"peaking_+6dB", []biquad.Band{{biquad.Peaking, 1000, 1, 6}}, 1000, 1.995},
+		{"peaking_-6dB", []biquad.Band{{biquad.Peaking, 1000, 1, -6}}, 1000, 0.501},
+		{"lowshelf_-6dB", []biquad.Band{{biquad.LowShelf, 1000, 0.707, -6}}, 50, 0.501},
+		{"highshelf_+6dB", []biquad.Band{{biquad.HighShelf, 1000, 0.707, 6}}, 15000, 1.995},
+		{"lowpass", []biquad.Band{{biquad.LowPass, 500, 0.707, 0}}, 10000, 0},
+		{"highpass", []biquad.Band{{biquad.HighPass, 5000, 0.707, 0}}, 100, 0},
+		{"bandpass", []biquad.Band{{biquad.BandPass, 1000, 2, 0}}, 1000, 1},
+		{"notch", []biquad.Band{{biquad.Notch, 1000, 2, 0}}, 1000, 0},
+		{"allpass", []biquad.Band{{biquad.AllPass, 1000, 0.707, 0}}, 1000, 1},
+		{"two_bands", []biquad.Band{{biquad.Peaking, 1000, 1, 6}, {biquad.Peaking, 1000, 1, -6}}, 1000, 1},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			var f biquad.Filter
+			for _, b := range c.bands {
+				if _, err := f.Add(b); err != nil {
+					t.Fatal(err)
+				}
+			}
+			in := sine(c.freq, 8000, 4800)
+			if _, err := f.Write(in); err != nil {
+				t.Fatal(err)
+			}
+			got := make([]byte, len(in))
+			if _, err := f.Read(got); err != nil {
+				t.Fatal(err)
+			}
+			ratio := peak(got) / peak(in)
+			if math.Abs(ratio-c.ratio) > 0.05 {
+				t.Errorf("got ratio %.3f want %.3f", ratio, c.ratio)
+			}
+			if err := f.Close(); err != nil {
+				t.Errorf("could not close: %v", err)
+			}
+		})
+	}
+}
+
+func TestFilter_Set(t *testing.T) {
+	var f biquad.Filter
+	i, err := f.Add(biquad.Band{Type: biquad.Peaking, Freq: 1000, Q: 1, Gain: 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := sine(1000, 8000, 4800)
+	got := make([]byte, len(in))
+	f.Write(in)
+	f.Read(got)
+
+	want := biquad.Band{Type: biquad.Peaking, Freq: 1000, Q: 1, Gain: -6}
+	if err := f.Set(i, want); err != nil {
+		t.Fatal(err)
+	}
+	f.Write(in)
+	f.Read(got)
+	if ratio := peak(got) / peak(in); math.Abs(ratio-0.501) > 0.05 {
+		t.Errorf("got ratio %.3f want %.3f", ratio, 0.501)
+	}
+	if !cmp.Equal(f.Bands(), []biquad.Band{want}) {
+		t.Errorf("got %v want %v", f.Bands(), []biquad.Band{want})
+	}
+	if err := f.Set(1, want); err == nil {
+		t.Error("got nil want error (out of range)")
+	}
+	f.Close()
+}
+
+// dc returns n frames of a stereo int16 constant.
+func dc(v int16, n int) []byte {
+	b := make([]byte, n*4)
+	for i := 0; i < n*2; i++ {
+		binary.LittleEndian.PutUint16(b[i*2:], uint16(v))
+	}
+	return b
+}
+
+func TestFilter_SetRamp(t *testing.T) {
+	cases := []struct {
+		name    string
+		ramp    time.Duration
+		maxStep float64 // the maximum change between samples after Set
+	}{
+		{"default", 0, 30}, // 20ms: 12000/960 per sample on average (more at the end as the gain is in dB)
+		{"100ms", 100 * time.Millisecond, 8},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			f := biquad.Filter{Ramp: c.ramp}
+			defer f.Close()
+			// the gain of a low shelf at DC is Gain
+			i, err := f.Add(biquad.Band{Type: biquad.LowShelf, Freq: 200, Q: 0.707, Gain: 0})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]byte, 9600*4)
+			f.Write(dc(4000, 4800))
+			if err := f.Set(i, biquad.Band{Type: biquad.LowShelf, Freq: 200, Q: 0.707, Gain: 12}); err != nil {
+				t.Fatal(err)
+			}
+			f.Write(dc(4000, 4800))
+			if _, err := f.Read(got); err != nil {
+				t.Fatal(err)
+			}
+
+			var maxStep float64
+			prev := float64(int16(binary.LittleEndian.Uint16(got)))
+			for j := 4; j < len(got); j += 4 { // the left channel
+				v := float64(int16(binary.LittleEndian.Uint16(got[j:])))
+				maxStep = math.Max(maxStep, math.Abs(v-prev))
+				prev = v
+			}
+			if maxStep > c.maxStep {
+				t.Errorf("got a change of %.0f between samples want <=%.0f", maxStep, c.maxStep)
+			}
+			if want := 4000 * math.Pow(10, 12.0/20); math.Abs(prev-want) > want*0.01 {
+				t.Errorf("got %.0f want %.0f after the ramp", prev, want)
+			}
+		})
+	}
+}
+
+func TestFilter_Add(t *testing.T) {
+	cases := []struct {
+		name  string
+		band  biquad.Band
+		isErr bool
+	}{
+		{"normal", biquad.Band{biquad.Peaking, 1000, 1, 3}, false},
+		{"F_zero_freq", biquad.Band{biquad.Peaking, 0, 1, 3}, true},
+		{"F_nyquist", biquad.Band{biquad.Peaking, 24000, 1, 3}, true},
+		{"F_zero_q", biquad.Band{biquad.Peaking, 1000, 0, 3}, true},
+		{"F_unknown_type", biquad.Band{biquad.Type(99), 1000, 1, 3}, true},
+		{"F_nan_freq", biquad.Band{biquad.Peaking, math.NaN(), 1, 3}, true},
+		{"F_nan_q", biquad.Band{biquad.Peaking, 1000, math.NaN(), 3}, true},
+		{"F_inf_q", biquad.Band{biquad.Peaking, 1000, math.Inf(1), 3}, true},
+		{"F_nan_gain", biquad.Band{biquad.Peaking, 1000, 1, math.NaN()}, true},
+		{"F_inf_gain", biquad.Band{biquad.Peaking, 1000, 1, math.Inf(-1)}, true},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			var f biquad.Filter
+			_, err := f.Add(c.band)
+			if !((err != nil) == c.isErr) {
+				t.Errorf("got %v, want %v(isErr) ", err, c.isErr)
+			}
+		})
+	}
+}
+
+func TestFilter_Format(t *testing.T) {
+	cases := []struct {
+		name   string
+		format pcm.Format
+		isErr  bool
+	}{
+		{"default", pcm.Format{}, false},
+		{"mono_44100", pcm.Format{Channels: 1, SampleRate: 44100, BitDepth: 16, Encoding: pcm.Signed, ByteOrder: binary.LittleEndian}, false},
+		{"F_s24", pcm.Format{Channels: 2, SampleRate: 48000, BitDepth: 24, Encoding: pcm.Signed, ByteOrder: binary.LittleEndian}, true},
+		{"F_s16be", pcm.Format{Channels: 2, SampleRate: 48000, BitDepth: 16, Encoding: pcm.Signed, ByteOrder: binary.BigEndian}, true},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			f := biquad.Filter{Format: c.format}
+			defer f.Close()
+			_, err := f.Write(make([]byte, 64))
+			if !((err != nil) == c.isErr) {
+				t.Errorf("got %v, want %v(isErr) ", err, c.isErr)
+			}
+			if !c.isErr {
+				return
+			}
+			// Read and CloseWrite also return the error instead of blocking
+			if _, err := f.Read(make([]byte, 64)); err == nil {
+				t.Error("Read: got nil want error")
+			}
+			if err := f.CloseWrite(); err == nil {
+				t.Error("CloseWrite: got nil want error")
+			}
+		})
+	}
+}
@@ -4,8 +4,46 @@ package filter
 
 import (
 	"io"
+	"time"
+
+	"github.com/ebiiim/eq/internal/safe"
+	"github.com/pkg/errors"
 )
 
+// ErrClosed is returned by Read and Write of Filter after Close.
+var ErrClosed = errors.New("use of closed filter")
+
+// ErrTimeout is returned (as a cause) by Read and Write of Filter when a deadline is exceeded.
+//
+// It has the Timeout method that returns true, as net.Error does.
+var ErrTimeout = safe.ErrTimeout
+
+// Filter is a stream data processor.
+//
+// Implementations may also implement pcm.InputFormatter and pcm.OutputFormatter
+// so that pcm.Check can refuse to connect stages with mismatched formats.
 type Filter interface {
 	io.ReadWriteCloser
 }
+
+// CloseWriter is implemented by Filters that support closing the write side.
+//
+// CloseWrite tells the Filter that no more data will be written.
+// The Filter processes all data it holds (including a partial chunk)
+// and then Read returns io.EOF, so that the Filter works with io.Copy and ioutil.ReadAll.
+type CloseWriter interface {
+	CloseWrite() error
+}
+
+// Deadliner is implemented by Filters that support deadlines.
+//
+// After a deadline is exceeded, Read or Write returns ErrTimeout (as a cause)
+// instead of blocking, and the Filter can still be used
+// (e.g. data that come later can be read by the next Read).
+// As with io.Reader and io.Writer, n may be non-zero with ErrTimeout
+// (the bytes read or written before the deadline).
+// The zero value of t means no deadline.
+type Deadliner interface {
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
@@ -4,11 +4,15 @@ package function
 
 import (
 	"encoding/binary"
-	"errors"
+	"math"
 	"sync"
+	"time"
 	"unicode"
 
+	"github.com/ebiiim/eq/filter"
 	"github.com/ebiiim/eq/internal/safe"
+	"github.com/ebiiim/eq/pcm"
+	"github.com/pkg/errors"
 )
 
 // Filter is a stream data processor using a function.
@@ -24,22 +28,61 @@ type Filter struct {
 	// Change this value if the specified Func cares about the data size.
 	// Func is called only when the size of data in the input buffer
 	// (Write puts data into the input buffer) is ChunkSize or more.
+	//
+	// If Format is set, ChunkSize must be a multiple of the frame size
+	// (use Frames instead to specify it in frames).
 	ChunkSize int
 
-	initOnce sync.Once
-	done     chan struct{} // This channel should only be initialized by initialize() and by closed by Close()
-	wg       sync.WaitGroup
+	// Frames determines the number of PCM frames to pass to Func once
+	// (optional, default: 8 if Format is set).
+	//
+	// Frames requires Format, and sets ChunkSize to Frames * Format.FrameSize(),
+	// so that Func only sees whole frames.
+	Frames int
+
+	// Workers is the number of goroutines that call Func (default: 1).
+	//
+	// If Workers is more than 1, chunks are processed concurrently
+	// (the output is still in the order of the input),
+	// so Func must be safe for concurrent use and must not depend on the previous chunks
+	// (e.g. analysis of each block or Volume, but not IIR filters,
+	// Gain or the functions returned by Interleaved and Deinterleaved, which have state).
+	Workers int
+
+	// Format is the format of the stream that Func expects (optional).
+	//
+	// The zero value means that Func accepts any data.
+	Format pcm.Format
+
+	initOnce  sync.Once
+	initErr   error
+	closeOnce sync.Once
+	done      chan struct{} // This channel should only be initialized by initialize() and by closed by Close()
+	wg        sync.WaitGroup
 
+	writeMu    sync.Mutex // guards inBuf and inCh against CloseWrite
+	writeEOF   bool
 	inBuf      safe.Buffer
 	outBuf     safe.Buffer
 	inCh       chan []byte
-	outCh      chan []byte
+	outCh      chan []byte // closed by the goroutine after all data are processed
 	bufferSize int
+	pending    []byte // a chunk that Write could not pass before the deadline
+
+	dlMu     sync.Mutex // guards the deadlines
+	rDL, wDL time.Time
 }
 
-func (f *Filter) initialize() {
-	if f.ChunkSize == 0 {
-		f.ChunkSize = 32
+func (f *Filter) initialize() error {
+	err := f.setChunkSize()
+	if err != nil {
+		return err
+	}
+	if f.Workers < 0 {
+		return errors.New("Workers must not be negative")
+	}
+	if f.Workers == 0 {
+		f.Workers = 1
 	}
 	if f.Func.IsNil() {
 		f.Func.Set(func([]byte) {})
@@ -49,32 +92,186 @@ func (f *Filter) initialize() {
 	f.outCh = make(chan []byte, f.bufferSize)
 	f.done = make(chan struct{})
 
-	go func() {
+	if f.Workers == 1 {
 		f.wg.Add(1)
+		go f.process()
+	} else {
+		f.wg.Add(2 + f.Workers)
+		f.processParallel()
+	}
+	return nil
+}
+
+// process passes chunks from inCh to Func and then to outCh.
+func (f *Filter) process() {
+	defer f.wg.Done()
+	for {
+		select {
+		case b, ok := <-f.inCh:
+			if !ok {
+				close(f.outCh)
+				return
+			}
+			f.Func.Do(b)
+			select {
+			case f.outCh <- b:
+			case <-f.done:
+				return
+			}
+		case <-f.done:
+			return
+		}
+	}
+}
+
+// chunk is a chunk processed by a worker (see processParallel).
+type chunk struct {
+	b    []byte
+	done chan struct{} // closed after processing b
+}
+
+// processParallel starts a dispatcher, Workers workers and a collector.
+//
+// The dispatcher sends each chunk to both the workers and the collector,
+// and the collector waits for the chunks in the order of the input,
+// so that at most Workers chunks are processed at the same time.
+func (f *Filter) processParallel() {
+	jobs := make(chan chunk)
+	order := make(chan chunk, f.Workers)
+
+	go func() { // dispatcher
 		defer f.wg.Done()
+		defer close(jobs)
+		defer close(order)
 		for {
 			select {
-			case b := <-f.inCh:
-				f.Func.Do(b)
-				f.outCh <- b
+			case b, ok := <-f.inCh:
+				if !ok {
+					return
+				}
+				c := chunk{b: b, done: make(chan struct{})}
+				select {
+				case order <- c:
+				case <-f.done:
+					return
+				}
+				select {
+				case jobs <- c:
+				case <-f.done:
+					return
+				}
+			case <-f.done:
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < f.Workers; i++ {
+		go func() {
+			defer f.wg.Done()
+			for c := range jobs {
+				f.Func.Get()(c.b)
+				close(c.done)
+			}
+		}()
+	}
+
+	go func() { // collector
+		defer f.wg.Done()
+		for c := range order {
+			select {
+			case <-c.done:
+			case <-f.done:
+				return
+			}
+			select {
+			case f.outCh <- c.b:
 			case <-f.done:
 				return
 			}
 		}
+		select {
+		case <-f.done: // order is closed by Close
+		default:
+			close(f.outCh)
+		}
 	}()
 }
 
+// setChunkSize sets ChunkSize from Frames and Format,
+// and returns an error if chunks can not be aligned to frames.
+func (f *Filter) setChunkSize() error {
+	if f.ChunkSize < 0 || f.Frames < 0 {
+		return errors.New("ChunkSize and Frames must not be negative")
+	}
+	if f.Format.IsZero() {
+		if f.Frames != 0 {
+			return errors.New("Frames requires Format")
+		}
+		if f.ChunkSize == 0 {
+			f.ChunkSize = 32
+		}
+		return nil
+	}
+	if err := f.Format.Validate(); err != nil {
+		return errors.Wrap(err, "invalid Format")
+	}
+	fs := f.Format.FrameSize()
+	switch {
+	case f.Frames == 0 && f.ChunkSize == 0:
+		f.Frames = 8
+	case f.Frames == 0:
+		if f.ChunkSize%fs != 0 {
+			return errors.Errorf("ChunkSize %d is not a multiple of the frame size %d of %v", f.ChunkSize, fs, f.Format)
+		}
+		f.Frames = f.ChunkSize / fs
+	case f.ChunkSize != 0 && f.ChunkSize != f.Frames*fs:
+		return errors.Errorf("ChunkSize %d does not match %d frames of %v", f.ChunkSize, f.Frames, f.Format)
+	}
+	f.ChunkSize = f.Frames * fs
+	return nil
+}
+
+func (f *Filter) start() error {
+	f.initOnce.Do(func() { f.initErr = f.initialize() })
+	return f.initErr
+}
+
 // Read reads len(b) bytes from
 // the output buffer (contains processed data) into b.
 //
 // The function blocks until it reads len(b) bytes or more.
-// The function does not support ioutil.ReadAll (blocks permanently).
+// After CloseWrite, the function returns the remaining data
+// and then io.EOF, so ioutil.ReadAll is supported.
+// The function returns filter.ErrTimeout if the read deadline is exceeded
+// (the data are kept for the next call), and filter.ErrClosed after Close.
 func (f *Filter) Read(b []byte) (n int, err error) {
+	if err = f.start(); err != nil {
+		return 0, err
+	}
+	if f.isClosed() {
+		return 0, filter.ErrClosed
+	}
+	f.dlMu.Lock()
+	timeout, stop := after(f.rDL)
+	f.dlMu.Unlock()
+	defer stop()
+
 	readLen := len(b)
 	for f.outBuf.Len() < readLen {
-		_, err := f.outBuf.Write(<-f.outCh)
-		if err != nil {
-			return 0, err
+		select {
+		case bb, ok := <-f.outCh:
+			if !ok {
+				return f.outBuf.Read(b) // returns io.EOF if empty
+			}
+			_, err := f.outBuf.Write(bb)
+			if err != nil {
+				return 0, err
+			}
+		case <-f.done:
+			return 0, filter.ErrClosed
+		case <-timeout:
+			return 0, filter.ErrTimeout
 		}
 	}
 	return f.outBuf.Read(b)
@@ -83,36 +280,166 @@ func (f *Filter) Read(b []byte) (n int, err error) {
 // Write writes len(b) bytes from b to the input buffer
 // that contains pre-processed data.
 //
-// The first call to this function invokes a goroutine
-// that sequentially reads data from the input buffer,
-// process data using Func, and writes the processed data into the output buffer.
+// The first call to this function invokes a goroutine (or Workers goroutines)
+// that reads data from the input buffer,
+// process data using Func, and writes the processed data into the output buffer in order.
+//
+// If the write deadline is exceeded, the function returns len(b) and filter.ErrTimeout;
+// the data are kept in the input buffer and passed to Func by the next call or CloseWrite.
 func (f *Filter) Write(b []byte) (int, error) {
-	f.initOnce.Do(f.initialize)
+	if err := f.start(); err != nil {
+		return 0, err
+	}
+
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+	if f.isClosed() {
+		return 0, filter.ErrClosed
+	}
+	if f.writeEOF {
+		return 0, errors.New("write after CloseWrite")
+	}
 
 	_, err := f.inBuf.Write(b)
 	if err != nil {
 		return 0, err
 	}
-	for f.inBuf.Len() >= f.ChunkSize {
-		bb := make([]byte, f.ChunkSize)
-		_, err = f.inBuf.Read(bb)
-		if err != nil {
-			return 0, err
+	f.dlMu.Lock()
+	timeout, stop := after(f.wDL)
+	f.dlMu.Unlock()
+	defer stop()
+
+	for f.pending != nil || f.inBuf.Len() >= f.ChunkSize {
+		if f.pending == nil {
+			f.pending = make([]byte, f.ChunkSize)
+			_, err = f.inBuf.Read(f.pending)
+			if err != nil {
+				return 0, err
+			}
+		}
+		select {
+		case f.inCh <- f.pending:
+			f.pending = nil
+		case <-f.done:
+			return 0, filter.ErrClosed
+		case <-timeout:
+			return len(b), filter.ErrTimeout
 		}
-		f.inCh <- bb
 	}
 	return len(b), nil
 }
 
+// SetReadDeadline sets the deadline for Read (the zero value means no deadline).
+func (f *Filter) SetReadDeadline(t time.Time) error {
+	f.dlMu.Lock()
+	defer f.dlMu.Unlock()
+	f.rDL = t
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for Write (the zero value means no deadline).
+func (f *Filter) SetWriteDeadline(t time.Time) error {
+	f.dlMu.Lock()
+	defer f.dlMu.Unlock()
+	f.wDL = t
+	return nil
+}
+
+// after returns a channel that receives a value at the deadline dl
+// (nil if dl is zero) and a function to release it.
+func after(dl time.Time) (<-chan time.Time, func() bool) {
+	if dl.IsZero() {
+		return nil, func() bool { return false }
+	}
+	t := time.NewTimer(time.Until(dl))
+	return t.C, t.Stop
+}
+
+// CloseWrite passes the data remaining in the input buffer
+// (less than ChunkSize bytes, or more if Write has timed out) to Func, and closes the input.
+//
+// If Format is set, only whole frames are passed to Func,
+// and the function returns an error if an incomplete frame is discarded.
+// Read returns io.EOF after all processed data are read.
+func (f *Filter) CloseWrite() error {
+	if err := f.start(); err != nil {
+		return err
+	}
+
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+	if f.writeEOF {
+		return nil
+	}
+	f.writeEOF = true
+	var discarded int
+	for f.pending != nil || f.inBuf.Len() > 0 { // Write may have left chunks on timeout
+		if f.pending == nil {
+			n := f.inBuf.Len()
+			if n > f.ChunkSize {
+				n = f.ChunkSize
+			}
+			if fs := f.Format.FrameSize(); fs > 0 && n%fs != 0 {
+				n -= n % fs
+				if n == 0 { // only an incomplete frame is left
+					discarded = f.inBuf.Len()
+					f.inBuf.Read(make([]byte, discarded))
+					break
+				}
+			}
+			f.pending = make([]byte, n)
+			_, err := f.inBuf.Read(f.pending)
+			if err != nil {
+				return err
+			}
+		}
+		select {
+		case f.inCh <- f.pending:
+			f.pending = nil
+		case <-f.done:
+			return filter.ErrClosed
+		}
+	}
+	close(f.inCh)
+	if discarded > 0 {
+		return errors.Errorf("discarded an incomplete frame of %d bytes", discarded)
+	}
+	return nil
+}
+
+func (f *Filter) isClosed() bool {
+	select {
+	case <-f.done:
+		return true
+	default:
+		return false
+	}
+}
+
 // Close closes the Filter object.
+//
+// Data that have not been read are discarded.
 func (f *Filter) Close() error {
-	close(f.done)
-	f.wg.Wait()
-	close(f.inCh)
-	close(f.outCh)
+	if f.start() != nil {
+		return nil // not started
+	}
+	f.closeOnce.Do(func() {
+		close(f.done)
+		f.wg.Wait()
+	})
 	return nil
 }
 
+// InputFormat returns f.Format.
+func (f *Filter) InputFormat() pcm.Format {
+	return f.Format
+}
+
+// OutputFormat returns f.Format.
+func (f *Filter) OutputFormat() pcm.Format {
+	return f.Format
+}
+
 // Rot13 reads len(b) bytes from b and shifts them
 // with Caesar Cipher (assuming that all bytes in b are ASCII characters).
 var Rot13 = func(b []byte) {
@@ -144,19 +471,29 @@ var ToLower = func(b []byte) {
 // Volume returns a function that changes the volume of audio data from b.
 //
 // The returned function reads len(b) bytes from b
-// assuming that the data is an Uint16 stream
-// and multiply each sample by 'volume'.
+// assuming that the data is a signed 16-bit little-endian stream
+// and multiply each sample by 'volume' (the results are clipped).
+//
+// The returned function has no state, so it can be used with Filter.Workers.
+// Use Gain to change the volume while playing.
 func Volume(volume float64) (func(b []byte), error) {
-	if volume < 0 {
-		return nil, errors.New("volume must be >0")
-	}
-	fn := func(b []byte) {
-		for i := 0; i < len(b)-1; i += 2 {
-			sample := binary.LittleEndian.Uint16(b[i : i+2])
-			bs := make([]byte, 2)
-			binary.LittleEndian.PutUint16(bs, uint16(float64(int16(sample))*volume))
-			b[i], b[i+1] = bs[0], bs[1]
-		}
+	if err := checkVolume(volume); err != nil {
+		return nil, err
 	}
-	return fn, nil
+	return func(b []byte) {
+		for i := 0; i+1 < len(b); i += 2 {
+			v := math.Floor(float64(int16(binary.LittleEndian.Uint16(b[i:])))*volume + 0.5)
+			if v > math.MaxInt16 {
+				v = math.MaxInt16
+			} else if v < math.MinInt16 {
+				v = math.MinInt16
+			}
+			binary.LittleEndian.PutUint16(b[i:], uint16(int16(v)))
+		}
+	}, nil
+}
+
+// VolumeDB is the same as Volume except that the volume is in decibels (e.g. +6).
+func VolumeDB(db float64) (func(b []byte), error) {
+	return Volume(FromDB(db))
 }
@@ -1,9 +1,18 @@
 package function_test
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
 	"testing"
+	"time"
 
+	"github.com/ebiiim/eq/filter"
 	"github.com/ebiiim/eq/filter/function"
+	"github.com/ebiiim/eq/pcm"
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -87,6 +96,18 @@ func TestFilterMutex(t *testing.T) {
 	}
 }
 
+func TestVolumeDB(t *testing.T) {
+	fn, err := function.VolumeDB(-6.0206) // 0.5
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := []byte{10, 00, 20, 00}
+	fn(b)
+	if diff := cmp.Diff([]byte{05, 00, 10, 00}, b); diff != "" {
+		t.Errorf("(-want +got)\n%s", diff)
+	}
+}
+
 func TestVolume(t *testing.T) {
 	cases := []struct {
 		name  string
@@ -99,7 +120,10 @@ func TestVolume(t *testing.T) {
 		{"no_change_8B", 1.0, []byte{10, 00, 20, 00, 30, 00, 40, 00}, []byte{10, 00, 20, 00, 30, 00, 40, 00}, false},
 		{"0.5", 0.5, []byte{10, 00, 20, 00, 30, 00, 40, 00}, []byte{05, 00, 10, 00, 15, 00, 20, 00}, false},
 		{"mute", 0, []byte{10, 00, 20, 00, 30, 00, 40, 00}, []byte{00, 00, 00, 00, 00, 00, 00, 00}, false},
+		{"saturate_max", 2.0, []byte{0x20, 0x4e, 0xe0, 0xb1}, []byte{0xff, 0x7f, 0x00, 0x80}, false}, // 20000, -20000
 		{"F_negative", -0.1, []byte{10, 00, 20, 00, 30, 00, 40, 00}, nil, true},
+		{"F_nan", math.NaN(), []byte{10, 00}, nil, true},
+		{"F_inf", math.Inf(1), []byte{10, 00}, nil, true},
 	}
 	for _, c := range cases {
 		c := c
@@ -119,3 +143,347 @@ func TestVolume(t *testing.T) {
 		})
 	}
 }
+
+func TestFilter_CloseWrite(t *testing.T) {
+	cases := []struct {
+		name      string
+		fn        func([]byte)
+		chunkSize int
+		in        []byte
+		want      []byte
+	}{
+		{"aligned", function.ToUpper, 4, []byte("abcdefgh"), []byte("ABCDEFGH")},
+		{"partial", function.ToUpper, 4, []byte("hello, world"[:10]), []byte("HELLO, WOR")},
+		{"smaller_than_chunk", function.ToUpper, 32, []byte("hello"), []byte("HELLO")},
+		{"empty", function.ToUpper, 4, []byte{}, []byte{}},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			var f function.Filter
+			f.ChunkSize = c.chunkSize
+			f.Func.Set(c.fn)
+			_, err := f.Write(c.in)
+			if err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+			err = f.CloseWrite()
+			if err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+			_, err = f.Write(c.in)
+			if err == nil {
+				t.Error("got nil want error (write after CloseWrite)")
+			}
+			got, err := ioutil.ReadAll(&f)
+			if err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+			if !cmp.Equal(got, c.want, cmp.Comparer(bytes.Equal)) {
+				t.Errorf("got %q want %q", got, c.want)
+			}
+			err = f.Close()
+			if err != nil {
+				t.Errorf("could not close: %v", err)
+			}
+		})
+	}
+}
+
+func TestFilter_Copy(t *testing.T) {
+	in := bytes.Repeat([]byte("abc"), 100000) // larger than the internal buffer
+	var f function.Filter
+	f.Func.Set(function.ToUpper)
+	errCh := make(chan error)
+	go func() {
+		_, err := io.Copy(&f, bytes.NewReader(in))
+		if err == nil {
+			err = f.CloseWrite()
+		}
+		errCh <- err
+	}()
+	var out bytes.Buffer
+	_, err := io.Copy(&out, &f)
+	if err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if want := bytes.ToUpper(in); !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("got %d bytes want %d bytes", out.Len(), len(want))
+	}
+	f.Close()
+}
+
+func TestFilter_Close(t *testing.T) {
+	cases := []struct {
+		name string
+		fn   func(f *function.Filter)
+	}{
+		{"init", func(f *function.Filter) {}},
+		{"after_write", func(f *function.Filter) { f.Write(make([]byte, 64)) }},
+		{"unread_data", func(f *function.Filter) { f.Write(make([]byte, 1<<20)) }},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			var f function.Filter
+			f.ChunkSize = 1024
+			go c.fn(&f)
+			time.Sleep(50 * time.Millisecond)
+			err := f.Close()
+			if err != nil {
+				t.Errorf("could not close: %v", err)
+			}
+			_, err = f.Read(make([]byte, 1))
+			if err != filter.ErrClosed {
+				t.Errorf("got %v want %v", err, filter.ErrClosed)
+			}
+			_, err = f.Write(make([]byte, 1024))
+			if err != filter.ErrClosed {
+				t.Errorf("got %v want %v", err, filter.ErrClosed)
+			}
+		})
+	}
+}
+
+func TestFilter_Deadline(t *testing.T) {
+	t.Run("read", func(t *testing.T) {
+		t.Parallel()
+		release := make(chan struct{})
+		f := &function.Filter{ChunkSize: 4}
+		f.Func.Set(func(b []byte) { <-release })
+		defer f.Close()
+
+		_, err := f.Write([]byte("abcd"))
+		if err != nil {
+			t.Fatalf("could not write: %v", err)
+		}
+		f.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		b := make([]byte, 4)
+		_, err = f.Read(b)
+		if err != filter.ErrTimeout {
+			t.Errorf("got %v want %v", err, filter.ErrTimeout)
+		}
+
+		close(release)
+		f.SetReadDeadline(time.Time{})
+		_, err = io.ReadFull(f, b)
+		if err != nil || string(b) != "abcd" {
+			t.Errorf("got %q, %v want %q", b, err, "abcd")
+		}
+	})
+	t.Run("write", func(t *testing.T) {
+		t.Parallel()
+		release := make(chan struct{})
+		const chunk = 32768 // 2 chunks can be buffered
+		f := &function.Filter{ChunkSize: chunk}
+		f.Func.Set(func(b []byte) { <-release })
+		defer f.Close()
+
+		f.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
+		var (
+			err     error
+			written int
+		)
+		for i := 0; i < 8 && err == nil; i++ {
+			var n int
+			n, err = f.Write(make([]byte, chunk))
+			written += n
+		}
+		if err != filter.ErrTimeout {
+			t.Fatalf("got %v want %v", err, filter.ErrTimeout)
+		}
+
+		close(release)
+		f.SetWriteDeadline(time.Time{})
+		err = f.CloseWrite()
+		if err != nil {
+			t.Fatalf("could not close write: %v", err)
+		}
+		out, err := ioutil.ReadAll(f)
+		if err != nil {
+			t.Fatalf("could not read: %v", err)
+		}
+		if len(out) != written {
+			t.Errorf("got %d bytes want %d", len(out), written)
+		}
+	})
+}
+
+func TestFilter_Frames(t *testing.T) {
+	s24 := pcm.Format{Channels: 2, SampleRate: 48000, BitDepth: 24, Encoding: pcm.Signed, ByteOrder: binary.LittleEndian}
+	cases := []struct {
+		name      string
+		f         *function.Filter
+		wantChunk int
+		isErr     bool
+	}{
+		{"no_format", &function.Filter{}, 32, false},
+		{"default_frames", &function.Filter{Format: s24}, 48, false},
+		{"frames", &function.Filter{Format: s24, Frames: 3}, 18, false},
+		{"chunk_size", &function.Filter{Format: s24, ChunkSize: 12}, 12, false},
+		{"both", &function.Filter{Format: s24, Frames: 2, ChunkSize: 12}, 12, false},
+		{"F_unaligned", &function.Filter{Format: s24, ChunkSize: 32}, 0, true},
+		{"F_mismatch", &function.Filter{Format: s24, Frames: 3, ChunkSize: 12}, 0, true},
+		{"F_no_format", &function.Filter{Frames: 3}, 0, true},
+		{"F_invalid_format", &function.Filter{Format: pcm.Format{Channels: 2}, Frames: 3}, 0, true},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			var sizes []int
+			c.f.Func.Set(func(b []byte) { sizes = append(sizes, len(b)) })
+			defer c.f.Close()
+			_, err := c.f.Write(make([]byte, 60))
+			if !((err != nil) == c.isErr) {
+				t.Errorf("got %v, want %v(isErr) ", err, c.isErr)
+			}
+			if c.isErr {
+				return
+			}
+			if c.f.ChunkSize != c.wantChunk {
+				t.Errorf("got ChunkSize %d want %d", c.f.ChunkSize, c.wantChunk)
+			}
+			err = c.f.CloseWrite()
+			if fs := c.f.Format.FrameSize(); (fs > 0 && 60%fs != 0) != (err != nil) {
+				t.Errorf("got %v for an incomplete frame", err)
+			}
+			ioutil.ReadAll(c.f)
+			for _, size := range sizes {
+				if fs := c.f.Format.FrameSize(); fs > 0 && size%fs != 0 {
+					t.Errorf("Func got %d bytes that are not aligned to %d", size, fs)
+				}
+			}
+		})
+	}
+}
+
+func TestFilter_Workers(t *testing.T) {
+	cases := []struct {
+		name    string
+		workers int
+		isErr   bool
+	}{
+		{"default", 0, false},
+		{"1", 1, false},
+		{"4", 4, false},
+		{"F_negative", -1, true},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			f := &function.Filter{ChunkSize: 4, Workers: c.workers}
+			defer f.Close()
+			// takes longer for earlier chunks so that they finish out of order
+			f.Func.Set(func(b []byte) {
+				time.Sleep(time.Duration(255-b[0]) * 10 * time.Microsecond)
+				for i := range b {
+					b[i]++
+				}
+			})
+			in := make([]byte, 4*256)
+			for i := range in {
+				in[i] = byte(i / 4)
+			}
+			go func() {
+				f.Write(in)
+				f.CloseWrite()
+			}()
+			got, err := ioutil.ReadAll(f)
+			if !((err != nil) == c.isErr) {
+				t.Errorf("got %v, want %v(isErr) ", err, c.isErr)
+			}
+			if c.isErr {
+				return
+			}
+			for i := range got {
+				if got[i] != byte(i/4+1) {
+					t.Fatalf("got %d at %d want %d", got[i], i, byte(i/4+1))
+				}
+			}
+			if len(got) != len(in) {
+				t.Errorf("got %d bytes want %d", len(got), len(in))
+			}
+		})
+	}
+}
+
+func TestFilter_WorkersVolume(t *testing.T) {
+	f := &function.Filter{ChunkSize: 4, Workers: 4}
+	defer f.Close()
+	fn, err := function.Volume(0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Func.Set(fn)
+	in := make([]byte, 4*1024)
+	for i := 0; i < len(in); i += 2 {
+		binary.LittleEndian.PutUint16(in[i:], uint16(i))
+	}
+	go func() {
+		f.Write(in)
+		f.CloseWrite()
+	}()
+	got, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(in) {
+		t.Fatalf("got %d bytes want %d", len(got), len(in))
+	}
+	for i := 0; i < len(got); i += 2 {
+		if v := binary.LittleEndian.Uint16(got[i:]); v != uint16(i/2) {
+			t.Fatalf("got %d at %d want %d", v, i, i/2)
+		}
+	}
+}
+
+// dft writes the magnitude of the DFT of s16le samples in b into b (as an analysis of each block).
+func dft(b []byte) {
+	n := len(b) / 2
+	x := make([]float64, n)
+	for i := range x {
+		x[i] = float64(int16(binary.LittleEndian.Uint16(b[2*i:])))
+	}
+	for k := 0; k < n; k++ {
+		var re, im float64
+		for i, v := range x {
+			theta := 2 * math.Pi * float64(k*i) / float64(n)
+			re += v * math.Cos(theta)
+			im -= v * math.Sin(theta)
+		}
+		binary.LittleEndian.PutUint16(b[2*k:], uint16(math.Sqrt(re*re+im*im)/float64(n)))
+	}
+}
+
+func BenchmarkFilter_Workers(b *testing.B) {
+	const chunkSize, chunks = 512, 64
+	for _, workers := range []int{1, 2, 4, 8} {
+		workers := workers
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			f := &function.Filter{ChunkSize: chunkSize, Workers: workers}
+			f.Func.Set(dft)
+			defer f.Close()
+			in := make([]byte, chunkSize*chunks)
+			out := make([]byte, len(in))
+			b.SetBytes(int64(len(in)))
+			b.ResetTimer()
+			go func() {
+				for i := 0; i < b.N; i++ {
+					f.Write(in)
+				}
+			}()
+			for i := 0; i < b.N; i++ {
+				if _, err := io.ReadFull(f, out); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
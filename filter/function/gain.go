@@ -0,0 +1,204 @@
+package function
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ebiiim/eq/pcm"
+	"github.com/pkg/errors"
+)
+
+// Clipping is how Gain limits samples that exceed full scale.
+type Clipping int
+
+const (
+	// HardClip clips samples at full scale.
+	HardClip Clipping = iota
+	// SoftClip compresses samples above -2.5 dBFS so that they never exceed full scale (see SoftClipSample).
+	SoftClip
+)
+
+// Gain is a volume control that can be changed while playing without clicks.
+//
+// Changes of the volume (including Mute and Unmute) ramp over the ramp time (see Param).
+// Samples never wrap around but are limited to full scale (see Clipping).
+// Use Func for Filter.Func.
+type Gain struct {
+	param Param
+	fn    func(b []byte)
+	gains []float64 // used only by fn
+	max   float64   // the maximum sample value of the format
+
+	mu       sync.Mutex // guards the following
+	volume   float64
+	muted    bool
+	clipping Clipping
+	clipped  uint64
+}
+
+// NewGain returns a Gain of volume for data in format.
+func NewGain(format pcm.Format, volume float64, ramp time.Duration) (*Gain, error) {
+	if err := checkVolume(volume); err != nil {
+		return nil, err
+	}
+	g := &Gain{volume: volume, max: 1}
+	if format.Encoding != pcm.Float {
+		g.max = 1 - 1/math.Exp2(float64(format.BitDepth-1)) // e.g. 32767/32768
+	}
+	g.param.ramp = ramp
+	g.param.Reset(volume)
+	fn, err := Interleaved(format, g.process)
+	if err != nil {
+		return nil, err
+	}
+	g.fn = fn
+	return g, nil
+}
+
+// checkVolume returns an error if volume is negative, NaN or Inf.
+func checkVolume(volume float64) error {
+	if volume < 0 || math.IsNaN(volume) || math.IsInf(volume, 0) {
+		return errors.Errorf("volume must be >=0 and finite: %v", volume)
+	}
+	return nil
+}
+
+func (g *Gain) process(samples []float32, channels, sampleRate int) {
+	frames := len(samples) / channels
+	if cap(g.gains) < frames {
+		g.gains = make([]float64, frames)
+	}
+	g.gains = g.gains[:frames]
+	g.param.Fill(g.gains, sampleRate)
+
+	g.mu.Lock()
+	soft := g.clipping == SoftClip
+	g.mu.Unlock()
+	var clipped uint64
+	for i, v := range g.gains {
+		for c := 0; c < channels; c++ {
+			x := float64(samples[i*channels+c]) * v
+			if x > g.max || x < -1 {
+				clipped++
+			}
+			if soft {
+				x = SoftClipSample(x)
+			}
+			if x > g.max {
+				x = g.max
+			} else if x < -1 {
+				x = -1
+			}
+			samples[i*channels+c] = float32(x)
+		}
+	}
+	if clipped > 0 {
+		g.mu.Lock()
+		g.clipped += clipped
+		g.mu.Unlock()
+	}
+}
+
+// softKnee is the level above which SoftClipSample compresses samples (about -2.5 dBFS).
+const softKnee = 0.75
+
+// SoftClipSample limits x to [-1, 1] smoothly.
+//
+// It returns x as is if |x| <= 0.75, and compresses the part above it with tanh,
+// so that the curve has no corners.
+func SoftClipSample(x float64) float64 {
+	a := math.Abs(x)
+	if a <= softKnee {
+		return x
+	}
+	y := softKnee + (1-softKnee)*math.Tanh((a-softKnee)/(1-softKnee))
+	return math.Copysign(y, x)
+}
+
+// SetClipping sets how to limit samples that exceed full scale (default: HardClip).
+func (g *Gain) SetClipping(c Clipping) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.clipping = c
+}
+
+// Clipped returns the number of samples that exceeded full scale after applying the gain
+// (they are limited whether soft clipping is enabled or not).
+func (g *Gain) Clipped() uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.clipped
+}
+
+// Func returns the function for Filter.Func.
+//
+// The function must not be called concurrently
+// (it can not be used with Filter.Workers more than 1).
+func (g *Gain) Func() func(b []byte) {
+	return g.fn
+}
+
+// SetVolume ramps the volume to volume (or keeps silence until Unmute if muted).
+func (g *Gain) SetVolume(volume float64) error {
+	if err := checkVolume(volume); err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.volume = volume
+	if !g.muted {
+		g.param.Set(volume)
+	}
+	return nil
+}
+
+// Volume returns the volume set by NewGain or SetVolume (regardless of Mute).
+func (g *Gain) Volume() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.volume
+}
+
+// SetDB ramps the volume to db decibels (e.g. -6 halves the amplitude).
+func (g *Gain) SetDB(db float64) error {
+	return g.SetVolume(FromDB(db))
+}
+
+// DB returns the volume in decibels (-Inf if the volume is 0).
+func (g *Gain) DB() float64 {
+	return ToDB(g.Volume())
+}
+
+// FromDB converts db decibels into a linear gain.
+func FromDB(db float64) float64 {
+	return math.Pow(10, db/20)
+}
+
+// ToDB converts a linear gain into decibels.
+func ToDB(volume float64) float64 {
+	return 20 * math.Log10(volume)
+}
+
+// Mute fades out to silence.
+func (g *Gain) Mute() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.muted = true
+	g.param.Set(0)
+}
+
+// Unmute fades in to the volume.
+func (g *Gain) Unmute() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.muted = false
+	g.param.Set(g.volume)
+}
+
+// IsMuted returns whether g is muted.
+func (g *Gain) IsMuted() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.muted
+}
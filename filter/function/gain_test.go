@@ -0,0 +1,201 @@
+package function_test
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ebiiim/eq/filter/function"
+	"github.com/ebiiim/eq/pcm"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGain(t *testing.T) {
+	// 2ch, 1 frame per millisecond
+	format := pcm.Format{Channels: 2, SampleRate: 1000, BitDepth: 16, Encoding: pcm.Signed, ByteOrder: binary.LittleEndian}
+	frames := func(vs ...int16) []byte {
+		b := make([]byte, 4*len(vs))
+		for i, v := range vs {
+			binary.LittleEndian.PutUint16(b[4*i:], uint16(v))
+			binary.LittleEndian.PutUint16(b[4*i+2:], uint16(-v))
+		}
+		return b
+	}
+	ones := frames(1000, 1000, 1000, 1000, 1000)
+
+	cases := []struct {
+		name   string
+		change func(g *function.Gain)
+		want   []byte
+	}{
+		{"keep", func(g *function.Gain) {}, frames(1000, 1000, 1000, 1000, 1000)},
+		{"set", func(g *function.Gain) { g.SetVolume(0.5) }, frames(875, 750, 625, 500, 500)},
+		{"mute", func(g *function.Gain) { g.Mute() }, frames(750, 500, 250, 0, 0)},
+		{"set_muted", func(g *function.Gain) { g.Mute(); g.SetVolume(2) }, frames(750, 500, 250, 0, 0)},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			g, err := function.NewGain(format, 1, 4*time.Millisecond)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.change(g)
+			got := append([]byte{}, ones...)
+			g.Func()(got)
+			if diff := cmp.Diff(c.want, got); diff != "" {
+				t.Errorf("(-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGain_SetVolume(t *testing.T) {
+	cases := []struct {
+		name   string
+		volume float64
+		isErr  bool
+	}{
+		{"zero", 0, false},
+		{"1.5", 1.5, false},
+		{"F_negative", -1, true},
+		{"F_nan", math.NaN(), true},
+		{"F_inf", math.Inf(1), true},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := function.NewGain(pcm.Default, c.volume, 0)
+			if !((err != nil) == c.isErr) {
+				t.Errorf("NewGain: got %v, want %v(isErr) ", err, c.isErr)
+			}
+			g, err := function.NewGain(pcm.Default, 1, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = g.SetVolume(c.volume)
+			if !((err != nil) == c.isErr) {
+				t.Errorf("SetVolume: got %v, want %v(isErr) ", err, c.isErr)
+			}
+			if c.isErr && g.Volume() != 1 {
+				t.Errorf("got volume %v want 1 (unchanged)", g.Volume())
+			}
+		})
+	}
+}
+
+func TestGain_Unmute(t *testing.T) {
+	g, err := function.NewGain(pcm.Default, 0.5, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Mute()
+	err = g.SetVolume(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !g.IsMuted() || g.Volume() != 2 {
+		t.Errorf("got muted %v volume %v want true and 2", g.IsMuted(), g.Volume())
+	}
+	b := []byte{10, 0, 20, 0}
+	g.Func()(b)
+	if diff := cmp.Diff([]byte{0, 0, 0, 0}, b); diff != "" {
+		t.Errorf("muted (-want +got)\n%s", diff)
+	}
+	g.Unmute()
+	b = []byte{10, 0, 20, 0}
+	g.Func()(b)
+	if diff := cmp.Diff([]byte{20, 0, 40, 0}, b); diff != "" {
+		t.Errorf("unmuted (-want +got)\n%s", diff)
+	}
+
+	if err := g.SetVolume(-1); err == nil {
+		t.Errorf("got nil want an error for a negative volume")
+	}
+	if _, err := function.NewGain(pcm.Format{}, 1, 0); err == nil {
+		t.Errorf("got nil want an error for an invalid format")
+	}
+}
+
+func TestGain_Clipping(t *testing.T) {
+	in := []int16{16384, -16384, 8192, -32768} // 0.5, -0.5, 0.25, -1
+	cases := []struct {
+		name     string
+		format   pcm.Format
+		clipping function.Clipping
+		db       float64
+		want     []float64
+		clipped  uint64
+	}{
+		{"hard", pcm.Default, function.HardClip, 6.0206, []float64{32767.0 / 32768, -1, 0.5, -1}, 3},
+		{"soft", pcm.Default, function.SoftClip, 6.0206, []float64{0.94, -0.94, 0.5, -1}, 3},
+		{"no_clip", pcm.Default, function.SoftClip, 0, []float64{0.5, -0.5, 0.25, -0.94}, 0},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			g, err := function.NewGain(c.format, 1, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g.SetClipping(c.clipping)
+			err = g.SetDB(c.db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := make([]byte, 2*len(in))
+			for i, v := range in {
+				binary.LittleEndian.PutUint16(b[2*i:], uint16(v))
+			}
+			g.Func()(b)
+			for i, want := range c.want {
+				got := float64(int16(binary.LittleEndian.Uint16(b[2*i:]))) / 32768
+				if got > want+0.01 || got < want-0.01 {
+					t.Errorf("sample %d: got %v want %v", i, got, want)
+				}
+			}
+			if g.Clipped() != c.clipped {
+				t.Errorf("got %d clipped samples want %d", g.Clipped(), c.clipped)
+			}
+		})
+	}
+}
+
+func TestSoftClipSample(t *testing.T) {
+	prev := -10.0
+	for x := -10.0; x <= 10; x += 0.01 {
+		y := function.SoftClipSample(x)
+		if y < -1 || y > 1 {
+			t.Fatalf("got %v for %v want in [-1, 1]", y, x)
+		}
+		if y < prev {
+			t.Fatalf("got %v for %v want >= %v (monotonic)", y, x, prev)
+		}
+		prev = y
+	}
+	if y := function.SoftClipSample(0.5); y != 0.5 {
+		t.Errorf("got %v want 0.5 (below the knee)", y)
+	}
+}
+
+func TestDB(t *testing.T) {
+	cases := []struct {
+		db, volume float64
+	}{
+		{0, 1},
+		{20, 10},
+		{-40, 0.01},
+	}
+	for _, c := range cases {
+		if got := function.FromDB(c.db); math.Abs(got-c.volume) > 1e-9 {
+			t.Errorf("FromDB(%v): got %v want %v", c.db, got, c.volume)
+		}
+		if got := function.ToDB(c.volume); math.Abs(got-c.db) > 1e-9 {
+			t.Errorf("ToDB(%v): got %v want %v", c.volume, got, c.db)
+		}
+	}
+}
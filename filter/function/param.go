@@ -0,0 +1,104 @@
+package function
+
+import (
+	"sync"
+	"time"
+)
+
+// Param is a parameter of a filter function (e.g. gain or frequency) that can be changed while playing.
+//
+// Set does not change the value at once but ramps it linearly to the new value
+// over the ramp time, so that changes do not cause clicks (zipper noise).
+// The filter function reads the value of each sample with Next or Fill.
+//
+// The zero value is a parameter of 0 that changes immediately.
+// Param is safe for concurrent use.
+type Param struct {
+	mu     sync.Mutex
+	ramp   time.Duration
+	value  float64
+	target float64
+	start  bool    // a ramp to target is not started yet
+	step   float64 // the change per sample
+	left   int     // samples until value reaches target
+}
+
+// NewParam returns a Param of value that ramps to new values over ramp.
+func NewParam(value float64, ramp time.Duration) *Param {
+	return &Param{ramp: ramp, value: value, target: value}
+}
+
+// SetRamp sets the ramp time used by the next Set.
+func (p *Param) SetRamp(ramp time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ramp = ramp
+}
+
+// Set starts ramping the value to v from the current value.
+func (p *Param) Set(v float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.target = v
+	p.start = true
+}
+
+// Reset changes the value to v immediately.
+func (p *Param) Reset(v float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.value, p.target = v, v
+	p.start, p.left = false, 0
+}
+
+// Target returns the value that p is ramping to (or the current value if not ramping).
+func (p *Param) Target() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.target
+}
+
+// Value returns the current value.
+func (p *Param) Value() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.value
+}
+
+// Next advances p by a sample at sampleRate and returns the value of the sample.
+func (p *Param) Next(sampleRate int) float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.next(sampleRate)
+}
+
+// Fill is the same as calling Next len(dst) times (but faster).
+//
+// Filter functions should call it once per chunk with a frame per element.
+func (p *Param) Fill(dst []float64, sampleRate int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := range dst {
+		dst[i] = p.next(sampleRate)
+	}
+}
+
+func (p *Param) next(sampleRate int) float64 {
+	if p.start {
+		p.start = false
+		p.left = int(p.ramp.Seconds() * float64(sampleRate))
+		if p.left > 0 {
+			p.step = (p.target - p.value) / float64(p.left)
+		} else {
+			p.value = p.target
+		}
+	}
+	if p.left > 0 {
+		p.left--
+		p.value += p.step
+		if p.left == 0 {
+			p.value = p.target // no rounding errors
+		}
+	}
+	return p.value
+}
@@ -0,0 +1,56 @@
+package function_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ebiiim/eq/filter/function"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParam(t *testing.T) {
+	cases := []struct {
+		name string
+		ramp time.Duration
+		set  func(p *function.Param)
+		n    int
+		want []float64
+	}{
+		{"no_change", 4 * time.Millisecond, func(p *function.Param) {}, 3, []float64{1, 1, 1}},
+		{"ramp", 4 * time.Millisecond, func(p *function.Param) { p.Set(0) }, 6, []float64{0.75, 0.5, 0.25, 0, 0, 0}},
+		{"no_ramp", 0, func(p *function.Param) { p.Set(3) }, 2, []float64{3, 3}},
+		{"reset", 4 * time.Millisecond, func(p *function.Param) { p.Set(0); p.Reset(2) }, 2, []float64{2, 2}},
+		{"set_ramp", 4 * time.Millisecond, func(p *function.Param) { p.SetRamp(2 * time.Millisecond); p.Set(0) }, 3, []float64{0.5, 0, 0}},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			p := function.NewParam(1, c.ramp)
+			c.set(p)
+			got := make([]float64, c.n)
+			p.Fill(got, 1000) // 1 sample per millisecond
+			if diff := cmp.Diff(c.want, got); diff != "" {
+				t.Errorf("(-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParam_Retarget(t *testing.T) {
+	p := function.NewParam(0, 4*time.Millisecond)
+	p.Set(4)
+	p.Next(1000) // 1
+	p.Next(1000) // 2
+	p.Set(0)     // ramps from 2
+	if p.Target() != 0 || p.Value() != 2 {
+		t.Errorf("got target %v value %v want 0 and 2", p.Target(), p.Value())
+	}
+	var got []float64
+	for i := 0; i < 5; i++ {
+		got = append(got, p.Next(1000))
+	}
+	if diff := cmp.Diff([]float64{1.5, 1, 0.5, 0, 0}, got); diff != "" {
+		t.Errorf("(-want +got)\n%s", diff)
+	}
+}
@@ -0,0 +1,69 @@
+package function
+
+import (
+	"github.com/ebiiim/eq/pcm"
+	"github.com/pkg/errors"
+)
+
+// InterleavedFunc processes interleaved samples in [-1, 1]
+// (samples[i*channels+c] is the i-th sample of channel c).
+//
+// The function modifies samples in place.
+type InterleavedFunc func(samples []float32, channels, sampleRate int)
+
+// DeinterleavedFunc processes the samples in [-1, 1] of each channel
+// (samples[c][i] is the i-th sample of channel c).
+//
+// The function modifies samples in place.
+type DeinterleavedFunc func(samples [][]float32, sampleRate int)
+
+// Interleaved returns a function for Filter.Func that decodes data in format into float32 samples,
+// calls fn with them, and encodes the result back into format (values out of [-1, 1] are clipped).
+//
+// format must be valid, and should also be set to Filter.Format.
+// A partial frame at the end of data is passed through unchanged,
+// which does not happen if Filter.Format is set (see Filter.Frames).
+// The returned function reuses its buffers, so it must not be called concurrently
+// (it can not be used with Filter.Workers more than 1).
+func Interleaved(format pcm.Format, fn InterleavedFunc) (func(b []byte), error) {
+	if err := format.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid format")
+	}
+	var buf []float32
+	return func(b []byte) {
+		n := len(b) / format.FrameSize() * format.Channels
+		if cap(buf) < n {
+			buf = make([]float32, n)
+		}
+		buf = buf[:n]
+		format.Decode(buf, b)
+		fn(buf, format.Channels, format.SampleRate)
+		format.Encode(b, buf)
+	}, nil
+}
+
+// Deinterleaved is the same as Interleaved except that fn receives the samples of each channel.
+func Deinterleaved(format pcm.Format, fn DeinterleavedFunc) (func(b []byte), error) {
+	if err := format.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid format")
+	}
+	chs := make([][]float32, format.Channels)
+	return Interleaved(format, func(samples []float32, channels, sampleRate int) {
+		frames := len(samples) / channels
+		for c := range chs {
+			if cap(chs[c]) < frames {
+				chs[c] = make([]float32, frames)
+			}
+			chs[c] = chs[c][:frames]
+			for i := range chs[c] {
+				chs[c][i] = samples[i*channels+c]
+			}
+		}
+		fn(chs, sampleRate)
+		for c := range chs {
+			for i, v := range chs[c] {
+				samples[i*channels+c] = v
+			}
+		}
+	})
+}
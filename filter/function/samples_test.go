@@ -0,0 +1,79 @@
+package function_test
+
+import (
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/ebiiim/eq/filter/function"
+	"github.com/ebiiim/eq/pcm"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestInterleaved(t *testing.T) {
+	s24 := pcm.Format{Channels: 2, SampleRate: 44100, BitDepth: 24, Encoding: pcm.Signed, ByteOrder: binary.LittleEndian}
+	fn, err := function.Interleaved(s24, func(samples []float32, channels, sampleRate int) {
+		if channels != 2 || sampleRate != 44100 {
+			t.Errorf("got %dch %dHz want 2ch 44100Hz", channels, sampleRate)
+		}
+		for i := range samples {
+			samples[i] *= 0.5
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &function.Filter{ChunkSize: 6, Format: s24}
+	f.Func.Set(fn)
+	defer f.Close()
+
+	_, err = f.Write([]byte{0x00, 0x00, 0x40, 0x00, 0x00, 0xc0})
+	if err != nil {
+		t.Fatalf("could not write: %v", err)
+	}
+	got := make([]byte, 6)
+	_, err = io.ReadFull(f, got)
+	if err != nil {
+		t.Fatalf("could not read: %v", err)
+	}
+	if diff := cmp.Diff([]byte{0x00, 0x00, 0x20, 0x00, 0x00, 0xe0}, got); diff != "" {
+		t.Errorf("(-want +got)\n%s", diff)
+	}
+}
+
+func TestInterleaved_FloatClip(t *testing.T) {
+	f32 := pcm.Format{Channels: 1, SampleRate: 48000, BitDepth: 32, Encoding: pcm.Float, ByteOrder: binary.LittleEndian}
+	fn, err := function.Interleaved(f32, func(samples []float32, channels, sampleRate int) {
+		for i := range samples {
+			samples[i] *= 4
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := []byte{0x00, 0x00, 0x00, 0x3f, 0x00, 0x00, 0x00, 0xbf} // 0.5, -0.5
+	fn(b)
+	if diff := cmp.Diff([]byte{0x00, 0x00, 0x80, 0x3f, 0x00, 0x00, 0x80, 0xbf}, b); diff != "" { // 1, -1
+		t.Errorf("(-want +got)\n%s", diff)
+	}
+}
+
+func TestDeinterleaved(t *testing.T) {
+	// swaps the channels
+	fn, err := function.Deinterleaved(pcm.Default, func(samples [][]float32, sampleRate int) {
+		samples[0], samples[1] = samples[1], samples[0]
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := []byte{1, 0, 2, 0, 3, 0, 4, 0, 9} // with a partial frame
+	fn(b)
+	if diff := cmp.Diff([]byte{2, 0, 1, 0, 4, 0, 3, 0, 9}, b); diff != "" {
+		t.Errorf("(-want +got)\n%s", diff)
+	}
+
+	_, err = function.Deinterleaved(pcm.Format{}, nil)
+	if err == nil {
+		t.Errorf("got nil want an error for an invalid format")
+	}
+}
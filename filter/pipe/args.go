@@ -0,0 +1,93 @@
+package pipe
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SplitCommand splits a command line into an argv slice
+// following the quoting rules of POSIX shells.
+//
+// Arguments are separated by spaces, tabs and newlines.
+// Characters in single quotes are taken literally,
+// a backslash in double quotes escapes only $ ` " \ and a newline,
+// and a backslash outside quotes escapes any character.
+// Other shell features (e.g. variables, globs and redirections) are not supported.
+func SplitCommand(s string) ([]string, error) {
+	var (
+		args  []string
+		arg   strings.Builder
+		inArg bool // true if arg is started (may be empty, e.g. '')
+		quote rune // '\'', '"' or 0
+		esc   bool
+	)
+	for _, c := range s {
+		switch {
+		case esc:
+			if quote == '"' && !strings.ContainsRune("$`\"\\\n", c) {
+				arg.WriteRune('\\')
+			}
+			if c != '\n' { // a backslash-newline is a line continuation
+				arg.WriteRune(c)
+			}
+			esc = false
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(c)
+			}
+		case c == '\\':
+			esc, inArg = true, true
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				arg.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote, inArg = c, true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inArg = true
+		}
+	}
+	if esc {
+		return nil, errors.New("unexpected end of command after backslash")
+	}
+	if quote != 0 {
+		return nil, errors.Errorf("unterminated quote %c", quote)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// JoinCommand joins args into a command line that SplitCommand splits into args.
+//
+// Arguments that contain special characters are single-quoted.
+func JoinCommand(args []string) string {
+	ss := make([]string, len(args))
+	for i, a := range args {
+		ss[i] = quote(a)
+	}
+	return strings.Join(ss, " ")
+}
+
+func quote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if !strings.ContainsAny(s, " \t\n'\"\\$`;&|<>()*?[]#~{}!") {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,74 @@
+package pipe_test
+
+import (
+	"testing"
+
+	"github.com/ebiiim/eq/filter/pipe"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSplitCommand(t *testing.T) {
+	cases := []struct {
+		name  string
+		s     string
+		want  []string
+		isErr bool
+	}{
+		{"simple", "tee -i /dev/null", []string{"tee", "-i", "/dev/null"}, false},
+		{"spaces", "  tee \t -i\n/dev/null  ", []string{"tee", "-i", "/dev/null"}, false},
+		{"empty", "", nil, false},
+		{"single_quote", `cat '/tmp/a b' 'it''s'`, []string{"cat", "/tmp/a b", "its"}, false},
+		{"single_quote_literal", `echo '$x \n "y"'`, []string{"echo", `$x \n "y"`}, false},
+		{"double_quote", `echo "a 'b' \"c\" \$d \e"`, []string{"echo", `a 'b' "c" $d \e`}, false},
+		{"empty_arg", `echo '' ""`, []string{"echo", "", ""}, false},
+		{"backslash", `echo a\ b \'c`, []string{"echo", "a b", "'c"}, false},
+		{"continuation", "echo a\\\nb", []string{"echo", "ab"}, false},
+		{"concat", `a"b c"'d'e`, []string{"ab cde"}, false},
+		{"F_single_quote", `echo 'a`, nil, true},
+		{"F_double_quote", `echo "a`, nil, true},
+		{"F_backslash", `echo a\`, nil, true},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := pipe.SplitCommand(c.s)
+			if !((err != nil) == c.isErr) {
+				t.Errorf("got %v, want %v(isErr) ", err, c.isErr)
+			}
+			if diff := cmp.Diff(c.want, got); diff != "" {
+				t.Errorf("(-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestJoinCommand(t *testing.T) {
+	cases := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"simple", []string{"tee", "-i", "/dev/null"}, "tee -i /dev/null"},
+		{"spaces", []string{"cat", "/tmp/a b"}, "cat '/tmp/a b'"},
+		{"quotes", []string{"echo", `it's "x"`}, `echo 'it'\''s "x"'`},
+		{"empty", []string{"echo", ""}, "echo ''"},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			got := pipe.JoinCommand(c.args)
+			if got != c.want {
+				t.Errorf("got %v want %v", got, c.want)
+			}
+			args, err := pipe.SplitCommand(got)
+			if err != nil {
+				t.Fatalf("could not split: %v", err)
+			}
+			if diff := cmp.Diff(c.args, args); diff != "" {
+				t.Errorf("round trip (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Package ffmpeg provides a command generator of FFmpeg
+// focusing on working with filter.Pipe or any other object that wraps exec.Command.
+//
+// The command reads raw PCM from stdin, applies an audio filtergraph (-af),
+// and writes raw PCM to stdout.
+package ffmpeg
+
+import (
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ebiiim/eq/filter/pipe"
+	"github.com/ebiiim/eq/pcm"
+	"github.com/pkg/errors"
+)
+
+// Command struct holds FFmpeg options.
+type Command struct {
+	initOnce sync.Once
+
+	// ExecPath is the path of ffmpeg (default: "ffmpeg").
+	ExecPath string
+
+	// InFormat and OutFormat are the formats of the raw PCM streams (default: pcm.Default).
+	//
+	// The sample rate and channels are converted by FFmpeg if they differ.
+	InFormat, OutFormat pcm.Format
+
+	// Filters are joined with "," into the filtergraph.
+	Filters []Filter
+}
+
+// String convert the Command object to an executable ffmpeg command.
+//
+// Arguments are quoted if needed (see pipe.SplitCommand).
+func (c *Command) String() string {
+	return pipe.JoinCommand(c.Args())
+}
+
+// Args convert the Command object to the execPath and args of an ffmpeg command,
+// which can be passed to pipe.Filter.Args directly.
+//
+// Args does not validate the formats (an invalid one results in an empty -f option);
+// use Validate, SetInputFormat or SetOutputFormat to check them.
+// pipe.Filter also refuses to start with invalid InFormat and OutFormat.
+func (c *Command) Args() []string {
+	c.initOnce.Do(c.setDefaults)
+
+	args := []string{c.ExecPath, "-hide_banner", "-loglevel", "error"}
+	args = append(args, fmtArgs(c.InFormat)...)
+	args = append(args, "-i", "pipe:0")
+	if len(c.Filters) > 0 {
+		fs := make([]string, len(c.Filters))
+		for i, f := range c.Filters {
+			fs[i] = string(f)
+		}
+		args = append(args, "-af", strings.Join(fs, ","))
+	}
+	args = append(args, fmtArgs(c.OutFormat)...)
+	args = append(args, "-flush_packets", "1", "pipe:1") // write each packet without buffering
+	return args
+}
+
+// Validate returns an error if InFormat or OutFormat is not supported by Command.
+func (c *Command) Validate() error {
+	c.initOnce.Do(c.setDefaults)
+	if _, err := formatName(c.InFormat); err != nil {
+		return errors.Wrap(err, "invalid input format")
+	}
+	if _, err := formatName(c.OutFormat); err != nil {
+		return errors.Wrap(err, "invalid output format")
+	}
+	return nil
+}
+
+// fmtArgs returns format options of a raw PCM stream.
+func fmtArgs(f pcm.Format) []string {
+	name, _ := formatName(f)
+	return []string{"-f", name, "-ar", strconv.Itoa(f.SampleRate), "-ac", strconv.Itoa(f.Channels)}
+}
+
+// formatName returns the name of the raw PCM format of FFmpeg (e.g. "s16le").
+func formatName(f pcm.Format) (string, error) {
+	if err := f.Validate(); err != nil {
+		return "", err
+	}
+	var name string
+	switch f.Encoding {
+	case pcm.Signed:
+		name = "s"
+	case pcm.Unsigned:
+		name = "u"
+	case pcm.Float:
+		name = "f"
+	}
+	name += strconv.Itoa(f.BitDepth)
+	if f.BitDepth == 8 {
+		return name, nil
+	}
+	if f.ByteOrder.String() == binary.BigEndian.String() {
+		return name + "be", nil
+	}
+	return name + "le", nil
+}
+
+func (c *Command) setDefaults() {
+	if c.ExecPath == "" {
+		c.ExecPath = "ffmpeg"
+	}
+	if c.InFormat.IsZero() {
+		c.InFormat = pcm.Default
+	}
+	if c.OutFormat.IsZero() {
+		c.OutFormat = pcm.Default
+	}
+}
+
+// InputFormat returns the format of the stream that the command reads.
+func (c *Command) InputFormat() pcm.Format {
+	c.initOnce.Do(c.setDefaults)
+	return c.InFormat
+}
+
+// OutputFormat returns the format of the stream that the command writes.
+func (c *Command) OutputFormat() pcm.Format {
+	c.initOnce.Do(c.setDefaults)
+	return c.OutFormat
+}
+
+// SetInputFormat sets the input format to f.
+func (c *Command) SetInputFormat(f pcm.Format) error {
+	if _, err := formatName(f); err != nil {
+		return errors.Wrap(err, "invalid input format")
+	}
+	c.InFormat = f
+	return nil
+}
+
+// SetOutputFormat sets the output format to f.
+func (c *Command) SetOutputFormat(f pcm.Format) error {
+	if _, err := formatName(f); err != nil {
+		return errors.Wrap(err, "invalid output format")
+	}
+	c.OutFormat = f
+	return nil
+}
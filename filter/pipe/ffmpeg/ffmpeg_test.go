@@ -0,0 +1,219 @@
+package ffmpeg_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ebiiim/eq/filter/pipe"
+	"github.com/ebiiim/eq/filter/pipe/ffmpeg"
+	"github.com/ebiiim/eq/pcm"
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+func TestCommand_Args(t *testing.T) {
+	eq, _ := ffmpeg.NewEqualizer(1000, 5, -3)
+	hp, _ := ffmpeg.NewHighpass(80, 0.707)
+	cases := []struct {
+		name string
+		cmd  *ffmpeg.Command
+		want []string
+	}{
+		{"default", &ffmpeg.Command{}, []string{"ffmpeg", "-hide_banner", "-loglevel", "error",
+			"-f", "s16le", "-ar", "48000", "-ac", "2", "-i", "pipe:0",
+			"-f", "s16le", "-ar", "48000", "-ac", "2", "-flush_packets", "1", "pipe:1"}},
+		{"filters", &ffmpeg.Command{ExecPath: "/opt/ffmpeg", Filters: []ffmpeg.Filter{eq, hp}}, []string{"/opt/ffmpeg", "-hide_banner", "-loglevel", "error",
+			"-f", "s16le", "-ar", "48000", "-ac", "2", "-i", "pipe:0",
+			"-af", "equalizer=f=1000:t=q:w=5.000:g=-3.000,highpass=f=80:t=q:w=0.707",
+			"-f", "s16le", "-ar", "48000", "-ac", "2", "-flush_packets", "1", "pipe:1"}},
+		{"formats", &ffmpeg.Command{
+			InFormat:  pcm.Format{Channels: 1, SampleRate: 44100, BitDepth: 24, Encoding: pcm.Signed, ByteOrder: binary.BigEndian},
+			OutFormat: pcm.Format{Channels: 2, SampleRate: 96000, BitDepth: 32, Encoding: pcm.Float, ByteOrder: binary.LittleEndian},
+		}, []string{"ffmpeg", "-hide_banner", "-loglevel", "error",
+			"-f", "s24be", "-ar", "44100", "-ac", "1", "-i", "pipe:0",
+			"-f", "f32le", "-ar", "96000", "-ac", "2", "-flush_packets", "1", "pipe:1"}},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			got := c.cmd.Args()
+			if diff := cmp.Diff(c.want, got); diff != "" {
+				t.Errorf("(-want +got)\n%s", diff)
+			}
+			split, err := pipe.SplitCommand(c.cmd.String())
+			if err != nil {
+				t.Fatalf("could not split String(): %v", err)
+			}
+			if diff := cmp.Diff(got, split); diff != "" {
+				t.Errorf("String() does not match Args() (-Args +String)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCommand_SetInputFormat(t *testing.T) {
+	cases := []struct {
+		name   string
+		format pcm.Format
+		want   string
+		isErr  bool
+	}{
+		{"u8_mono", pcm.Format{Channels: 1, SampleRate: 8000, BitDepth: 8, Encoding: pcm.Unsigned}, "u8", false},
+		{"f64be", pcm.Format{Channels: 2, SampleRate: 48000, BitDepth: 64, Encoding: pcm.Float, ByteOrder: binary.BigEndian}, "f64be", false},
+		{"F_invalid", pcm.Format{}, "", true},
+		{"F_float16", pcm.Format{Channels: 2, SampleRate: 48000, BitDepth: 16, Encoding: pcm.Float, ByteOrder: binary.LittleEndian}, "", true},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			cmd := &ffmpeg.Command{}
+			err := cmd.SetInputFormat(c.format)
+			if !((err != nil) == c.isErr) {
+				t.Errorf("got %v, want %v(isErr) ", err, c.isErr)
+			}
+			if c.isErr {
+				return
+			}
+			if got := cmd.Args()[5]; got != c.want {
+				t.Errorf("got %v want %v", got, c.want)
+			}
+			if !cmd.InputFormat().Equal(c.format) {
+				t.Errorf("got %v want %v", cmd.InputFormat(), c.format)
+			}
+		})
+	}
+}
+
+func TestCommand_Validate(t *testing.T) {
+	float16 := pcm.Format{Channels: 2, SampleRate: 48000, BitDepth: 16, Encoding: pcm.Float, ByteOrder: binary.LittleEndian}
+	cases := []struct {
+		name  string
+		cmd   *ffmpeg.Command
+		isErr bool
+	}{
+		{"default", &ffmpeg.Command{}, false},
+		{"F_input", &ffmpeg.Command{InFormat: float16}, true},
+		{"F_output", &ffmpeg.Command{OutFormat: pcm.Format{SampleRate: 48000, BitDepth: 16, Encoding: pcm.Signed}}, true},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			err := c.cmd.Validate()
+			if !((err != nil) == c.isErr) {
+				t.Errorf("got %v, want %v(isErr) ", err, c.isErr)
+			}
+			if !c.isErr {
+				return
+			}
+			// pipe.Filter refuses invalid formats instead of passing "-f ''" to ffmpeg
+			f := &pipe.Filter{Args: c.cmd.Args(), InFormat: c.cmd.InputFormat(), OutFormat: c.cmd.OutputFormat()}
+			defer f.Close()
+			if err := f.Start(); err == nil {
+				t.Errorf("started with invalid formats: %v", c.cmd)
+			}
+		})
+	}
+}
+
+func TestNewFilters(t *testing.T) {
+	cases := []struct {
+		name  string
+		fn    func() (ffmpeg.Filter, error)
+		want  string
+		isErr bool
+	}{
+		{"volume", func() (ffmpeg.Filter, error) { return ffmpeg.NewVolume(-3) }, "volume=-3.000dB", false},
+		{"volume_nan", func() (ffmpeg.Filter, error) { return ffmpeg.NewVolume(math.NaN()) }, "", true},
+		{"volume_inf", func() (ffmpeg.Filter, error) { return ffmpeg.NewVolume(math.Inf(1)) }, "", true},
+		{"equalizer", func() (ffmpeg.Filter, error) { return ffmpeg.NewEqualizer(1000, 5, -3) }, "equalizer=f=1000:t=q:w=5.000:g=-3.000", false},
+		{"equalizer_freq", func() (ffmpeg.Filter, error) { return ffmpeg.NewEqualizer(0, 5, -3) }, "", true},
+		{"equalizer_q", func() (ffmpeg.Filter, error) { return ffmpeg.NewEqualizer(1000, 0, -3) }, "", true},
+		{"equalizer_gain", func() (ffmpeg.Filter, error) { return ffmpeg.NewEqualizer(1000, 5, 61) }, "", true},
+		{"bass", func() (ffmpeg.Filter, error) { return ffmpeg.NewBass(3, 100) }, "bass=f=100:g=3.000", false},
+		{"treble_gain", func() (ffmpeg.Filter, error) { return ffmpeg.NewTreble(-61, 3000) }, "", true},
+		{"lowpass", func() (ffmpeg.Filter, error) { return ffmpeg.NewLowpass(8000, 0.707) }, "lowpass=f=8000:t=q:w=0.707", false},
+		{"highpass_freq", func() (ffmpeg.Filter, error) { return ffmpeg.NewHighpass(0, 0.707) }, "", true},
+		{"loudnorm", func() (ffmpeg.Filter, error) { return ffmpeg.NewLoudnorm(-16, 11, -1.5) }, "loudnorm=I=-16.0:LRA=11.0:TP=-1.5", false},
+		{"loudnorm_tp", func() (ffmpeg.Filter, error) { return ffmpeg.NewLoudnorm(-16, 11, 1) }, "", true},
+		{"acompressor", func() (ffmpeg.Filter, error) {
+			return ffmpeg.NewAcompressor(-20, 4, 20*time.Millisecond, 250*time.Millisecond, 0)
+		}, "acompressor=threshold=-20.000dB:ratio=4.000:attack=20.000:release=250.000:makeup=0.000dB", false},
+		{"acompressor_ratio", func() (ffmpeg.Filter, error) {
+			return ffmpeg.NewAcompressor(-20, 0.5, 20*time.Millisecond, 250*time.Millisecond, 0)
+		}, "", true},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := c.fn()
+			if !((err != nil) == c.isErr) {
+				t.Errorf("got %v, want %v(isErr) ", err, c.isErr)
+			}
+			if c.isErr {
+				if errors.Cause(err) != ffmpeg.ErrInvalidFilter {
+					t.Errorf("got %v want %v", err, ffmpeg.ErrInvalidFilter)
+				}
+				return
+			}
+			if string(got) != c.want {
+				t.Errorf("got %v want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestCommand_Pipe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ffmpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// a stub that checks the options of the filtergraph and passes data through
+	stub := filepath.Join(dir, "ffmpeg")
+	script := "#!/bin/sh\nfor a in \"$@\"; do [ \"$prev\" = -af ] && af=$a; prev=$a; done\n[ \"$af\" = volume=-3.000dB ] || { echo \"bad -af $af\" >&2; exit 1; }\nexec cat\n"
+	err = ioutil.WriteFile(stub, []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vol, err := ffmpeg.NewVolume(-3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := &ffmpeg.Command{ExecPath: stub, Filters: []ffmpeg.Filter{vol}}
+	f := &pipe.Filter{Args: cmd.Args(), InFormat: cmd.InputFormat(), OutFormat: cmd.OutputFormat()}
+	defer f.Close()
+
+	in := []byte("abcdefgh")
+	_, err = f.Write(in)
+	if err != nil {
+		t.Fatalf("could not write: %v", err)
+	}
+	err = f.CloseWrite()
+	if err != nil {
+		t.Fatalf("could not close write: %v", err)
+	}
+	out := &bytes.Buffer{}
+	_, err = io.Copy(out, f)
+	if err != nil {
+		t.Fatalf("could not read: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), in) {
+		t.Errorf("got %q want %q", out.Bytes(), in)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Errorf("could not close: %v", err)
+	}
+}
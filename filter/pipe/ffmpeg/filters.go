@@ -0,0 +1,128 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ebiiim/eq/internal/param"
+	"github.com/pkg/errors"
+)
+
+// Filter is an FFmpeg audio filter that can be used with Command.
+type Filter string
+
+// ErrInvalidFilter is returned by filter constructors for parameters that FFmpeg rejects.
+var ErrInvalidFilter = errors.New("invalid filter parameter")
+
+// NewVolume returns a volume filter (e.g. "volume=-3.000dB").
+//
+// gain is in dB and must be finite.
+func NewVolume(gain float64) (Filter, error) {
+	const name = "volume"
+	if err := param.Finite(ErrInvalidFilter, name, "gain", gain); err != nil {
+		return "", err
+	}
+	return Filter(fmt.Sprintf("%s=%.3fdB", name, gain)), nil
+}
+
+// NewEqualizer returns a peaking equalizer filter (e.g. "equalizer=f=1000:t=q:w=5.000:g=-3.000").
+//
+// freq is the center frequency in Hz, q is 0.001 to 1000 and gain is in dB (-60 to 60).
+func NewEqualizer(freq uint, q float64, gain float64) (Filter, error) {
+	const name = "equalizer"
+	err := param.FirstErr(
+		param.InRange(ErrInvalidFilter, name, "freq", float64(freq), 1, 999999),
+		param.InRange(ErrInvalidFilter, name, "q", q, 0.001, 1000),
+		param.InRange(ErrInvalidFilter, name, "gain", gain, -60, 60),
+	)
+	if err != nil {
+		return "", err
+	}
+	return Filter(fmt.Sprintf("%s=f=%d:t=q:w=%.3f:g=%.3f", name, freq, q, gain)), nil
+}
+
+// NewBass returns a bass shelving filter (e.g. "bass=f=100:g=3.000").
+//
+// gain is in dB (-60 to 60) and freq is the center frequency in Hz.
+func NewBass(gain float64, freq uint) (Filter, error) {
+	return shelf("bass", gain, freq)
+}
+
+// NewTreble returns a treble shelving filter (e.g. "treble=f=3000:g=-3.000").
+//
+// gain is in dB (-60 to 60) and freq is the center frequency in Hz.
+func NewTreble(gain float64, freq uint) (Filter, error) {
+	return shelf("treble", gain, freq)
+}
+
+func shelf(name string, gain float64, freq uint) (Filter, error) {
+	err := param.FirstErr(
+		param.InRange(ErrInvalidFilter, name, "gain", gain, -60, 60),
+		param.InRange(ErrInvalidFilter, name, "freq", float64(freq), 1, 999999),
+	)
+	if err != nil {
+		return "", err
+	}
+	return Filter(fmt.Sprintf("%s=f=%d:g=%.3f", name, freq, gain)), nil
+}
+
+// NewHighpass returns a two-pole high-pass filter (e.g. "highpass=f=80:t=q:w=0.707").
+func NewHighpass(freq uint, q float64) (Filter, error) {
+	return pass("highpass", freq, q)
+}
+
+// NewLowpass returns a two-pole low-pass filter (e.g. "lowpass=f=8000:t=q:w=0.707").
+func NewLowpass(freq uint, q float64) (Filter, error) {
+	return pass("lowpass", freq, q)
+}
+
+func pass(name string, freq uint, q float64) (Filter, error) {
+	err := param.FirstErr(
+		param.InRange(ErrInvalidFilter, name, "freq", float64(freq), 1, 999999),
+		param.InRange(ErrInvalidFilter, name, "q", q, 0.001, 1000),
+	)
+	if err != nil {
+		return "", err
+	}
+	return Filter(fmt.Sprintf("%s=f=%d:t=q:w=%.3f", name, freq, q)), nil
+}
+
+// NewLoudnorm returns an EBU R128 loudness normalization filter (e.g. "loudnorm=I=-16.0:LRA=11.0:TP=-1.5").
+//
+// integrated is the target loudness in LUFS (-70 to -5), lra is the loudness range in LU (1 to 50)
+// and truePeak is the maximum true peak in dBTP (-9 to 0).
+//
+// NOTE: loudnorm resamples to 192kHz internally and adds latency.
+func NewLoudnorm(integrated, lra, truePeak float64) (Filter, error) {
+	const name = "loudnorm"
+	err := param.FirstErr(
+		param.InRange(ErrInvalidFilter, name, "integrated", integrated, -70, -5),
+		param.InRange(ErrInvalidFilter, name, "lra", lra, 1, 50),
+		param.InRange(ErrInvalidFilter, name, "truePeak", truePeak, -9, 0),
+	)
+	if err != nil {
+		return "", err
+	}
+	return Filter(fmt.Sprintf("%s=I=%.1f:LRA=%.1f:TP=%.1f", name, integrated, lra, truePeak)), nil
+}
+
+// NewAcompressor returns a compressor filter
+// (e.g. "acompressor=threshold=-20.000dB:ratio=4.000:attack=20.000:release=250.000:makeup=0.000dB").
+//
+// threshold is in dB (-60 to 0), ratio is 1 to 20, attack is up to 2s,
+// release is up to 9s and makeup is in dB (0 to 36).
+func NewAcompressor(threshold, ratio float64, attack, release time.Duration, makeup float64) (Filter, error) {
+	const name = "acompressor"
+	err := param.FirstErr(
+		param.InRange(ErrInvalidFilter, name, "threshold", threshold, -60, 0),
+		param.InRange(ErrInvalidFilter, name, "ratio", ratio, 1, 20),
+		param.InRange(ErrInvalidFilter, name, "attack", param.Ms(attack), 0.01, 2000),
+		param.InRange(ErrInvalidFilter, name, "release", param.Ms(release), 0.01, 9000),
+		param.InRange(ErrInvalidFilter, name, "makeup", makeup, 0, 36),
+	)
+	if err != nil {
+		return "", err
+	}
+	return Filter(fmt.Sprintf("%s=threshold=%.3fdB:ratio=%.3f:attack=%.3f:release=%.3f:makeup=%.3fdB",
+		name, threshold, ratio, param.Ms(attack), param.Ms(release), makeup)), nil
+}
@@ -5,10 +5,13 @@ package pipe
 import (
 	"fmt"
 	"io"
+	"log"
 	"os/exec"
-	"strings"
 	"sync"
+	"time"
 
+	"github.com/ebiiim/eq/filter"
+	"github.com/ebiiim/eq/pcm"
 	"github.com/pkg/errors"
 )
 
@@ -18,19 +21,87 @@ type Filter struct {
 	//
 	// The command should sequentially read stdin,
 	// do some processing, and write into stdout.
+	// Cmd is split into arguments by SplitCommand, so arguments can be quoted.
 	//
 	// e.g. "tee -i /dev/null"
 	Cmd string
 
+	// Args is the execPath and args of the command (optional).
+	//
+	// If Args is set, Cmd is ignored.
+	//
+	// e.g. []string{"tee", "-i", "/dev/null"}, sox.Command.Args() or ffmpeg.Command.Args()
+	Args []string
+
+	// Env is the environment of the command (optional).
+	//
+	// See exec.Cmd.Env (nil means the environment of the current process).
+	Env []string
+
+	// Dir is the working directory of the command (optional).
+	//
+	// See exec.Cmd.Dir (empty means the current directory).
+	Dir string
+
+	// Logger prints each line of stderr of the command (optional).
+	//
+	// Regardless of Logger, the last 4KB of stderr are kept
+	// and attached to errors (see Error).
+	Logger *log.Logger
+
+	// InFormat and OutFormat are the formats of the stream
+	// that the command reads and writes (optional).
+	// Start returns an error if they are set but invalid.
+	//
+	// e.g. sox.Command.InputFormat() and sox.Command.OutputFormat()
+	InFormat, OutFormat pcm.Format
+
+	// Framed enables the framed protocol (see package framed) (optional).
+	//
+	// Each Write sends the whole PCM frames in b as a frame
+	// (an incomplete PCM frame is kept until the next Write),
+	// and Read returns the payloads of the answers
+	// after checking their sequence numbers and formats.
+	// Frames interrupted by deadlines are resumed by the next Read or Write.
+	// InFormat and OutFormat are required in this mode.
+	Framed bool
+
 	initOnce sync.Once
+	initErr  error
 	cmd      *exec.Cmd
 	inPipe   io.WriteCloser
+	inOnce   sync.Once // closes inPipe
+	inErr    error
 	outPipe  io.ReadCloser
+	stderr   stderrWriter
+	framed   framedState
 }
 
 func (f *Filter) initialize() (err error) {
-	ss := strings.Split(f.Cmd, " ")
-	f.cmd = exec.Command(ss[0], ss[1:]...)
+	if f.Framed {
+		if err = f.checkFramed(); err != nil {
+			return err
+		}
+	}
+	if err = f.checkFormats(); err != nil {
+		return err
+	}
+	args := f.Args
+	if args == nil {
+		args, err = SplitCommand(f.Cmd)
+		if err != nil {
+			return errors.Wrap(err, "could not parse Cmd")
+		}
+	}
+	if len(args) == 0 {
+		return errors.New("no command specified")
+	}
+	f.cmd = exec.Command(args[0], args[1:]...)
+	f.cmd.Env = f.Env
+	f.cmd.Dir = f.Dir
+	f.stderr.logger = f.Logger
+	f.stderr.prefix = args[0]
+	f.cmd.Stderr = &f.stderr
 
 	f.inPipe, err = f.cmd.StdinPipe()
 	if err != nil {
@@ -42,19 +113,57 @@ func (f *Filter) initialize() (err error) {
 	}
 	err = f.cmd.Start()
 	if err != nil {
-		return errors.Wrap(err, "could not start exec")
+		return f.wrapError("start", errors.Wrap(err, "could not start exec"))
+	}
+	return nil
+}
+
+// checkFormats returns an error if InFormat or OutFormat is set but invalid.
+func (f *Filter) checkFormats() error {
+	if !f.InFormat.IsZero() {
+		if err := f.InFormat.Validate(); err != nil {
+			return errors.Wrap(err, "invalid InFormat")
+		}
+	}
+	if !f.OutFormat.IsZero() {
+		if err := f.OutFormat.Validate(); err != nil {
+			return errors.Wrap(err, "invalid OutFormat")
+		}
 	}
 	return nil
 }
 
+// Start starts the external application.
+//
+// Calling this function is optional as Read, Write and CloseWrite start it implicitly.
+func (f *Filter) Start() error {
+	f.initOnce.Do(func() { f.initErr = f.initialize() })
+	return f.initErr
+}
+
 // Read reads len(b) bytes from
 // the output pipe (pipes data from stdout of the external application)
 // into b.
 //
 // The function blocks until it reads len(b) bytes or more.
-// The function does not support ioutil.ReadAll (blocks permanently).
+// After CloseWrite, the function returns io.EOF
+// when the external application exits, so ioutil.ReadAll is supported.
+// Other errors are returned as *Error
+// (with filter.ErrTimeout as the cause if the read deadline is exceeded).
 func (f *Filter) Read(b []byte) (n int, err error) {
-	n, err = f.outPipe.Read(b)
+	err = f.Start()
+	if err != nil {
+		return 0, err
+	}
+
+	if f.Framed {
+		n, err = f.readFramed(b)
+	} else {
+		n, err = f.outPipe.Read(b)
+	}
+	if err != nil && err != io.EOF {
+		err = f.wrapError("read", timeout(err))
+	}
 	return
 }
 
@@ -62,32 +171,121 @@ func (f *Filter) Read(b []byte) (n int, err error) {
 // that pipes data to stdin of the external application.
 //
 // The first call to this function invokes an exec.Command.Start()
-// that using an external application (specified in f.Cmd)
+// that using an external application (specified in f.Args or f.Cmd)
 // to sequentially reads data from the input pipe,
 // process them, and writes the processed data into the output pipe.
+//
+// Errors (e.g. the external application exited) are returned as *Error
+// (with filter.ErrTimeout as the cause if the write deadline is exceeded).
 func (f *Filter) Write(b []byte) (n int, err error) {
-	f.initOnce.Do(func() { err = f.initialize() })
+	err = f.Start()
 	if err != nil {
 		return 0, err
 	}
 
+	if f.Framed {
+		return f.writeFramed(b)
+	}
 	n, err = f.inPipe.Write(b)
-	return
+	return n, f.wrapError("write", timeout(err))
+}
+
+// SetReadDeadline sets the deadline for Read (the zero value means no deadline).
+//
+// It starts the external application if needed.
+func (f *Filter) SetReadDeadline(t time.Time) error {
+	err := f.Start()
+	if err != nil {
+		return err
+	}
+	d, ok := f.outPipe.(interface{ SetReadDeadline(time.Time) error })
+	if !ok {
+		return errors.New("read deadline is not supported")
+	}
+	return d.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for Write (the zero value means no deadline).
+//
+// It starts the external application if needed.
+func (f *Filter) SetWriteDeadline(t time.Time) error {
+	err := f.Start()
+	if err != nil {
+		return err
+	}
+	d, ok := f.inPipe.(interface{ SetWriteDeadline(time.Time) error })
+	if !ok {
+		return errors.New("write deadline is not supported")
+	}
+	return d.SetWriteDeadline(t)
+}
+
+// timeout returns filter.ErrTimeout if err is a timeout (e.g. os.ErrDeadlineExceeded).
+func timeout(err error) error {
+	if t, ok := err.(interface{ Timeout() bool }); ok && t.Timeout() {
+		return filter.ErrTimeout
+	}
+	return err
+}
+
+// CloseWrite closes the input pipe
+// so that the external application reaches the end of its input.
+//
+// In the framed mode, the function returns an error
+// if an incomplete PCM frame has been discarded.
+func (f *Filter) CloseWrite() error {
+	err := f.Start()
+	if err != nil {
+		return err
+	}
+
+	err = f.closeIn()
+	if err == nil && f.Framed && len(f.framed.partial) > 0 {
+		err = errors.Errorf("discarded an incomplete PCM frame of %d bytes", len(f.framed.partial))
+	}
+	return err
+}
+
+func (f *Filter) closeIn() error {
+	f.inOnce.Do(func() {
+		err := f.inPipe.Close()
+		if err != nil {
+			f.inErr = errors.Wrap(err, "could not close stdin pipe")
+		}
+	})
+	return f.inErr
 }
 
 // Close closes the Filter object by closing pipes and the external application.
+//
+// If the external application fails, the function returns *Error
+// containing its stderr.
 func (f *Filter) Close() (err error) {
-	err = f.inPipe.Close()
+	if f.cmd == nil || f.cmd.Process == nil {
+		return nil // not started
+	}
+	err = f.closeIn()
 	if err != nil {
-		return errors.Wrap(err, "could not close stdin pipe")
+		return err
 	}
-	err = f.cmd.Wait()
+	err = f.cmd.Wait() // waits for stderr to be copied
+	f.stderr.flush()
 	if err != nil {
-		return errors.Wrap(err, "could not wait exec")
+		return f.wrapError("close", errors.Wrap(err, "could not wait exec"))
 	}
 	if f.cmd.ProcessState.ExitCode() != 0 {
-		return fmt.Errorf("abnormal exit code %d", f.cmd.ProcessState.ExitCode())
+		return f.wrapError("close", fmt.Errorf("abnormal exit code %d", f.cmd.ProcessState.ExitCode()))
 	}
 	// f.outPipe is closed when the process is exited.
 	return nil
 }
+
+// InputFormat returns f.InFormat.
+func (f *Filter) InputFormat() pcm.Format {
+	return f.InFormat
+}
+
+// OutputFormat returns f.OutFormat.
+func (f *Filter) OutputFormat() pcm.Format {
+	return f.OutFormat
+}
@@ -1,11 +1,18 @@
 package pipe_test
 
 import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/ebiiim/eq/filter"
 	"github.com/ebiiim/eq/filter/pipe"
 	"github.com/ebiiim/eq/filter/pipe/sox"
 	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
 )
 
 // TestFilter_Read and TestFilter_Write and TestFilter_Close
@@ -49,3 +56,160 @@ func TestFilter(t *testing.T) {
 		})
 	}
 }
+
+func TestFilter_CloseWrite(t *testing.T) {
+	cases := []struct {
+		name  string
+		cmd   string
+		in    []byte
+		want  []byte
+		isErr bool
+	}{
+		{"no_change", "tee -i /dev/null", []byte("hello"), []byte("hello"), false},
+		{"upper", "tr a-z A-Z", []byte("hello"), []byte("HELLO"), false},
+		{"empty", "cat", []byte{}, []byte{}, false},
+		{"F_not_found", "/nonexistent", []byte("hello"), nil, true},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			var f pipe.Filter
+			f.Cmd = c.cmd
+			_, err := f.Write(c.in)
+			if !((err != nil) == c.isErr) {
+				t.Errorf("got %v, want %v(isErr) ", err, c.isErr)
+			}
+			err = f.CloseWrite()
+			if !((err != nil) == c.isErr) {
+				t.Errorf("got %v, want %v(isErr) ", err, c.isErr)
+			}
+			got, err := ioutil.ReadAll(&f)
+			if !((err != nil) == c.isErr) {
+				t.Errorf("got %v, want %v(isErr) ", err, c.isErr)
+			}
+			if c.isErr {
+				return
+			}
+			if !cmp.Equal(got, c.want) {
+				t.Errorf("got %v want %v", got, c.want)
+			}
+			err = f.Close()
+			if err != nil {
+				t.Errorf("could not close: %v", err)
+			}
+		})
+	}
+}
+
+func TestFilter_Args(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pipe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cases := []struct {
+		name  string
+		f     *pipe.Filter
+		want  []byte
+		isErr bool
+	}{
+		{"cmd_quoted", &pipe.Filter{Cmd: `sh -c 'printf "%s|" "$0"; cat' "a  b"`}, []byte("a  b|in"), false},
+		{"args", &pipe.Filter{Args: []string{"sh", "-c", `printf "%s|" "$0"; cat`, "a  b"}}, []byte("a  b|in"), false},
+		{"args_over_cmd", &pipe.Filter{Cmd: "/nonexistent", Args: []string{"cat"}}, []byte("in"), false},
+		{"env", &pipe.Filter{Args: []string{"sh", "-c", `printf "%s|" "$EQ_TEST"; cat`}, Env: []string{"EQ_TEST=x y"}}, []byte("x y|in"), false},
+		{"dir", &pipe.Filter{Args: []string{"sh", "-c", `printf "%s|" "$(pwd -P)"; cat`}, Dir: dir}, nil, false},
+		{"F_unterminated", &pipe.Filter{Cmd: `sh -c 'cat`}, nil, true},
+		{"F_empty", &pipe.Filter{Cmd: "  "}, nil, true},
+	}
+	t.Run("group", func(t *testing.T) {
+		for _, c := range cases {
+			c := c
+			t.Run(c.name, func(t *testing.T) {
+				t.Parallel()
+				f := c.f
+				_, err := f.Write([]byte("in"))
+				if !((err != nil) == c.isErr) {
+					t.Errorf("got %v, want %v(isErr) ", err, c.isErr)
+				}
+				if c.isErr {
+					return
+				}
+				err = f.CloseWrite()
+				if err != nil {
+					t.Fatalf("could not close write: %v", err)
+				}
+				got, err := ioutil.ReadAll(f)
+				if err != nil {
+					t.Fatalf("could not read: %v", err)
+				}
+				want := c.want
+				if c.f.Dir != "" {
+					wd, _ := filepath.EvalSymlinks(dir)
+					want = []byte(wd + "|in")
+				}
+				if !cmp.Equal(got, want) {
+					t.Errorf("got %q want %q", got, want)
+				}
+				err = f.Close()
+				if err != nil {
+					t.Errorf("could not close: %v", err)
+				}
+			})
+		}
+	})
+}
+
+func TestFilter_Deadline(t *testing.T) {
+	cases := []struct {
+		name string
+		f    *pipe.Filter
+	}{
+		{"raw", &pipe.Filter{Cmd: "cat"}},
+		{"framed", newChild("negate")},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run("read_"+c.name, func(t *testing.T) {
+			t.Parallel()
+			f := c.f
+			defer f.Close()
+
+			err := f.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+			if err != nil {
+				t.Fatalf("could not set deadline: %v", err)
+			}
+			b := make([]byte, 4)
+			_, err = f.Read(b)
+			if errors.Cause(err) != filter.ErrTimeout {
+				t.Errorf("got %v want %v", err, filter.ErrTimeout)
+			}
+
+			// the filter still works
+			f.SetReadDeadline(time.Time{})
+			_, err = f.Write([]byte{1, 0, 2, 0})
+			if err != nil {
+				t.Fatalf("could not write: %v", err)
+			}
+			_, err = io.ReadFull(f, b)
+			if err != nil {
+				t.Errorf("could not read: %v", err)
+			}
+		})
+	}
+	t.Run("write", func(t *testing.T) {
+		t.Parallel()
+		f := &pipe.Filter{Cmd: "sleep 0.3"} // does not read stdin
+		defer f.Close()
+
+		err := f.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
+		if err != nil {
+			t.Fatalf("could not set deadline: %v", err)
+		}
+		b := make([]byte, 1<<20) // larger than the pipe buffer
+		_, err = f.Write(b)
+		if errors.Cause(err) != filter.ErrTimeout {
+			t.Errorf("got %v want %v", err, filter.ErrTimeout)
+		}
+	})
+}
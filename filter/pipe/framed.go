@@ -0,0 +1,134 @@
+package pipe
+
+import (
+	"io"
+
+	"github.com/ebiiim/eq/filter/pipe/framed"
+	"github.com/ebiiim/eq/pcm"
+	"github.com/pkg/errors"
+)
+
+// framedState is the state of the framed mode (see Filter.Framed).
+//
+// Frames are sent and received in pieces, so that a frame interrupted
+// by a deadline can be resumed.
+type framedState struct {
+	// written by Write
+	seq     uint32
+	partial []byte // an incomplete PCM frame
+	obuf    []byte
+	out     []byte // the unsent part of obuf
+
+	// read by Read
+	rseq    uint32
+	hdr     [framed.HeaderSize]byte
+	hn      int // bytes of hdr received
+	payload []byte
+	pn      int    // bytes of payload received
+	rest    []byte // the unread part of payload
+}
+
+func (f *Filter) checkFramed() error {
+	if err := f.InFormat.Validate(); err != nil {
+		return errors.Wrap(err, "framed mode needs a valid InFormat")
+	}
+	if err := f.OutFormat.Validate(); err != nil {
+		return errors.Wrap(err, "framed mode needs a valid OutFormat")
+	}
+	return nil
+}
+
+// writeFramed sends the whole PCM frames in b (with the partial one of the previous call) as frames.
+//
+// If a deadline is exceeded while sending b, the function returns len(b) with the error
+// and the rest is sent by the next call. If the frames of the previous call are still unsent,
+// the function returns 0 without accepting b.
+func (f *Filter) writeFramed(b []byte) (int, error) {
+	s := &f.framed
+	if err := f.flushFramed(); err != nil {
+		return 0, err
+	}
+
+	fs := f.InFormat.FrameSize()
+	data := append(s.partial, b...)
+	whole := len(data) - len(data)%fs
+	s.obuf = s.obuf[:0]
+	for off := 0; off < whole; {
+		n := whole - off
+		if n > framed.MaxFrames*fs {
+			n = framed.MaxFrames * fs
+		}
+		h := framed.Header{Seq: s.seq, Frames: uint32(n / fs), Format: f.InFormat}
+		hb, err := h.MarshalBinary()
+		if err != nil {
+			return 0, f.wrapError("write", err)
+		}
+		s.obuf = append(append(s.obuf, hb...), data[off:off+n]...)
+		s.seq++
+		off += n
+	}
+	s.partial = append(s.partial[:0], data[whole:]...)
+	s.out = s.obuf
+	return len(b), f.flushFramed()
+}
+
+// flushFramed sends the unsent frames.
+func (f *Filter) flushFramed() error {
+	s := &f.framed
+	for len(s.out) > 0 {
+		n, err := f.inPipe.Write(s.out)
+		s.out = s.out[n:]
+		if err != nil {
+			return f.wrapError("write", timeout(err))
+		}
+	}
+	return nil
+}
+
+// readFramed reads the payloads of answers into b.
+func (f *Filter) readFramed(b []byte) (int, error) {
+	s := &f.framed
+	for len(s.rest) == 0 {
+		if s.hn < framed.HeaderSize {
+			n, err := io.ReadFull(f.outPipe, s.hdr[s.hn:])
+			s.hn += n
+			if err == io.EOF && s.hn > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return 0, err
+			}
+			var h framed.Header
+			if err := h.UnmarshalBinary(s.hdr[:]); err != nil {
+				return 0, err
+			}
+			if h.Seq != s.rseq {
+				return 0, errors.Wrapf(framed.ErrSequence, "got %d want %d", h.Seq, s.rseq)
+			}
+			s.rseq++
+			if !h.Format.Equal(f.OutFormat) {
+				return 0, errors.Wrapf(pcm.ErrMismatch, "got %v want %v", h.Format, f.OutFormat)
+			}
+			if size := h.PayloadSize(); cap(s.payload) < size {
+				s.payload = make([]byte, size)
+			} else {
+				s.payload = s.payload[:size]
+			}
+			s.pn = 0
+		}
+
+		n, err := io.ReadFull(f.outPipe, s.payload[s.pn:])
+		s.pn += n
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		s.hn = 0
+		s.rest = s.payload
+	}
+	n := copy(b, s.rest)
+	s.rest = s.rest[n:]
+	return n, nil
+}
@@ -0,0 +1,212 @@
+// Package framed provides a length-prefixed protocol between pipe.Filter
+// and an external filter application, and helpers for writing such applications in Go.
+//
+// Each block of PCM data is sent as a frame that consists of a header and a payload.
+// The application answers each frame with a frame of the same sequence number,
+// so the stream stays block-aligned without relying on the buffering of the application.
+//
+// The header is 24 bytes in big-endian:
+//
+//	offset size field
+//	0      4    magic "EQFR"
+//	4      4    sequence number
+//	8      4    the number of PCM frames in the payload
+//	12     4    sample rate
+//	16     2    channels
+//	18     1    bit depth
+//	19     1    encoding (0: signed, 1: unsigned, 2: float)
+//	20     1    byte order (0: little-endian, 1: big-endian)
+//	21     3    reserved (0)
+//
+// The payload is (the number of PCM frames) * (channels) * (bit depth / 8) bytes.
+package framed
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	"github.com/ebiiim/eq/pcm"
+	"github.com/pkg/errors"
+)
+
+// HeaderSize is the size of a header in bytes.
+const HeaderSize = 24
+
+// MaxFrames is the maximum number of PCM frames in a frame.
+const MaxFrames = 1 << 20
+
+var magic = [4]byte{'E', 'Q', 'F', 'R'}
+
+// ErrInvalidHeader is returned (as a cause) when a header is broken.
+var ErrInvalidHeader = errors.New("invalid frame header")
+
+// ErrSequence is returned (as a cause) when an answer does not match the frame sent.
+var ErrSequence = errors.New("unexpected sequence number")
+
+// Header is the header of a frame.
+type Header struct {
+	Seq    uint32
+	Frames uint32 // the number of PCM frames in the payload
+	Format pcm.Format
+}
+
+// PayloadSize returns the size of the payload in bytes.
+func (h Header) PayloadSize() int {
+	return int(h.Frames) * h.Format.FrameSize()
+}
+
+var encodings = []pcm.Encoding{pcm.Signed, pcm.Unsigned, pcm.Float}
+
+// MarshalBinary encodes h. It returns an error if h.Format is invalid.
+func (h Header) MarshalBinary() ([]byte, error) {
+	if err := h.Format.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid format")
+	}
+	if h.Frames > MaxFrames {
+		return nil, errors.Errorf("too many frames %d (max: %d)", h.Frames, MaxFrames)
+	}
+	b := make([]byte, HeaderSize)
+	copy(b, magic[:])
+	binary.BigEndian.PutUint32(b[4:], h.Seq)
+	binary.BigEndian.PutUint32(b[8:], h.Frames)
+	binary.BigEndian.PutUint32(b[12:], uint32(h.Format.SampleRate))
+	binary.BigEndian.PutUint16(b[16:], uint16(h.Format.Channels))
+	b[18] = uint8(h.Format.BitDepth)
+	for i, e := range encodings {
+		if h.Format.Encoding == e {
+			b[19] = uint8(i)
+		}
+	}
+	if h.Format.ByteOrder != nil && h.Format.ByteOrder.String() == binary.BigEndian.String() {
+		b[20] = 1
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes b into h.
+// It returns an error wrapping ErrInvalidHeader if b is not a valid header.
+func (h *Header) UnmarshalBinary(b []byte) error {
+	if len(b) < HeaderSize {
+		return errors.Wrapf(ErrInvalidHeader, "too short (%d bytes)", len(b))
+	}
+	if string(b[:4]) != string(magic[:]) {
+		return errors.Wrapf(ErrInvalidHeader, "bad magic %q", b[:4])
+	}
+	if int(b[19]) >= len(encodings) || b[20] > 1 {
+		return errors.Wrapf(ErrInvalidHeader, "unknown encoding %d or byte order %d", b[19], b[20])
+	}
+	var f pcm.Format
+	f.SampleRate = int(binary.BigEndian.Uint32(b[12:]))
+	f.Channels = int(binary.BigEndian.Uint16(b[16:]))
+	f.BitDepth = int(b[18])
+	f.Encoding = encodings[b[19]]
+	f.ByteOrder = binary.LittleEndian
+	if b[20] == 1 {
+		f.ByteOrder = binary.BigEndian
+	}
+	if err := f.Validate(); err != nil {
+		return errors.Wrapf(ErrInvalidHeader, "invalid format: %v", err)
+	}
+	frames := binary.BigEndian.Uint32(b[8:])
+	if frames > MaxFrames {
+		return errors.Wrapf(ErrInvalidHeader, "too many frames %d (max: %d)", frames, MaxFrames)
+	}
+	*h = Header{Seq: binary.BigEndian.Uint32(b[4:]), Frames: frames, Format: f}
+	return nil
+}
+
+// WriteFrame writes a frame of h and data to w.
+//
+// len(data) must be h.PayloadSize().
+func WriteFrame(w io.Writer, h Header, data []byte) error {
+	if len(data) != h.PayloadSize() {
+		return errors.Errorf("payload size %d does not match the header (%d)", len(data), h.PayloadSize())
+	}
+	b, err := h.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, data...))
+	return err
+}
+
+// ReadFrame reads a frame from r.
+//
+// The payload is read into buf if it has enough capacity.
+// The function returns io.EOF only if r is at the end before a frame,
+// and io.ErrUnexpectedEOF if a frame is cut.
+func ReadFrame(r io.Reader, buf []byte) (h Header, data []byte, err error) {
+	var b [HeaderSize]byte
+	_, err = io.ReadFull(r, b[:])
+	if err != nil {
+		return Header{}, nil, err
+	}
+	err = h.UnmarshalBinary(b[:])
+	if err != nil {
+		return Header{}, nil, err
+	}
+	n := h.PayloadSize()
+	if cap(buf) < n {
+		buf = make([]byte, n)
+	}
+	data = buf[:n]
+	_, err = io.ReadFull(r, data)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return h, data, err
+}
+
+// HandlerFunc processes the payload of a frame
+// and returns the processed data in the output format.
+type HandlerFunc func(h Header, data []byte) ([]byte, error)
+
+// Serve reads frames from r, processes them by fn,
+// and writes the results to w with the same sequence numbers
+// until r reaches the end. It is intended to be used in filter applications
+// as Serve(os.Stdin, os.Stdout, out, fn).
+//
+// out is the output format (the zero value means the same as the input).
+// The length of the result must be a multiple of the frame size of out.
+func Serve(r io.Reader, w io.Writer, out pcm.Format, fn HandlerFunc) error {
+	if !out.IsZero() {
+		if err := out.Validate(); err != nil {
+			return errors.Wrap(err, "invalid output format")
+		}
+	}
+	br := bufio.NewReader(r)
+	bw := bufio.NewWriter(w)
+	var buf []byte
+	for {
+		h, data, err := ReadFrame(br, buf)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "could not read a frame")
+		}
+		buf = data
+
+		res, err := fn(h, data)
+		if err != nil {
+			return err
+		}
+		oh := Header{Seq: h.Seq, Format: out}
+		if out.IsZero() {
+			oh.Format = h.Format
+		}
+		fs := oh.Format.FrameSize()
+		if len(res)%fs != 0 {
+			return errors.Errorf("result of %d bytes is not a multiple of the frame size %d", len(res), fs)
+		}
+		oh.Frames = uint32(len(res) / fs)
+		err = WriteFrame(bw, oh, res)
+		if err == nil {
+			err = bw.Flush()
+		}
+		if err != nil {
+			return errors.Wrap(err, "could not write a frame")
+		}
+	}
+}
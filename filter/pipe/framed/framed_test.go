@@ -0,0 +1,144 @@
+package framed_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/ebiiim/eq/filter/pipe/framed"
+	"github.com/ebiiim/eq/pcm"
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+var s24be = pcm.Format{Channels: 1, SampleRate: 96000, BitDepth: 24, Encoding: pcm.Signed, ByteOrder: binary.BigEndian}
+
+func TestHeader(t *testing.T) {
+	cases := []struct {
+		name  string
+		h     framed.Header
+		isErr bool
+	}{
+		{"default", framed.Header{Seq: 1, Frames: 256, Format: pcm.Default}, false},
+		{"s24be", framed.Header{Seq: 1<<32 - 1, Frames: framed.MaxFrames, Format: s24be}, false},
+		{"u8", framed.Header{Format: pcm.Format{Channels: 2, SampleRate: 8000, BitDepth: 8, Encoding: pcm.Unsigned}}, false},
+		{"F_format", framed.Header{Frames: 1}, true},
+		{"F_frames", framed.Header{Frames: framed.MaxFrames + 1, Format: pcm.Default}, true},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			b, err := c.h.MarshalBinary()
+			if !((err != nil) == c.isErr) {
+				t.Errorf("got %v, want %v(isErr) ", err, c.isErr)
+			}
+			if c.isErr {
+				return
+			}
+			if len(b) != framed.HeaderSize {
+				t.Errorf("got %d bytes want %d", len(b), framed.HeaderSize)
+			}
+			var got framed.Header
+			err = got.UnmarshalBinary(b)
+			if err != nil {
+				t.Fatalf("could not unmarshal: %v", err)
+			}
+			if got.Seq != c.h.Seq || got.Frames != c.h.Frames || !got.Format.Equal(c.h.Format) {
+				t.Errorf("got %+v want %+v", got, c.h)
+			}
+		})
+	}
+}
+
+func TestHeader_UnmarshalBinary(t *testing.T) {
+	valid, _ := framed.Header{Frames: 1, Format: pcm.Default}.MarshalBinary()
+	modify := func(i int, v byte) []byte {
+		b := append([]byte{}, valid...)
+		b[i] = v
+		return b
+	}
+	cases := []struct {
+		name string
+		b    []byte
+	}{
+		{"short", valid[:framed.HeaderSize-1]},
+		{"magic", modify(0, 'X')},
+		{"channels", modify(17, 0)},
+		{"encoding", modify(19, 3)},
+		{"byte_order", modify(20, 2)},
+		{"frames", modify(8, 0xff)},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			var h framed.Header
+			err := h.UnmarshalBinary(c.b)
+			if errors.Cause(err) != framed.ErrInvalidHeader {
+				t.Errorf("got %v want %v", err, framed.ErrInvalidHeader)
+			}
+		})
+	}
+}
+
+func TestServe(t *testing.T) {
+	mono := pcm.Format{Channels: 1, SampleRate: 48000, BitDepth: 16, Encoding: pcm.Signed, ByteOrder: binary.LittleEndian}
+	in := &bytes.Buffer{}
+	payloads := [][]byte{{1, 0, 2, 0, 3, 0, 4, 0}, {}, {5, 0, 6, 0, 7, 0, 8, 0}}
+	for i, p := range payloads {
+		err := framed.WriteFrame(in, framed.Header{Seq: uint32(i), Frames: uint32(len(p) / 4), Format: pcm.Default}, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// downmix to mono
+	out := &bytes.Buffer{}
+	err := framed.Serve(in, out, mono, func(h framed.Header, data []byte) ([]byte, error) {
+		res := make([]byte, 0, len(data)/2)
+		for i := 0; i < len(data); i += 4 {
+			res = append(res, data[i:i+2]...)
+		}
+		return res, nil
+	})
+	if err != nil {
+		t.Fatalf("could not serve: %v", err)
+	}
+
+	var got [][]byte
+	for i := 0; ; i++ {
+		h, data, err := framed.ReadFrame(out, nil)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("could not read: %v", err)
+		}
+		if h.Seq != uint32(i) || !h.Format.Equal(mono) {
+			t.Errorf("got %+v want seq %d and %v", h, i, mono)
+		}
+		got = append(got, append([]byte{}, data...))
+	}
+	want := [][]byte{{1, 0, 3, 0}, {}, {5, 0, 7, 0}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("(-want +got)\n%s", diff)
+	}
+}
+
+func TestServe_CutFrame(t *testing.T) {
+	in := &bytes.Buffer{}
+	err := framed.WriteFrame(in, framed.Header{Frames: 2, Format: pcm.Default}, make([]byte, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	in.Truncate(in.Len() - 1)
+
+	err = framed.Serve(in, &bytes.Buffer{}, pcm.Format{}, func(h framed.Header, data []byte) ([]byte, error) {
+		return data, nil
+	})
+	if errors.Cause(err) != io.ErrUnexpectedEOF {
+		t.Errorf("got %v want %v", err, io.ErrUnexpectedEOF)
+	}
+}
@@ -0,0 +1,133 @@
+package pipe_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/ebiiim/eq/filter/pipe"
+	"github.com/ebiiim/eq/filter/pipe/framed"
+	"github.com/ebiiim/eq/pcm"
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+// childEnv makes the test binary a framed filter application (see TestMain).
+const childEnv = "EQ_PIPE_TEST_CHILD"
+
+func TestMain(m *testing.M) {
+	switch os.Getenv(childEnv) {
+	case "":
+		os.Exit(m.Run())
+	case "negate":
+		err := framed.Serve(os.Stdin, os.Stdout, pcm.Format{}, func(h framed.Header, data []byte) ([]byte, error) {
+			for i := 0; i+1 < len(data); i += 2 {
+				binary.LittleEndian.PutUint16(data[i:], uint16(-int16(binary.LittleEndian.Uint16(data[i:]))))
+			}
+			return data, nil
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case "badseq":
+		err := framed.Serve(os.Stdin, os.Stdout, pcm.Format{}, func(h framed.Header, data []byte) ([]byte, error) {
+			return data, framed.WriteFrame(os.Stdout, framed.Header{Seq: h.Seq + 100, Format: h.Format}, nil)
+		})
+		if err != nil {
+			os.Exit(1)
+		}
+	}
+	os.Exit(0)
+}
+
+func newChild(mode string) *pipe.Filter {
+	return &pipe.Filter{
+		Args:      []string{os.Args[0]},
+		Env:       append(os.Environ(), childEnv+"="+mode),
+		InFormat:  pcm.Default,
+		OutFormat: pcm.Default,
+		Framed:    true,
+	}
+}
+
+func TestFilter_Framed(t *testing.T) {
+	f := newChild("negate")
+	defer f.Close()
+
+	// writes samples 1..8 in pieces not aligned to frames (4 bytes)
+	var in []byte
+	for i := 1; i <= 8; i++ {
+		in = append(in, byte(i), 0)
+	}
+	for _, n := range []int{3, 6, 7} {
+		_, err := f.Write(in[:n])
+		if err != nil {
+			t.Fatalf("could not write: %v", err)
+		}
+		in = in[n:]
+	}
+	err := f.CloseWrite()
+	if err != nil {
+		t.Fatalf("could not close write: %v", err)
+	}
+
+	var got []int16
+	b := make([]byte, 6) // not aligned to frames
+	for {
+		n, err := io.ReadFull(f, b)
+		for i := 0; i+1 < n; i += 2 {
+			got = append(got, int16(binary.LittleEndian.Uint16(b[i:])))
+		}
+		if err != nil {
+			break
+		}
+	}
+	want := []int16{-1, -2, -3, -4, -5, -6, -7, -8}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("(-want +got)\n%s", diff)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Errorf("could not close: %v", err)
+	}
+}
+
+func TestFilter_FramedErrors(t *testing.T) {
+	t.Run("partial", func(t *testing.T) {
+		t.Parallel()
+		f := newChild("negate")
+		defer f.Close()
+		_, err := f.Write(make([]byte, 6))
+		if err != nil {
+			t.Fatalf("could not write: %v", err)
+		}
+		err = f.CloseWrite()
+		if err == nil {
+			t.Errorf("got nil want an error for the incomplete frame")
+		}
+	})
+	t.Run("sequence", func(t *testing.T) {
+		t.Parallel()
+		f := newChild("badseq")
+		defer f.Close()
+		_, err := f.Write(make([]byte, 8))
+		if err != nil {
+			t.Fatalf("could not write: %v", err)
+		}
+		_, err = f.Read(make([]byte, 8))
+		if errors.Cause(err) != framed.ErrSequence {
+			t.Errorf("got %v want %v", err, framed.ErrSequence)
+		}
+	})
+	t.Run("format", func(t *testing.T) {
+		t.Parallel()
+		f := &pipe.Filter{Cmd: "cat", Framed: true}
+		_, err := f.Write(make([]byte, 8))
+		if err == nil {
+			t.Errorf("got nil want an error for no formats")
+		}
+	})
+}
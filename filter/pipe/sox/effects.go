@@ -0,0 +1,439 @@
+package sox
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ebiiim/eq/internal/param"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidEffect is returned by effect constructors for parameters that SoX rejects.
+var ErrInvalidEffect = errors.New("invalid effect parameter")
+
+// NewBass returns a bass shelving filter effect (e.g. "bass 3.000 100").
+//
+// gain is in dB (-60 to 60) and freq is the center frequency in Hz.
+func NewBass(gain float64, freq uint) (Effect, error) {
+	return shelf("bass", gain, freq)
+}
+
+// NewTreble returns a treble shelving filter effect (e.g. "treble -3.000 3000").
+//
+// gain is in dB (-60 to 60) and freq is the center frequency in Hz.
+func NewTreble(gain float64, freq uint) (Effect, error) {
+	return shelf("treble", gain, freq)
+}
+
+func shelf(name string, gain float64, freq uint) (Effect, error) {
+	err := param.FirstErr(
+		param.InRange(ErrInvalidEffect, name, "gain", gain, -60, 60),
+		param.Positive(ErrInvalidEffect, name, "freq", float64(freq)),
+	)
+	if err != nil {
+		return "", err
+	}
+	return Effect(fmt.Sprintf("%s %.3f %d", name, gain, freq)), nil
+}
+
+// NewHighpass returns a two-pole high-pass filter effect (e.g. "highpass 80 0.707q").
+func NewHighpass(freq uint, q float64) (Effect, error) {
+	return biquad("highpass", freq, q)
+}
+
+// NewLowpass returns a two-pole low-pass filter effect (e.g. "lowpass 8000 0.707q").
+func NewLowpass(freq uint, q float64) (Effect, error) {
+	return biquad("lowpass", freq, q)
+}
+
+// NewBandpass returns a band-pass filter effect (e.g. "bandpass 1000 2.000q").
+func NewBandpass(freq uint, q float64) (Effect, error) {
+	return biquad("bandpass", freq, q)
+}
+
+// NewBandreject returns a band-reject filter effect (e.g. "bandreject 50 10.000q").
+func NewBandreject(freq uint, q float64) (Effect, error) {
+	return biquad("bandreject", freq, q)
+}
+
+func biquad(name string, freq uint, q float64) (Effect, error) {
+	err := param.FirstErr(
+		param.Positive(ErrInvalidEffect, name, "freq", float64(freq)),
+		param.Positive(ErrInvalidEffect, name, "q", q),
+	)
+	if err != nil {
+		return "", err
+	}
+	return Effect(fmt.Sprintf("%s %d %.3fq", name, freq, q)), nil
+}
+
+// CompandPoint is a point of the transfer function of compand (in dB).
+type CompandPoint struct {
+	In, Out float64
+}
+
+// NewCompand returns a compressor/expander effect
+// (e.g. "compand 0.010,0.200 -60.000,-60.000,-30.000,-15.000,0.000,-5.000 0.000").
+//
+// attack and decay must not be negative, points must be in ascending order of In,
+// and In and Out must not be greater than 0 dB. gain is the output gain in dB.
+func NewCompand(attack, decay time.Duration, points []CompandPoint, gain float64) (Effect, error) {
+	const name = "compand"
+	if attack < 0 || decay < 0 {
+		return "", errors.Wrapf(ErrInvalidEffect, "%s: attack %v and decay %v must not be negative", name, attack, decay)
+	}
+	if len(points) == 0 {
+		return "", errors.Wrapf(ErrInvalidEffect, "%s: no points", name)
+	}
+	ps := make([]string, 0, len(points)*2)
+	for i, p := range points {
+		err := param.FirstErr(
+			param.InRange(ErrInvalidEffect, name, "in", p.In, math.Inf(-1), 0),
+			param.InRange(ErrInvalidEffect, name, "out", p.Out, math.Inf(-1), 0),
+		)
+		if err != nil {
+			return "", err
+		}
+		if i > 0 && p.In <= points[i-1].In {
+			return "", errors.Wrapf(ErrInvalidEffect, "%s: points are not in ascending order (%v after %v)", name, p.In, points[i-1].In)
+		}
+		ps = append(ps, fmt.Sprintf("%.3f,%.3f", p.In, p.Out))
+	}
+	if err := param.Finite(ErrInvalidEffect, name, "gain", gain); err != nil {
+		return "", err
+	}
+	return Effect(fmt.Sprintf("%s %.3f,%.3f %s %.3f", name, attack.Seconds(), decay.Seconds(), strings.Join(ps, ","), gain)), nil
+}
+
+// NewReverb returns a reverb effect (e.g. "reverb 50.000 50.000 100.000 100.000 0.000 0.000").
+//
+// reverberance, hfDamping, roomScale and stereoDepth are in % (0 to 100),
+// preDelay is up to 500ms and wetGain is in dB (-10 to 10).
+func NewReverb(reverberance, hfDamping, roomScale, stereoDepth float64, preDelay time.Duration, wetGain float64) (Effect, error) {
+	const name = "reverb"
+	err := param.FirstErr(
+		param.InRange(ErrInvalidEffect, name, "reverberance", reverberance, 0, 100),
+		param.InRange(ErrInvalidEffect, name, "hfDamping", hfDamping, 0, 100),
+		param.InRange(ErrInvalidEffect, name, "roomScale", roomScale, 0, 100),
+		param.InRange(ErrInvalidEffect, name, "stereoDepth", stereoDepth, 0, 100),
+		param.InRange(ErrInvalidEffect, name, "preDelay", param.Ms(preDelay), 0, 500),
+		param.InRange(ErrInvalidEffect, name, "wetGain", wetGain, -10, 10),
+	)
+	if err != nil {
+		return "", err
+	}
+	return Effect(fmt.Sprintf("%s %.3f %.3f %.3f %.3f %.3f %.3f", name, reverberance, hfDamping, roomScale, stereoDepth, param.Ms(preDelay), wetGain)), nil
+}
+
+// EchoTap is a delayed copy of the input used by echo.
+type EchoTap struct {
+	Delay time.Duration
+	Decay float64 // 0 to 1
+}
+
+// NewEcho returns an echo effect (e.g. "echo 0.800 0.900 100.000 0.300").
+//
+// gainIn and gainOut are 0 to 1, and at least one tap is required.
+func NewEcho(gainIn, gainOut float64, taps ...EchoTap) (Effect, error) {
+	const name = "echo"
+	err := param.FirstErr(
+		param.InRange(ErrInvalidEffect, name, "gainIn", gainIn, 0, 1),
+		param.InRange(ErrInvalidEffect, name, "gainOut", gainOut, 0, 1),
+	)
+	if err != nil {
+		return "", err
+	}
+	if len(taps) == 0 {
+		return "", errors.Wrapf(ErrInvalidEffect, "%s: no taps", name)
+	}
+	s := fmt.Sprintf("%s %.3f %.3f", name, gainIn, gainOut)
+	for _, tap := range taps {
+		err := param.FirstErr(
+			param.Positive(ErrInvalidEffect, name, "delay", param.Ms(tap.Delay)),
+			param.InRange(ErrInvalidEffect, name, "decay", tap.Decay, 0, 1),
+		)
+		if err != nil {
+			return "", err
+		}
+		s += fmt.Sprintf(" %.3f %.3f", param.Ms(tap.Delay), tap.Decay)
+	}
+	return Effect(s), nil
+}
+
+// ChorusVoice is a voice of chorus.
+type ChorusVoice struct {
+	Delay    time.Duration // 20ms to 100ms
+	Decay    float64       // 0 to 1
+	Speed    float64       // the modulation speed in Hz (0.1 to 5)
+	Depth    time.Duration // the modulation depth (up to 10ms)
+	Triangle bool          // triangular modulation (default: sinusoidal)
+}
+
+// NewChorus returns a chorus effect (e.g. "chorus 0.700 0.900 55.000 0.400 0.250 2.000 -t").
+//
+// gainIn and gainOut are 0 to 1, and at least one voice is required.
+func NewChorus(gainIn, gainOut float64, voices ...ChorusVoice) (Effect, error) {
+	const name = "chorus"
+	err := param.FirstErr(
+		param.InRange(ErrInvalidEffect, name, "gainIn", gainIn, 0, 1),
+		param.InRange(ErrInvalidEffect, name, "gainOut", gainOut, 0, 1),
+	)
+	if err != nil {
+		return "", err
+	}
+	if len(voices) == 0 {
+		return "", errors.Wrapf(ErrInvalidEffect, "%s: no voices", name)
+	}
+	s := fmt.Sprintf("%s %.3f %.3f", name, gainIn, gainOut)
+	for _, v := range voices {
+		err := param.FirstErr(
+			param.InRange(ErrInvalidEffect, name, "delay", param.Ms(v.Delay), 20, 100),
+			param.InRange(ErrInvalidEffect, name, "decay", v.Decay, 0, 1),
+			param.InRange(ErrInvalidEffect, name, "speed", v.Speed, 0.1, 5),
+			param.InRange(ErrInvalidEffect, name, "depth", param.Ms(v.Depth), 0, 10),
+		)
+		if err != nil {
+			return "", err
+		}
+		s += fmt.Sprintf(" %.3f %.3f %.3f %.3f %s", param.Ms(v.Delay), v.Decay, v.Speed, param.Ms(v.Depth), modulation(v.Triangle))
+	}
+	return Effect(s), nil
+}
+
+func modulation(triangle bool) string {
+	if triangle {
+		return "-t"
+	}
+	return "-s"
+}
+
+// NewFlanger returns a flanger effect (e.g. "flanger 0.000 2.000 0.000 71.000 0.500").
+//
+// delay is up to 30ms, depth is up to 10ms, regen is in % (-95 to 95),
+// width is in % (0 to 100) and speed is in Hz (0.1 to 10).
+func NewFlanger(delay, depth time.Duration, regen, width, speed float64) (Effect, error) {
+	const name = "flanger"
+	err := param.FirstErr(
+		param.InRange(ErrInvalidEffect, name, "delay", param.Ms(delay), 0, 30),
+		param.InRange(ErrInvalidEffect, name, "depth", param.Ms(depth), 0, 10),
+		param.InRange(ErrInvalidEffect, name, "regen", regen, -95, 95),
+		param.InRange(ErrInvalidEffect, name, "width", width, 0, 100),
+		param.InRange(ErrInvalidEffect, name, "speed", speed, 0.1, 10),
+	)
+	if err != nil {
+		return "", err
+	}
+	return Effect(fmt.Sprintf("%s %.3f %.3f %.3f %.3f %.3f", name, param.Ms(delay), param.Ms(depth), regen, width, speed)), nil
+}
+
+// NewPhaser returns a phaser effect (e.g. "phaser 0.800 0.740 3.000 0.400 0.500 -t").
+//
+// gainIn is 0 to 1, gainOut is 0 to 1e9, delay is up to 5ms,
+// decay is 0 to 0.99 and speed is in Hz (0.1 to 2).
+func NewPhaser(gainIn, gainOut float64, delay time.Duration, decay, speed float64, triangle bool) (Effect, error) {
+	const name = "phaser"
+	err := param.FirstErr(
+		param.InRange(ErrInvalidEffect, name, "gainIn", gainIn, 0, 1),
+		param.InRange(ErrInvalidEffect, name, "gainOut", gainOut, 0, 1e9),
+		param.InRange(ErrInvalidEffect, name, "delay", param.Ms(delay), 0, 5),
+		param.InRange(ErrInvalidEffect, name, "decay", decay, 0, 0.99),
+		param.InRange(ErrInvalidEffect, name, "speed", speed, 0.1, 2),
+	)
+	if err != nil {
+		return "", err
+	}
+	return Effect(fmt.Sprintf("%s %.3f %.3f %.3f %.3f %.3f %s", name, gainIn, gainOut, param.Ms(delay), decay, speed, modulation(triangle))), nil
+}
+
+// NewTremolo returns a tremolo effect (e.g. "tremolo 6.000 40.000").
+//
+// speed is in Hz and depth is in % (0 to 100).
+func NewTremolo(speed, depth float64) (Effect, error) {
+	const name = "tremolo"
+	err := param.FirstErr(
+		param.Positive(ErrInvalidEffect, name, "speed", speed),
+		param.InRange(ErrInvalidEffect, name, "depth", depth, 0, 100),
+	)
+	if err != nil {
+		return "", err
+	}
+	return Effect(fmt.Sprintf("%s %.3f %.3f", name, speed, depth)), nil
+}
+
+// NewPitch returns a pitch shift effect (e.g. "pitch -300.000").
+//
+// shift is in cents (-2400 to 2400) and the tempo is not changed.
+func NewPitch(shift float64) (Effect, error) {
+	if err := param.InRange(ErrInvalidEffect, "pitch", "shift", shift, -2400, 2400); err != nil {
+		return "", err
+	}
+	return Effect(fmt.Sprintf("pitch %.3f", shift)), nil
+}
+
+// NewTempo returns a tempo effect (e.g. "tempo 1.100").
+//
+// factor is the ratio of the new tempo (0.1 to 10) and the pitch is not changed.
+func NewTempo(factor float64) (Effect, error) {
+	if err := param.InRange(ErrInvalidEffect, "tempo", "factor", factor, 0.1, 10); err != nil {
+		return "", err
+	}
+	return Effect(fmt.Sprintf("tempo %.3f", factor)), nil
+}
+
+// NewSpeed returns a speed effect that changes both the pitch and the tempo (e.g. "speed 1.100").
+//
+// factor is the ratio of the new speed (0.1 to 10).
+func NewSpeed(factor float64) (Effect, error) {
+	if err := param.InRange(ErrInvalidEffect, "speed", "factor", factor, 0.1, 10); err != nil {
+		return "", err
+	}
+	return Effect(fmt.Sprintf("speed %.3f", factor)), nil
+}
+
+// NewRemix returns a remix effect (e.g. "remix 1,2 1,2").
+//
+// Each element of outs lists the input channels (1-based) mixed into an output channel;
+// an empty list makes the channel silent.
+//
+// NOTE: the number of output channels must match Command.OutChannels.
+func NewRemix(outs ...[]int) (Effect, error) {
+	const name = "remix"
+	if len(outs) == 0 {
+		return "", errors.Wrapf(ErrInvalidEffect, "%s: no output channels", name)
+	}
+	ss := make([]string, len(outs))
+	for i, ins := range outs {
+		if len(ins) == 0 {
+			ss[i] = "0"
+			continue
+		}
+		cs := make([]string, len(ins))
+		for j, c := range ins {
+			if c < 1 {
+				return "", errors.Wrapf(ErrInvalidEffect, "%s: input channel %d must be positive", name, c)
+			}
+			cs[j] = strconv.Itoa(c)
+		}
+		ss[i] = strings.Join(cs, ",")
+	}
+	return Effect(name + " " + strings.Join(ss, " ")), nil
+}
+
+// NewChannels returns a channels effect (e.g. "channels 2").
+//
+// NOTE: n must match Command.OutChannels.
+func NewChannels(n int) (Effect, error) {
+	if n < 1 {
+		return "", errors.Wrapf(ErrInvalidEffect, "channels: %d must be positive", n)
+	}
+	return Effect(fmt.Sprintf("channels %d", n)), nil
+}
+
+// NewRate returns a sample rate conversion effect (e.g. "rate 44100").
+//
+// NOTE: rate must match Command.OutRate.
+func NewRate(rate int) (Effect, error) {
+	if rate < 1 {
+		return "", errors.Wrapf(ErrInvalidEffect, "rate: %d must be positive", rate)
+	}
+	return Effect(fmt.Sprintf("rate %d", rate)), nil
+}
+
+// NewDither returns a dither effect ("dither", or "dither -s" with noise shaping).
+func NewDither(shaped bool) Effect {
+	if shaped {
+		return "dither -s"
+	}
+	return "dither"
+}
+
+// NewNorm returns a normalize effect (e.g. "norm -1.000").
+//
+// level is the target peak level in dB (up to 0).
+//
+// NOTE: SoX buffers the whole input to normalize it.
+func NewNorm(level float64) (Effect, error) {
+	if err := param.InRange(ErrInvalidEffect, "norm", "level", level, math.Inf(-1), 0); err != nil {
+		return "", err
+	}
+	return Effect(fmt.Sprintf("norm %.3f", level)), nil
+}
+
+// NewLoudness returns a loudness control effect (e.g. "loudness -10.000 65.000").
+//
+// gain is in dB (-50 to 15) and reference is in dB (50 to 75).
+func NewLoudness(gain, reference float64) (Effect, error) {
+	const name = "loudness"
+	err := param.FirstErr(
+		param.InRange(ErrInvalidEffect, name, "gain", gain, -50, 15),
+		param.InRange(ErrInvalidEffect, name, "reference", reference, 50, 75),
+	)
+	if err != nil {
+		return "", err
+	}
+	return Effect(fmt.Sprintf("%s %.3f %.3f", name, gain, reference)), nil
+}
+
+// FadeShape is the shape of fade.
+type FadeShape string
+
+const (
+	FadeQuarterSine FadeShape = "q"
+	FadeHalfSine    FadeShape = "h"
+	FadeLinear      FadeShape = "t"
+	FadeLogarithmic FadeShape = "l"
+	FadeParabola    FadeShape = "p"
+)
+
+// NewFade returns a fade effect (e.g. "fade t 1.000 10.000 2.000").
+//
+// in is the length of the fade-in. stop is the position where the fade-out ends
+// and out is the length of the fade-out; both are omitted if stop is 0.
+func NewFade(shape FadeShape, in, stop, out time.Duration) (Effect, error) {
+	const name = "fade"
+	switch shape {
+	case FadeQuarterSine, FadeHalfSine, FadeLinear, FadeLogarithmic, FadeParabola:
+	default:
+		return "", errors.Wrapf(ErrInvalidEffect, "%s: unknown shape %q", name, shape)
+	}
+	if in < 0 || stop < 0 || out < 0 {
+		return "", errors.Wrapf(ErrInvalidEffect, "%s: in %v, stop %v and out %v must not be negative", name, in, stop, out)
+	}
+	if stop == 0 {
+		return Effect(fmt.Sprintf("%s %s %.3f", name, shape, in.Seconds())), nil
+	}
+	if in+out > stop {
+		return "", errors.Wrapf(ErrInvalidEffect, "%s: in %v and out %v overlap before stop %v", name, in, out, stop)
+	}
+	return Effect(fmt.Sprintf("%s %s %.3f %.3f %.3f", name, shape, in.Seconds(), stop.Seconds(), out.Seconds())), nil
+}
+
+// NewSilence returns a silence effect that removes every silence longer than duration
+// (e.g. "silence 1 0.100 1.000% -1 0.100 1.000%").
+//
+// threshold is the level regarded as silence in % (0 to 100).
+func NewSilence(duration time.Duration, threshold float64) (Effect, error) {
+	const name = "silence"
+	err := param.FirstErr(
+		param.Positive(ErrInvalidEffect, name, "duration", duration.Seconds()),
+		param.InRange(ErrInvalidEffect, name, "threshold", threshold, 0, 100),
+	)
+	if err != nil {
+		return "", err
+	}
+	d := duration.Seconds()
+	return Effect(fmt.Sprintf("%s 1 %.3f %.3f%% -1 %.3f %.3f%%", name, d, threshold, d, threshold)), nil
+}
+
+// NewVol returns a volume effect (e.g. "vol -6.000dB").
+//
+// gain is in dB.
+func NewVol(gain float64) (Effect, error) {
+	if err := param.Finite(ErrInvalidEffect, "vol", "gain", gain); err != nil {
+		return "", err
+	}
+	return Effect(fmt.Sprintf("vol %.3fdB", gain)), nil
+}
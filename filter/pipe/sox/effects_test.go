@@ -0,0 +1,90 @@
+package sox_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ebiiim/eq/filter/pipe/sox"
+	"github.com/pkg/errors"
+)
+
+func TestNewEffects(t *testing.T) {
+	cases := []struct {
+		name  string
+		fn    func() (sox.Effect, error)
+		want  string
+		isErr bool
+	}{
+		{"bass", func() (sox.Effect, error) { return sox.NewBass(3, 100) }, "bass 3.000 100", false},
+		{"bass_gain", func() (sox.Effect, error) { return sox.NewBass(61, 100) }, "", true},
+		{"treble_freq", func() (sox.Effect, error) { return sox.NewTreble(-3, 0) }, "", true},
+		{"highpass", func() (sox.Effect, error) { return sox.NewHighpass(80, 0.707) }, "highpass 80 0.707q", false},
+		{"lowpass_q", func() (sox.Effect, error) { return sox.NewLowpass(8000, 0) }, "", true},
+		{"bandreject", func() (sox.Effect, error) { return sox.NewBandreject(50, 10) }, "bandreject 50 10.000q", false},
+		{"compand", func() (sox.Effect, error) {
+			return sox.NewCompand(10*time.Millisecond, 200*time.Millisecond, []sox.CompandPoint{{-60, -60}, {-30, -15}, {0, -5}}, 0)
+		}, "compand 0.010,0.200 -60.000,-60.000,-30.000,-15.000,0.000,-5.000 0.000", false},
+		{"compand_order", func() (sox.Effect, error) {
+			return sox.NewCompand(0, 0, []sox.CompandPoint{{-30, -30}, {-60, -60}}, 0)
+		}, "", true},
+		{"compand_positive", func() (sox.Effect, error) { return sox.NewCompand(0, 0, []sox.CompandPoint{{3, 0}}, 0) }, "", true},
+		{"reverb", func() (sox.Effect, error) { return sox.NewReverb(50, 50, 100, 100, 20*time.Millisecond, -3) }, "reverb 50.000 50.000 100.000 100.000 20.000 -3.000", false},
+		{"reverb_nan", func() (sox.Effect, error) { return sox.NewReverb(math.NaN(), 50, 100, 100, 0, 0) }, "", true},
+		{"echo", func() (sox.Effect, error) {
+			return sox.NewEcho(0.8, 0.9, sox.EchoTap{100 * time.Millisecond, 0.3}, sox.EchoTap{200 * time.Millisecond, 0.25})
+		}, "echo 0.800 0.900 100.000 0.300 200.000 0.250", false},
+		{"echo_no_taps", func() (sox.Effect, error) { return sox.NewEcho(0.8, 0.9) }, "", true},
+		{"chorus", func() (sox.Effect, error) {
+			return sox.NewChorus(0.7, 0.9, sox.ChorusVoice{55 * time.Millisecond, 0.4, 0.25, 2 * time.Millisecond, true})
+		}, "chorus 0.700 0.900 55.000 0.400 0.250 2.000 -t", false},
+		{"chorus_delay", func() (sox.Effect, error) {
+			return sox.NewChorus(0.7, 0.9, sox.ChorusVoice{5 * time.Millisecond, 0.4, 0.25, 2 * time.Millisecond, false})
+		}, "", true},
+		{"flanger", func() (sox.Effect, error) { return sox.NewFlanger(0, 2*time.Millisecond, 0, 71, 0.5) }, "flanger 0.000 2.000 0.000 71.000 0.500", false},
+		{"phaser", func() (sox.Effect, error) { return sox.NewPhaser(0.8, 0.74, 3*time.Millisecond, 0.4, 0.5, false) }, "phaser 0.800 0.740 3.000 0.400 0.500 -s", false},
+		{"phaser_decay", func() (sox.Effect, error) { return sox.NewPhaser(0.8, 0.74, 3*time.Millisecond, 1, 0.5, false) }, "", true},
+		{"tremolo", func() (sox.Effect, error) { return sox.NewTremolo(6, 40) }, "tremolo 6.000 40.000", false},
+		{"pitch", func() (sox.Effect, error) { return sox.NewPitch(-300) }, "pitch -300.000", false},
+		{"tempo_zero", func() (sox.Effect, error) { return sox.NewTempo(0) }, "", true},
+		{"speed", func() (sox.Effect, error) { return sox.NewSpeed(1.1) }, "speed 1.100", false},
+		{"remix", func() (sox.Effect, error) { return sox.NewRemix([]int{1, 2}, nil) }, "remix 1,2 0", false},
+		{"remix_channel", func() (sox.Effect, error) { return sox.NewRemix([]int{0}) }, "", true},
+		{"channels", func() (sox.Effect, error) { return sox.NewChannels(1) }, "channels 1", false},
+		{"rate_zero", func() (sox.Effect, error) { return sox.NewRate(0) }, "", true},
+		{"dither", func() (sox.Effect, error) { return sox.NewDither(true), nil }, "dither -s", false},
+		{"norm", func() (sox.Effect, error) { return sox.NewNorm(-1) }, "norm -1.000", false},
+		{"norm_positive", func() (sox.Effect, error) { return sox.NewNorm(1) }, "", true},
+		{"loudness", func() (sox.Effect, error) { return sox.NewLoudness(-10, 65) }, "loudness -10.000 65.000", false},
+		{"fade_in", func() (sox.Effect, error) { return sox.NewFade(sox.FadeLinear, time.Second, 0, 0) }, "fade t 1.000", false},
+		{"fade", func() (sox.Effect, error) {
+			return sox.NewFade(sox.FadeHalfSine, time.Second, 10*time.Second, 2*time.Second)
+		}, "fade h 1.000 10.000 2.000", false},
+		{"fade_overlap", func() (sox.Effect, error) {
+			return sox.NewFade(sox.FadeLinear, 5*time.Second, 6*time.Second, 2*time.Second)
+		}, "", true},
+		{"fade_shape", func() (sox.Effect, error) { return sox.NewFade("x", time.Second, 0, 0) }, "", true},
+		{"silence", func() (sox.Effect, error) { return sox.NewSilence(100*time.Millisecond, 1) }, "silence 1 0.100 1.000% -1 0.100 1.000%", false},
+		{"vol", func() (sox.Effect, error) { return sox.NewVol(-6) }, "vol -6.000dB", false},
+		{"vol_inf", func() (sox.Effect, error) { return sox.NewVol(math.Inf(1)) }, "", true},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := c.fn()
+			if !((err != nil) == c.isErr) {
+				t.Errorf("got %v, want %v(isErr) ", err, c.isErr)
+			}
+			if c.isErr {
+				if errors.Cause(err) != sox.ErrInvalidEffect {
+					t.Errorf("got %v want %v", err, sox.ErrInvalidEffect)
+				}
+				return
+			}
+			if string(got) != c.want {
+				t.Errorf("got %v want %v", got, c.want)
+			}
+		})
+	}
+}
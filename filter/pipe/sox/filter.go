@@ -0,0 +1,369 @@
+package sox
+
+import (
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/ebiiim/eq/filter"
+	"github.com/ebiiim/eq/filter/pipe"
+	"github.com/ebiiim/eq/pcm"
+	"github.com/pkg/errors"
+)
+
+// Filter is a filter.Filter running a SoX command
+// that can be replaced while running without audio dropout.
+//
+// Swap starts the new command in the background,
+// feeds it with the same input as the current one,
+// and crossfades from the old output to the new one.
+type Filter struct {
+	// Command is the SoX command to start with (required).
+	//
+	// Use Swap to change the command after the first Read or Write.
+	Command *Command
+
+	// Crossfade is the length of the crossfade on Swap (default: 50ms).
+	//
+	// Crossfade is only applied to signed 16-bit output;
+	// other formats are switched without it.
+	Crossfade time.Duration
+
+	initOnce sync.Once
+	initErr  error
+	wg       sync.WaitGroup // retired processes
+	writeMu  sync.Mutex     // serializes Write and the start of swaps
+
+	mu      sync.Mutex // guards the fields below
+	cur     *proc
+	next    *proc    // the replacement (nil if not swapping)
+	swapAt  int64    // cur.out where next.out starts
+	pending *Command // swapped in after the current swap
+	swapErr error    // the error of starting pending
+	mixBuf  []byte
+	closed  bool
+}
+
+// proc is a running command with byte counters.
+type proc struct {
+	f   *pipe.Filter
+	in  int64 // bytes written
+	out int64 // bytes read
+}
+
+func newProc(cmd *Command) (*proc, error) {
+	f := &pipe.Filter{Args: cmd.Args(), InFormat: cmd.InputFormat(), OutFormat: cmd.OutputFormat()}
+	err := f.Start()
+	if err != nil {
+		return nil, err
+	}
+	return &proc{f: f}, nil
+}
+
+func (f *Filter) initialize() error {
+	if f.Command == nil {
+		return errors.New("sox.Filter.Command is nil")
+	}
+	if f.Crossfade == 0 {
+		f.Crossfade = 50 * time.Millisecond
+	}
+	p, err := newProc(f.Command)
+	if err != nil {
+		return err
+	}
+	f.cur = p
+	return nil
+}
+
+func (f *Filter) start() error {
+	f.initOnce.Do(func() { f.initErr = f.initialize() })
+	return f.initErr
+}
+
+// Swap replaces the running command with cmd.
+//
+// The input and output formats of cmd must be the same as the current ones.
+// The function starts cmd and returns immediately;
+// the output switches after the data written so far are processed by the old command.
+// If a swap is in progress, cmd is started after it (only the last one is kept)
+// and the function returns the error of starting the previous pending command, if any.
+func (f *Filter) Swap(cmd *Command) error {
+	if cmd == nil {
+		return errors.New("could not swap to a nil command")
+	}
+	err := f.start()
+	if err != nil {
+		return err
+	}
+	if !cmd.InputFormat().Equal(f.Command.InputFormat()) || !cmd.OutputFormat().Equal(f.Command.OutputFormat()) {
+		return errors.Wrapf(pcm.ErrMismatch, "could not swap %v -> %v to %v -> %v",
+			f.Command.InputFormat(), f.Command.OutputFormat(), cmd.InputFormat(), cmd.OutputFormat())
+	}
+
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return filter.ErrClosed
+	}
+	if f.next != nil {
+		f.pending = cmd
+		err, f.swapErr = f.swapErr, nil
+		return err
+	}
+	return f.startSwap(cmd)
+}
+
+// startSwap starts cmd as the replacement.
+// It must be called with f.writeMu and f.mu held.
+func (f *Filter) startSwap(cmd *Command) error {
+	p, err := newProc(cmd)
+	if err != nil {
+		return errors.Wrap(err, "could not start the new command")
+	}
+	f.next = p
+	f.swapAt = f.cur.in // assumes that the command does not change the length of data
+	return nil
+}
+
+// Write writes len(b) bytes from b to the running command
+// (and also to the new command during a swap).
+func (f *Filter) Write(b []byte) (n int, err error) {
+	err = f.start()
+	if err != nil {
+		return 0, err
+	}
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return 0, filter.ErrClosed
+	}
+	if f.next == nil && f.pending != nil {
+		f.swapErr = f.startSwap(f.pending)
+		f.pending = nil
+	}
+	cur, next := f.cur, f.next
+	f.mu.Unlock()
+
+	n, err = cur.f.Write(b)
+	f.mu.Lock()
+	cur.in += int64(n)
+	retired := f.cur != cur
+	f.mu.Unlock()
+	if err != nil && !retired {
+		return n, err
+	}
+	if next != nil {
+		m, nErr := next.f.Write(b)
+		f.mu.Lock()
+		next.in += int64(m)
+		if nErr != nil {
+			f.abortSwap(next)
+		}
+		f.mu.Unlock()
+	}
+	return len(b), nil
+}
+
+// Read reads data processed by the running command into b.
+//
+// During a crossfade, the function reads the same length
+// from the old and new commands and mixes them
+// (up to what the old command has output if it exits in the middle).
+func (f *Filter) Read(b []byte) (n int, err error) {
+	err = f.start()
+	if err != nil {
+		return 0, err
+	}
+
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return 0, filter.ErrClosed
+	}
+	cur, next, swapAt := f.cur, f.next, f.swapAt
+	f.mu.Unlock()
+
+	if next == nil || cur.out < swapAt {
+		if next != nil && int64(len(b)) > swapAt-cur.out {
+			b = b[:swapAt-cur.out] // do not mix the data before the swap
+		}
+		n, err = cur.f.Read(b)
+		f.mu.Lock()
+		cur.out += int64(n)
+		f.mu.Unlock()
+		return n, err
+	}
+
+	// crossfade
+	format := cur.f.OutFormat
+	window := f.window(format)
+	m := int64(len(b))
+	if rest := window - next.out; m > rest {
+		m = rest
+	}
+	if fs := int64(format.FrameSize()); fs > 0 {
+		m -= m % fs
+	}
+	if m <= 0 {
+		f.mu.Lock()
+		f.retire(next)
+		f.mu.Unlock()
+		return f.Read(b)
+	}
+
+	n, oErr := io.ReadFull(cur.f, b[:m])
+	f.mu.Lock()
+	cur.out += int64(n)
+	if oErr != nil && n == 0 { // the old command is gone, switches to the new one
+		f.retire(next)
+		f.mu.Unlock()
+		return f.Read(b)
+	}
+	if cap(f.mixBuf) < n {
+		f.mixBuf = make([]byte, n)
+	}
+	nb := f.mixBuf[:n]
+	f.mu.Unlock()
+
+	k, err := io.ReadFull(next.f, nb)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	next.out += int64(k)
+	if err != nil { // the new command is broken, keeps the old one
+		f.abortSwap(next)
+		return n, nil
+	}
+	crossfade(format, b[:n], nb, next.out-int64(k), window)
+	if oErr != nil || next.out >= window { // the old command is gone or the crossfade is done
+		f.retire(next)
+	}
+	return n, nil
+}
+
+// window returns the length of the crossfade in bytes.
+func (f *Filter) window(format pcm.Format) int64 {
+	if format.Encoding != pcm.Signed || format.BitDepth != 16 {
+		return 0
+	}
+	frames := int64(f.Crossfade) * int64(format.SampleRate) / int64(time.Second)
+	return frames * int64(format.FrameSize())
+}
+
+// crossfade mixes nb into b, where pos is the position of nb in the window of length window.
+// b and nb are signed 16-bit.
+func crossfade(format pcm.Format, b, nb []byte, pos, window int64) {
+	fs := int64(format.FrameSize())
+	for i := 0; i+1 < len(b); i += 2 {
+		g := float64(pos+int64(i)-int64(i)%fs) / float64(window) // the gain of the new output (per frame)
+		o := float64(int16(format.ByteOrder.Uint16(b[i:])))
+		n := float64(int16(format.ByteOrder.Uint16(nb[i:])))
+		v := o*(1-g) + n*g
+		if v > 32767 {
+			v = 32767
+		} else if v < -32768 {
+			v = -32768
+		}
+		format.ByteOrder.PutUint16(b[i:], uint16(int16(v)))
+	}
+}
+
+// retire replaces cur with next and closes the old command in the background,
+// unless next is no longer the replacement. It must be called with f.mu held.
+func (f *Filter) retire(next *proc) {
+	if f.next != next {
+		return
+	}
+	old := f.cur
+	f.cur, f.next = f.next, nil
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		old.f.CloseWrite()
+		io.Copy(ioutil.Discard, old.f) // so that the command can exit
+		old.f.Close()
+	}()
+}
+
+// abortSwap discards next, unless next is no longer the replacement.
+// It must be called with f.mu held.
+func (f *Filter) abortSwap(next *proc) {
+	if f.next != next {
+		return
+	}
+	f.next = nil
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		next.f.CloseWrite()
+		io.Copy(ioutil.Discard, next.f)
+		next.f.Close()
+	}()
+}
+
+// CloseWrite closes the input of the running command.
+//
+// A swap in progress is finished immediately:
+// the new command is discarded if the crossfade has not started,
+// and otherwise the old one is.
+func (f *Filter) CloseWrite() error {
+	err := f.start()
+	if err != nil {
+		return err
+	}
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+	f.mu.Lock()
+	f.pending = nil
+	if next := f.next; next != nil && f.cur.out >= f.swapAt {
+		f.retire(next)
+	} else if next != nil {
+		f.abortSwap(next)
+	}
+	cur := f.cur
+	f.mu.Unlock()
+	return cur.f.CloseWrite()
+}
+
+// Close closes the running commands.
+func (f *Filter) Close() error {
+	if f.start() != nil {
+		return nil // not started
+	}
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil
+	}
+	f.closed = true
+	cur, next := f.cur, f.next
+	f.mu.Unlock()
+
+	if next != nil {
+		next.f.Close()
+	}
+	err := cur.f.Close()
+	f.wg.Wait()
+	return err
+}
+
+// InputFormat returns the input format of Command.
+func (f *Filter) InputFormat() pcm.Format {
+	if f.Command == nil {
+		return pcm.Format{}
+	}
+	return f.Command.InputFormat()
+}
+
+// OutputFormat returns the output format of Command.
+func (f *Filter) OutputFormat() pcm.Format {
+	if f.Command == nil {
+		return pcm.Format{}
+	}
+	return f.Command.OutputFormat()
+}
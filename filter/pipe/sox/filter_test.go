@@ -0,0 +1,176 @@
+package sox_test
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ebiiim/eq/filter/pipe/sox"
+	"github.com/ebiiim/eq/pcm"
+	"github.com/pkg/errors"
+)
+
+// stubSoX writes a shell script that ignores SoX options and runs body.
+func stubSoX(t *testing.T, dir, name, body string) string {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	err := ioutil.WriteFile(p, []byte("#!/bin/sh\n"+body+"\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestFilter_Swap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pass := stubSoX(t, dir, "pass", "exec cat")
+	mute := stubSoX(t, dir, "mute", `exec perl -e 'while (sysread(STDIN, $b, 65536)) { syswrite(STDOUT, "\0" x length($b)) }'`)
+
+	const chunk = 2048 // stdbuf -o2048
+	f := &sox.Filter{
+		Command:   &sox.Command{ExecPath: pass, BufferSize: chunk / 2},
+		Crossfade: 10 * time.Millisecond, // 480 frames
+	}
+	defer f.Close()
+
+	in := make([]byte, chunk)
+	for i := 0; i < len(in); i += 2 {
+		binary.LittleEndian.PutUint16(in[i:], 1000)
+	}
+	var got []int16
+	for i := 0; i < 8; i++ {
+		if i == 2 {
+			err = f.Swap(&sox.Command{ExecPath: mute, BufferSize: chunk / 2})
+			if err != nil {
+				t.Fatalf("could not swap: %v", err)
+			}
+		}
+		_, err = f.Write(in)
+		if err != nil {
+			t.Fatalf("could not write: %v", err)
+		}
+		b := make([]byte, chunk)
+		_, err = io.ReadFull(f, b)
+		if err != nil {
+			t.Fatalf("could not read: %v", err)
+		}
+		for j := 0; j < len(b); j += 2 {
+			got = append(got, int16(binary.LittleEndian.Uint16(b[j:])))
+		}
+	}
+
+	// 1000 until the swap, fades out over 480 frames, and then 0
+	swapAt := 2 * chunk / 2
+	for i, v := range got {
+		var want int16
+		switch {
+		case i < swapAt:
+			want = 1000
+		case i < swapAt+480*2:
+			if v > got[i-1] || v < 0 || v > 1000 {
+				t.Fatalf("not fading at sample %d: %d after %d", i, v, got[i-1])
+			}
+			continue
+		}
+		if v != want {
+			t.Fatalf("got %d want %d at sample %d", v, want, i)
+		}
+	}
+	if mid := got[swapAt+480]; mid < 400 || mid > 600 {
+		t.Errorf("got %d want about 500 in the middle of the crossfade", mid)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Errorf("could not close: %v", err)
+	}
+}
+
+func TestFilter_SwapOldExits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	const chunk = 2048
+	short := stubSoX(t, dir, "short", "exec head -c 2560") // exits in the middle of the crossfade
+	mute := stubSoX(t, dir, "mute", `exec perl -e 'while (sysread(STDIN, $b, 65536)) { syswrite(STDOUT, "\0" x length($b)) }'`)
+
+	f := &sox.Filter{
+		Command:   &sox.Command{ExecPath: short, BufferSize: chunk / 2},
+		Crossfade: 10 * time.Millisecond, // 1920 bytes
+	}
+	defer f.Close()
+
+	in := make([]byte, chunk)
+	for i := 0; i < len(in); i += 2 {
+		binary.LittleEndian.PutUint16(in[i:], 1000)
+	}
+	b := make([]byte, 2*chunk)
+	_, err = f.Write(in)
+	if err != nil {
+		t.Fatalf("could not write: %v", err)
+	}
+	_, err = io.ReadFull(f, b[:chunk])
+	if err != nil {
+		t.Fatalf("could not read: %v", err)
+	}
+	err = f.Swap(&sox.Command{ExecPath: mute, BufferSize: chunk / 2})
+	if err != nil {
+		t.Fatalf("could not swap: %v", err)
+	}
+	_, err = f.Write(in)
+	if err != nil {
+		t.Fatalf("could not write: %v", err)
+	}
+	_, err = io.ReadFull(f, b[chunk:])
+	if err != nil {
+		t.Fatalf("could not read: %v", err)
+	}
+
+	// the 512 bytes of the old command fade out, and then the new one follows
+	for i := chunk; i < len(b); i += 2 {
+		v := int16(binary.LittleEndian.Uint16(b[i:]))
+		if fading := i < chunk+512; (fading && (v <= 0 || v > 1000)) || (!fading && v != 0) {
+			t.Fatalf("got %d at byte %d", v, i)
+		}
+	}
+}
+
+func TestFilter_SwapMismatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pass := stubSoX(t, dir, "pass", "exec cat")
+
+	f := &sox.Filter{Command: &sox.Command{ExecPath: pass}}
+	defer f.Close()
+	err = f.Swap(&sox.Command{ExecPath: pass, OutChannels: sox.Mono})
+	if errors.Cause(err) != pcm.ErrMismatch {
+		t.Errorf("got %v want %v", err, pcm.ErrMismatch)
+	}
+}
+
+func TestFilter_SwapNil(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pass := stubSoX(t, dir, "pass", "exec cat")
+
+	f := &sox.Filter{Command: &sox.Command{ExecPath: pass}}
+	defer f.Close()
+	if err := f.Swap(nil); err == nil {
+		t.Error("got nil want error")
+	}
+}
@@ -0,0 +1,236 @@
+package sox
+
+import (
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/ebiiim/eq/filter/pipe"
+	"github.com/pkg/errors"
+)
+
+// effectNames is the set of SoX effects that Parse recognizes (all effects of SoX 14.4).
+var effectNames = map[string]bool{
+	"allpass": true, "band": true, "bandpass": true, "bandreject": true, "bass": true, "bend": true,
+	"biquad": true, "channels": true, "chorus": true, "compand": true, "contrast": true,
+	"dcshift": true, "deemph": true, "delay": true, "dither": true, "divide": true,
+	"downsample": true, "earwax": true, "echo": true, "echos": true, "equalizer": true, "fade": true,
+	"fir": true, "firfit": true, "flanger": true, "gain": true, "highpass": true, "hilbert": true,
+	"ladspa": true, "loudness": true, "lowpass": true, "mcompand": true, "noiseprof": true,
+	"noisered": true, "norm": true, "oops": true, "overdrive": true, "pad": true, "phaser": true,
+	"pitch": true, "rate": true, "remix": true, "repeat": true, "reverb": true, "reverse": true,
+	"riaa": true, "silence": true, "sinc": true, "spectrogram": true, "speed": true, "splice": true,
+	"stat": true, "stats": true, "stretch": true, "swap": true, "synth": true, "tempo": true,
+	"treble": true, "tremolo": true, "trim": true, "upsample": true, "vad": true, "vol": true,
+}
+
+// Parse parses a SoX command line (e.g. "sox -traw -b16 ... - -traw ... - gain -3")
+// into a Command, so that Parse(c.String()) returns the same command as c.
+//
+// Both the input and the output must be stdin/stdout ("-"),
+// and only the format options (-t -b -r -c -e -B -L and their long forms),
+// --buffer and -V are allowed besides the files.
+// A leading stdbuf (as Command.String adds on Linux) is skipped,
+// and on Linux, NoStdbuf is set if there is none.
+// Effects are split at the names of SoX effects, so their arguments must not contain spaces.
+func Parse(s string) (*Command, error) {
+	args, err := pipe.SplitCommand(s)
+	if err != nil {
+		return nil, err
+	}
+	stdbuf := len(args) > 0 && filepath.Base(args[0]) == "stdbuf"
+	if stdbuf {
+		args = skipStdbufOptions(args[1:])
+	}
+	if len(args) == 0 {
+		return nil, errors.New("empty command")
+	}
+
+	// Command.String adds stdbuf on Linux unless NoStdbuf is set
+	cmd := &Command{ExecPath: args[0], NoStdbuf: runtime.GOOS == "linux" && !stdbuf}
+	var files int // the number of files seen
+	for i := 1; i < len(args); i++ {
+		a := args[i]
+		if !strings.HasPrefix(a, "-") || a == "-" {
+			if files == 2 {
+				cmd.Effects, err = parseEffects(args[i:])
+				if err != nil {
+					return nil, err
+				}
+				break
+			}
+			if a != "-" {
+				return nil, errors.Errorf("unsupported file %q (only - is supported)", a)
+			}
+			files++
+			continue
+		}
+
+		name, value, hasValue := splitOption(a)
+		next := func() (string, error) {
+			if hasValue {
+				return value, nil
+			}
+			if i+1 >= len(args) {
+				return "", errors.Errorf("option %s needs a value", a)
+			}
+			i++
+			return args[i], nil
+		}
+		if name == "-V" {
+			continue // Command always uses -V0
+		}
+		if name == "--buffer" {
+			v, err := next()
+			if err != nil {
+				return nil, err
+			}
+			cmd.BufferSize, err = strconv.Atoi(v)
+			if err != nil || cmd.BufferSize <= 0 {
+				return nil, errors.Errorf("invalid --buffer %q", v)
+			}
+			continue
+		}
+		if files == 2 {
+			return nil, errors.Errorf("unsupported option %s after the output file", a)
+		}
+		typ, ch, rate, bit, enc, bo := &cmd.InFormat, &cmd.InChannels, &cmd.InRate, &cmd.InBit, &cmd.InEncode, &cmd.InByteOrder
+		if files == 1 {
+			typ, ch, rate, bit, enc, bo = &cmd.OutFormat, &cmd.OutChannels, &cmd.OutRate, &cmd.OutBit, &cmd.OutEncode, &cmd.OutByteOrder
+		}
+		switch name {
+		case "-B", "-L":
+			*bo = Option(name)
+			continue
+		case "-t", "--type", "-b", "--bits", "-r", "--rate", "-c", "--channels", "-e", "--encoding", "--endian":
+		default:
+			return nil, errors.Errorf("unsupported option %s", a)
+		}
+		v, err := next()
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "-t", "--type":
+			*typ = Option(v)
+		case "-b", "--bits":
+			*bit, err = parseInt(name, v)
+		case "-r", "--rate":
+			*rate, err = parseRate(v)
+		case "-c", "--channels":
+			*ch, err = parseInt(name, v)
+		case "-e", "--encoding":
+			*enc, err = parseEncoding(v)
+		case "--endian":
+			*bo, err = parseEndian(v)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if files < 2 {
+		return nil, errors.New("the input and output files (-) are required")
+	}
+	return cmd, nil
+}
+
+// skipStdbufOptions skips the options of stdbuf (e.g. "-o4096", "-o 4096" or "--output=4096").
+func skipStdbufOptions(args []string) []string {
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		a := args[0]
+		args = args[1:]
+		if a == "--" {
+			break
+		}
+		if _, _, hasValue := splitOption(a); !hasValue && len(args) > 0 {
+			args = args[1:] // -i, -o, -e and their long forms take a value
+		}
+	}
+	return args
+}
+
+// splitOption splits "-tVALUE", "--type=VALUE" or "--type" into the name and the value.
+func splitOption(a string) (name, value string, ok bool) {
+	if strings.HasPrefix(a, "--") {
+		if i := strings.IndexByte(a, '='); i >= 0 {
+			return a[:i], a[i+1:], true
+		}
+		return a, "", false
+	}
+	if len(a) > 2 {
+		return a[:2], a[2:], true
+	}
+	return a, "", false
+}
+
+func parseInt(name, v string) (Option, error) {
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return "", errors.Errorf("invalid %s %q", name, v)
+	}
+	return Option(strconv.Itoa(n)), nil
+}
+
+// parseRate parses a sample rate with an optional k suffix (e.g. "48k").
+func parseRate(v string) (Option, error) {
+	mul := 1.0
+	s := v
+	if strings.HasSuffix(s, "k") {
+		mul, s = 1000, strings.TrimSuffix(s, "k")
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	r := int(f * mul)
+	if err != nil || r <= 0 || float64(r) != f*mul {
+		return "", errors.Errorf("invalid rate %q", v)
+	}
+	return Option(strconv.Itoa(r)), nil
+}
+
+// parseEncoding parses an encoding (e.g. "signed" or "signed-integer").
+func parseEncoding(v string) (Option, error) {
+	switch v {
+	case "signed", "signed-integer":
+		return EncSigned, nil
+	case "unsigned", "unsigned-integer":
+		return EncUnsigned, nil
+	case "floating", "floating-point":
+		return EncFloat, nil
+	}
+	return "", errors.Errorf("unsupported encoding %q", v)
+}
+
+func parseEndian(v string) (Option, error) {
+	switch v {
+	case "little":
+		return EndianLittle, nil
+	case "big":
+		return EndianBig, nil
+	}
+	return "", errors.Errorf("unsupported endian %q", v)
+}
+
+// parseEffects splits args into effects at the names of SoX effects.
+func parseEffects(args []string) ([]Effect, error) {
+	var (
+		effects []Effect
+		cur     []string
+	)
+	for _, a := range args {
+		if strings.ContainsAny(a, " \t\n") {
+			return nil, errors.Errorf("unsupported effect argument with spaces %q", a)
+		}
+		if effectNames[a] {
+			if cur != nil {
+				effects = append(effects, Effect(strings.Join(cur, " ")))
+			}
+			cur = []string{a}
+			continue
+		}
+		if cur == nil {
+			return nil, errors.Errorf("unknown effect %q", a)
+		}
+		cur = append(cur, a)
+	}
+	return append(effects, Effect(strings.Join(cur, " "))), nil
+}
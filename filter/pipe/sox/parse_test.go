@@ -0,0 +1,97 @@
+package sox_test
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/ebiiim/eq/filter/pipe/sox"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestParse(t *testing.T) {
+	linux := runtime.GOOS == "linux" // without stdbuf, NoStdbuf is set on Linux
+	cases := []struct {
+		name  string
+		s     string
+		want  *sox.Command
+		isErr bool
+	}{
+		{"default", "sox -traw -b16 -r48000 -c2 -esigned -L - -traw -b16 -r48000 -c2 -esigned -L - --buffer 8192 -V0",
+			&sox.Command{ExecPath: "sox", BufferSize: 8192, NoStdbuf: linux,
+				InFormat: sox.FmtRAW, InBit: sox.Bit16, InRate: sox.Rate48k, InChannels: sox.Stereo, InEncode: sox.EncSigned, InByteOrder: sox.EndianLittle,
+				OutFormat: sox.FmtRAW, OutBit: sox.Bit16, OutRate: sox.Rate48k, OutChannels: sox.Stereo, OutEncode: sox.EncSigned, OutByteOrder: sox.EndianLittle,
+			}, false},
+		{"stdbuf_effects", "stdbuf -o16384 /usr/bin/sox -t raw - -t raw - gain -3.000 equalizer 1000 5.000q -10.000 fade t 1.000",
+			&sox.Command{ExecPath: "/usr/bin/sox", InFormat: sox.FmtRAW, OutFormat: sox.FmtRAW,
+				Effects: []sox.Effect{"gain -3.000", "equalizer 1000 5.000q -10.000", "fade t 1.000"},
+			}, false},
+		{"long_options", "sox --type=raw --bits 24 --rate=96k --channels 1 --encoding signed-integer --endian big - --type raw -e floating-point -b32 -r 44.1k - rate -h 44100",
+			&sox.Command{ExecPath: "sox", NoStdbuf: linux,
+				InFormat: sox.FmtRAW, InBit: sox.Bit24, InRate: sox.Rate96k, InChannels: sox.Mono, InEncode: sox.EncSigned, InByteOrder: sox.EndianBig,
+				OutFormat: sox.FmtRAW, OutBit: sox.Bit32, OutRate: sox.Rate44100, OutEncode: sox.EncFloat,
+				Effects: []sox.Effect{"rate -h 44100"},
+			}, false},
+		{"quoted_path", "'/opt/my sox/sox' - -", &sox.Command{ExecPath: "/opt/my sox/sox", NoStdbuf: linux}, false},
+		{"stdbuf_separate_values", "stdbuf -o 4096 -e0 --input L sox - -", &sox.Command{ExecPath: "sox"}, false},
+		{"stdbuf_long_options", "/usr/bin/stdbuf --output=4096 -- sox - -", &sox.Command{ExecPath: "sox"}, false},
+		{"more_effects", "sox - - gain -3 stats synth sine 440 noisered profile 0.2",
+			&sox.Command{ExecPath: "sox", NoStdbuf: linux,
+				Effects: []sox.Effect{"gain -3", "stats", "synth sine 440", "noisered profile 0.2"},
+			}, false},
+		{"empty", "", nil, true},
+		{"file", "sox in.wav -", nil, true},
+		{"no_output", "sox -", nil, true},
+		{"unknown_option", "sox -x - -", nil, true},
+		{"unknown_effect", "sox - - foo 1", nil, true},
+		{"bad_rate", "sox -r48kHz - -", nil, true},
+		{"bad_encoding", "sox -e mu-law - -", nil, true},
+		{"no_value", "sox - - --buffer", nil, true},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := sox.Parse(c.s)
+			if !((err != nil) == c.isErr) {
+				t.Errorf("got %v, want %v(isErr) ", err, c.isErr)
+			}
+			if c.isErr {
+				return
+			}
+			if diff := cmp.Diff(c.want, got, cmpopts.IgnoreUnexported(sox.Command{})); diff != "" {
+				t.Errorf("(-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParse_RoundTrip(t *testing.T) {
+	eq, _ := sox.NewHighpass(80, 0.707)
+	cases := []struct {
+		name string
+		cmd  *sox.Command
+	}{
+		{"default", &sox.Command{}},
+		{"effects", &sox.Command{ExecPath: "/opt/my sox/sox", BufferSize: 1024, Effects: []sox.Effect{sox.NewGain(-3), sox.NewEQ(1000, 5, -10), eq}}},
+		{"no_stdbuf", &sox.Command{NoStdbuf: true}},
+		{"formats", &sox.Command{InChannels: sox.Mono, InBit: sox.Bit24, InByteOrder: sox.EndianBig, OutRate: sox.Rate96k, OutEncode: sox.EncFloat, OutBit: sox.Bit32}},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			want := c.cmd.String()
+			parsed, err := sox.Parse(want)
+			if err != nil {
+				t.Fatalf("could not parse %v: %v", want, err)
+			}
+			if got := parsed.String(); got != want {
+				t.Errorf("got %v\nwant  %v", got, want)
+			}
+			if runtime.GOOS == "linux" && parsed.NoStdbuf != c.cmd.NoStdbuf {
+				t.Errorf("got NoStdbuf %v, want %v", parsed.NoStdbuf, c.cmd.NoStdbuf)
+			}
+		})
+	}
+}
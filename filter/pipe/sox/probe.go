@@ -0,0 +1,153 @@
+package sox
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrUnsupported is returned by Capabilities.Check for a command that the SoX can not run.
+var ErrUnsupported = errors.New("unsupported by sox")
+
+// Capabilities describes an installed SoX.
+type Capabilities struct {
+	ExecPath string
+	Version  string   // e.g. "14.4.2" (empty if unknown)
+	Formats  []string // supported file formats (sorted)
+	Effects  []string // supported effects (sorted)
+	Stdbuf   bool     // true if stdbuf is available (always false except on Linux)
+}
+
+var (
+	probeMu    sync.Mutex
+	probeCache = map[string]*Capabilities{}
+)
+
+// Probe runs "sox --version" and "sox -h" to find the capabilities of the SoX at execPath
+// ("sox" if empty).
+//
+// The result is cached, so the commands run only once for each execPath.
+// The function returns an error if the SoX could not be run.
+func Probe(execPath string) (*Capabilities, error) {
+	if execPath == "" {
+		execPath = "sox"
+	}
+	probeMu.Lock()
+	defer probeMu.Unlock()
+	if c, ok := probeCache[execPath]; ok {
+		return c, nil
+	}
+
+	version, err := run(execPath, "--version")
+	if err != nil {
+		return nil, err
+	}
+	help, err := run(execPath, "-h")
+	if err != nil {
+		return nil, err
+	}
+	c := &Capabilities{ExecPath: execPath, Version: parseVersion(version)}
+	c.Formats, c.Effects = parseHelp(help)
+	if runtime.GOOS == "linux" {
+		_, err = exec.LookPath("stdbuf")
+		c.Stdbuf = err == nil
+	}
+	probeCache[execPath] = c
+	return c, nil
+}
+
+// run runs the command and returns its stdout.
+//
+// NOTE: some versions of SoX exit with a non-zero status for -h,
+// so the status is ignored if the command has printed something.
+func run(execPath string, args ...string) ([]byte, error) {
+	out, err := exec.Command(execPath, args...).Output()
+	if _, ok := err.(*exec.ExitError); ok && len(out) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not run %s %s", execPath, strings.Join(args, " "))
+	}
+	return out, nil
+}
+
+// parseVersion finds the version in the output of "sox --version" (e.g. "sox:      SoX v14.4.2").
+func parseVersion(b []byte) string {
+	for _, f := range strings.Fields(string(b)) {
+		if len(f) > 1 && f[0] == 'v' && f[1] >= '0' && f[1] <= '9' {
+			return f[1:]
+		}
+	}
+	return ""
+}
+
+// parseHelp finds the lists of formats and effects in the output of "sox -h"
+// (e.g. "AUDIO FILE FORMATS: raw wav" and "EFFECTS: gain reverb").
+func parseHelp(b []byte) (formats, effects []string) {
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := s.Text()
+		switch {
+		case strings.HasPrefix(line, "AUDIO FILE FORMATS:"):
+			formats = names(strings.TrimPrefix(line, "AUDIO FILE FORMATS:"))
+		case strings.HasPrefix(line, "EFFECTS:"):
+			effects = names(strings.TrimPrefix(line, "EFFECTS:"))
+		}
+	}
+	return formats, effects
+}
+
+// names splits s into sorted names, removing marks (e.g. "*" of deprecated effects).
+func names(s string) []string {
+	ns := strings.Fields(s)
+	for i, n := range ns {
+		ns[i] = strings.TrimRight(n, "*")
+	}
+	sort.Strings(ns)
+	return ns
+}
+
+func contains(sorted []string, s string) bool {
+	i := sort.SearchStrings(sorted, s)
+	return i < len(sorted) && sorted[i] == s
+}
+
+// HasFormat returns true if the file format is supported.
+func (c *Capabilities) HasFormat(format Option) bool {
+	return contains(c.Formats, string(format))
+}
+
+// HasEffect returns true if the effect is supported.
+func (c *Capabilities) HasEffect(name string) bool {
+	return contains(c.Effects, name)
+}
+
+// Check returns an error wrapping ErrUnsupported if the SoX can not run cmd,
+// i.e. cmd uses unsupported formats or effects, or needs stdbuf that is not available.
+func (c *Capabilities) Check(cmd *Command) error {
+	cmd.initOnce.Do(cmd.setDefaults)
+	for _, f := range []Option{cmd.InFormat, cmd.OutFormat} {
+		if !c.HasFormat(f) {
+			return errors.Wrapf(ErrUnsupported, "format %s", f)
+		}
+	}
+	for _, e := range cmd.Effects {
+		fs := strings.Fields(string(e))
+		if len(fs) == 0 {
+			continue
+		}
+		if !c.HasEffect(fs[0]) {
+			return errors.Wrapf(ErrUnsupported, "effect %s", fs[0])
+		}
+	}
+	if runtime.GOOS == "linux" && !cmd.NoStdbuf && !c.Stdbuf {
+		return errors.Wrap(ErrUnsupported, "stdbuf is not found (set Command.NoStdbuf)")
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package sox_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ebiiim/eq/filter/pipe/sox"
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+func TestProbe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stub := stubSoX(t, dir, "sox", `case "$1" in
+--version) echo "sox:      SoX v14.4.2" ;;
+-h) printf 'SoX v14.4.2\n\nAUDIO FILE FORMATS: wav raw flac\nPLAYLIST FORMATS: m3u pls\nEFFECTS: gain equalizer reverb oops*\n'; exit 1 ;;
+esac`)
+
+	c, err := sox.Probe(stub)
+	if err != nil {
+		t.Fatalf("could not probe: %v", err)
+	}
+	if c.Version != "14.4.2" {
+		t.Errorf("got %v want %v", c.Version, "14.4.2")
+	}
+	if diff := cmp.Diff([]string{"flac", "raw", "wav"}, c.Formats); diff != "" {
+		t.Errorf("Formats (-want +got)\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"equalizer", "gain", "oops", "reverb"}, c.Effects); diff != "" {
+		t.Errorf("Effects (-want +got)\n%s", diff)
+	}
+	if c2, _ := sox.Probe(stub); c2 != c {
+		t.Errorf("not cached")
+	}
+
+	cases := []struct {
+		name  string
+		cmd   *sox.Command
+		isErr bool
+	}{
+		{"ok", &sox.Command{NoStdbuf: true, Effects: []sox.Effect{sox.NewGain(-3), sox.NewEQ(1000, 5, -3)}}, false},
+		{"effect", &sox.Command{NoStdbuf: true, Effects: []sox.Effect{"tempo 1.1"}}, true},
+		{"format", &sox.Command{NoStdbuf: true, OutFormat: sox.FmtMP3}, true},
+	}
+	for _, c2 := range cases {
+		c2 := c2
+		t.Run(c2.name, func(t *testing.T) {
+			t.Parallel()
+			err := c.Check(c2.cmd)
+			if !((err != nil) == c2.isErr) {
+				t.Errorf("got %v, want %v(isErr) ", err, c2.isErr)
+			}
+			if c2.isErr && errors.Cause(err) != sox.ErrUnsupported {
+				t.Errorf("got %v want %v", err, sox.ErrUnsupported)
+			}
+		})
+	}
+}
+
+func TestProbe_NotFound(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = sox.Probe(filepath.Join(dir, "sox"))
+	if err == nil {
+		t.Errorf("got nil want an error")
+	}
+}
@@ -3,9 +3,15 @@
 package sox
 
 import (
+	"encoding/binary"
 	"fmt"
 	"runtime"
+	"strconv"
+	"strings"
 	"sync"
+
+	"github.com/ebiiim/eq/filter/pipe"
+	"github.com/ebiiim/eq/pcm"
 )
 
 type Option string
@@ -24,68 +30,184 @@ type Command struct {
 	initOnce                                                         sync.Once
 	ExecPath                                                         string
 	BufferSize                                                       int
+	NoStdbuf                                                         bool // do not use stdbuf on Linux (see Capabilities.Stdbuf)
 	InFormat, InChannels, InRate, InBit, InEncode, InByteOrder       Option
 	OutFormat, OutChannels, OutRate, OutBit, OutEncode, OutByteOrder Option
 	Effects                                                          []Effect
 }
 
 // String convert the Command object to an executable sox command.
+//
+// Arguments are quoted if needed (see pipe.SplitCommand).
 func (s *Command) String() string {
-	s.initOnce.Do(func() {
-		if s.ExecPath == "" {
-			s.ExecPath = "sox"
-		}
-		if s.BufferSize == 0 {
-			s.BufferSize = 8192 // --buffer N (default: 8192)
-		}
-		if s.InFormat == "" {
-			s.InFormat = FmtRAW
-		}
-		if s.InChannels == "" {
-			s.InChannels = Stereo
-		}
-		if s.InRate == "" {
-			s.InRate = Rate48k
-		}
-		if s.InBit == "" {
-			s.InBit = Bit16
-		}
-		if s.InEncode == "" {
-			s.InEncode = EncSigned
-		}
-		if s.InByteOrder == "" {
-			s.InByteOrder = EndianLittle
-		}
-		if s.OutFormat == "" {
-			s.OutFormat = FmtRAW
-		}
-		if s.OutChannels == "" {
-			s.OutChannels = Stereo
-		}
-		if s.OutRate == "" {
-			s.OutRate = Rate48k
-		}
-		if s.OutBit == "" {
-			s.OutBit = Bit16
-		}
-		if s.OutEncode == "" {
-			s.OutEncode = EncSigned
-		}
-		if s.OutByteOrder == "" {
-			s.OutByteOrder = EndianLittle
-		}
-	})
-
-	cmdIn := fmt.Sprintf("-t%s -b%s -r%s -c%s -e%s %s -", s.InFormat, s.InBit, s.InRate, s.InChannels, s.InEncode, s.InByteOrder)
-	cmdOut := fmt.Sprintf("-t%s -b%s -r%s -c%s -e%s %s -", s.OutFormat, s.OutBit, s.OutRate, s.OutChannels, s.OutEncode, s.OutByteOrder)
-	cmdStr := fmt.Sprintf("%s %s %s --buffer %d -V0", s.ExecPath, cmdIn, cmdOut, s.BufferSize)
-	if runtime.GOOS == "linux" {
-		cmdStr = fmt.Sprintf("stdbuf -o%d %s", s.BufferSize*2, cmdStr)
+	return pipe.JoinCommand(s.Args())
+}
+
+// Args convert the Command object to the execPath and args of a sox command,
+// which can be passed to pipe.Filter.Args directly.
+//
+// Arguments of each effect are separated by spaces.
+func (s *Command) Args() []string {
+	s.initOnce.Do(s.setDefaults)
+
+	var args []string
+	if runtime.GOOS == "linux" && !s.NoStdbuf {
+		args = append(args, "stdbuf", fmt.Sprintf("-o%d", s.BufferSize*2))
 	}
+	args = append(args, s.ExecPath)
+	args = append(args, fmtArgs(s.InFormat, s.InBit, s.InRate, s.InChannels, s.InEncode, s.InByteOrder)...)
+	args = append(args, fmtArgs(s.OutFormat, s.OutBit, s.OutRate, s.OutChannels, s.OutEncode, s.OutByteOrder)...)
+	args = append(args, "--buffer", strconv.Itoa(s.BufferSize), "-V0")
 	for _, e := range s.Effects {
-		cmdStr += " " + string(e)
+		args = append(args, strings.Fields(string(e))...)
+	}
+	return args
+}
+
+// fmtArgs returns format options of a file ("-" means stdin or stdout).
+func fmtArgs(typ, bit, rate, ch, enc, bo Option) []string {
+	return []string{"-t" + string(typ), "-b" + string(bit), "-r" + string(rate), "-c" + string(ch), "-e" + string(enc), string(bo), "-"}
+}
+
+func (s *Command) setDefaults() {
+	if s.ExecPath == "" {
+		s.ExecPath = "sox"
+	}
+	if s.BufferSize == 0 {
+		s.BufferSize = 8192 // --buffer N (default: 8192)
+	}
+	if s.InFormat == "" {
+		s.InFormat = FmtRAW
+	}
+	if s.InChannels == "" {
+		s.InChannels = Stereo
+	}
+	if s.InRate == "" {
+		s.InRate = Rate48k
+	}
+	if s.InBit == "" {
+		s.InBit = Bit16
+	}
+	if s.InEncode == "" {
+		s.InEncode = EncSigned
+	}
+	if s.InByteOrder == "" {
+		s.InByteOrder = EndianLittle
+	}
+	if s.OutFormat == "" {
+		s.OutFormat = FmtRAW
+	}
+	if s.OutChannels == "" {
+		s.OutChannels = Stereo
+	}
+	if s.OutRate == "" {
+		s.OutRate = Rate48k
+	}
+	if s.OutBit == "" {
+		s.OutBit = Bit16
+	}
+	if s.OutEncode == "" {
+		s.OutEncode = EncSigned
+	}
+	if s.OutByteOrder == "" {
+		s.OutByteOrder = EndianLittle
+	}
+}
+
+// InputFormat returns the format of the stream that the command reads.
+//
+// The function returns the zero pcm.Format if the options can not be converted
+// (e.g. the input is not a raw stream).
+func (s *Command) InputFormat() pcm.Format {
+	s.initOnce.Do(s.setDefaults)
+	return toFormat(s.InFormat, s.InChannels, s.InRate, s.InBit, s.InEncode, s.InByteOrder)
+}
+
+// OutputFormat returns the format of the stream that the command writes.
+//
+// The function returns the zero pcm.Format if the options can not be converted
+// (e.g. the output is not a raw stream).
+func (s *Command) OutputFormat() pcm.Format {
+	s.initOnce.Do(s.setDefaults)
+	return toFormat(s.OutFormat, s.OutChannels, s.OutRate, s.OutBit, s.OutEncode, s.OutByteOrder)
+}
+
+// SetInputFormat sets the input options (as a raw stream) from f.
+func (s *Command) SetInputFormat(f pcm.Format) (err error) {
+	s.InChannels, s.InRate, s.InBit, s.InEncode, s.InByteOrder, err = fromFormat(f)
+	if err != nil {
+		return err
+	}
+	s.InFormat = FmtRAW
+	return nil
+}
+
+// SetOutputFormat sets the output options (as a raw stream) from f.
+func (s *Command) SetOutputFormat(f pcm.Format) (err error) {
+	s.OutChannels, s.OutRate, s.OutBit, s.OutEncode, s.OutByteOrder, err = fromFormat(f)
+	if err != nil {
+		return err
+	}
+	s.OutFormat = FmtRAW
+	return nil
+}
+
+func toFormat(typ, ch, rate, bit, enc, bo Option) pcm.Format {
+	if typ != FmtRAW {
+		return pcm.Format{}
+	}
+	var f pcm.Format
+	var err error
+	if f.Channels, err = strconv.Atoi(string(ch)); err != nil {
+		return pcm.Format{}
+	}
+	if f.SampleRate, err = strconv.Atoi(string(rate)); err != nil {
+		return pcm.Format{}
+	}
+	if f.BitDepth, err = strconv.Atoi(string(bit)); err != nil {
+		return pcm.Format{}
+	}
+	switch enc {
+	case EncSigned:
+		f.Encoding = pcm.Signed
+	case EncUnsigned:
+		f.Encoding = pcm.Unsigned
+	case EncFloat:
+		f.Encoding = pcm.Float
+	default:
+		return pcm.Format{}
+	}
+	switch bo {
+	case EndianLittle:
+		f.ByteOrder = binary.LittleEndian
+	case EndianBig:
+		f.ByteOrder = binary.BigEndian
+	default:
+		return pcm.Format{}
+	}
+	return f
+}
+
+func fromFormat(f pcm.Format) (ch, rate, bit, enc, bo Option, err error) {
+	if err = f.Validate(); err != nil {
+		return "", "", "", "", "", err
+	}
+	ch = Option(strconv.Itoa(f.Channels))
+	rate = Option(strconv.Itoa(f.SampleRate))
+	bit = Option(strconv.Itoa(f.BitDepth))
+	switch f.Encoding {
+	case pcm.Signed:
+		enc = EncSigned
+	case pcm.Unsigned:
+		enc = EncUnsigned
+	case pcm.Float:
+		enc = EncFloat
+	}
+	bo = EndianLittle
+	if f.ByteOrder != nil && f.ByteOrder.String() == binary.BigEndian.String() {
+		bo = EndianBig
 	}
-	return cmdStr
+	return ch, rate, bit, enc, bo, nil
 }
 
 // Effect is a sox effect that can be used with Command.
@@ -1,10 +1,15 @@
 package sox_test
 
 import (
+	"encoding/binary"
 	"runtime"
+	"strings"
 	"testing"
 
+	"github.com/ebiiim/eq/filter/pipe"
 	"github.com/ebiiim/eq/filter/pipe/sox"
+	"github.com/ebiiim/eq/pcm"
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestNewSoXGain(t *testing.T) {
@@ -79,3 +84,90 @@ func TestSoX_Cmd(t *testing.T) {
 		})
 	}
 }
+
+func TestCommand_InputFormat(t *testing.T) {
+	cases := []struct {
+		name string
+		cmd  *sox.Command
+		want pcm.Format
+	}{
+		{"default", &sox.Command{}, pcm.Default},
+		{"s24be_mono", &sox.Command{InChannels: sox.Mono, InBit: sox.Bit24, InByteOrder: sox.EndianBig}, pcm.Format{Channels: 1, SampleRate: 48000, BitDepth: 24, Encoding: pcm.Signed, ByteOrder: binary.BigEndian}},
+		{"flac", &sox.Command{InFormat: sox.FmtFLAC}, pcm.Format{}},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			got := c.cmd.InputFormat()
+			if !got.Equal(c.want) {
+				t.Errorf("got %v want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestCommand_SetOutputFormat(t *testing.T) {
+	cases := []struct {
+		name   string
+		format pcm.Format
+		want   string
+		isErr  bool
+	}{
+		{"default", pcm.Default, "-traw -b16 -r48000 -c2 -esigned -L -", false},
+		{"f32_mono_96k", pcm.Format{Channels: 1, SampleRate: 96000, BitDepth: 32, Encoding: pcm.Float, ByteOrder: binary.BigEndian}, "-traw -b32 -r96000 -c1 -efloating -B -", false},
+		{"F_invalid", pcm.Format{}, "", true},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			cmd := &sox.Command{}
+			err := cmd.SetOutputFormat(c.format)
+			if !((err != nil) == c.isErr) {
+				t.Errorf("got %v, want %v(isErr) ", err, c.isErr)
+			}
+			if c.isErr {
+				return
+			}
+			got := cmd.String()
+			if !strings.Contains(got, "- "+c.want+" --buffer") {
+				t.Errorf("got %v\nwant  ...%v...", got, c.want)
+			}
+			if !cmd.OutputFormat().Equal(c.format) {
+				t.Errorf("got %v want %v", cmd.OutputFormat(), c.format)
+			}
+		})
+	}
+}
+
+func TestCommand_Args(t *testing.T) {
+	cases := []struct {
+		name string
+		cmd  *sox.Command
+		want []string
+	}{
+		{"default", &sox.Command{}, []string{"sox", "-traw", "-b16", "-r48000", "-c2", "-esigned", "-L", "-", "-traw", "-b16", "-r48000", "-c2", "-esigned", "-L", "-", "--buffer", "8192", "-V0"}},
+		{"path_with_space", &sox.Command{ExecPath: "/opt/my sox/sox", Effects: []sox.Effect{sox.NewGain(-3)}}, []string{"/opt/my sox/sox", "-traw", "-b16", "-r48000", "-c2", "-esigned", "-L", "-", "-traw", "-b16", "-r48000", "-c2", "-esigned", "-L", "-", "--buffer", "8192", "-V0", "gain", "-3.000"}},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			got := c.cmd.Args()
+			if runtime.GOOS == "linux" {
+				c.want = append([]string{"stdbuf", "-o16384"}, c.want...)
+			}
+			if diff := cmp.Diff(c.want, got); diff != "" {
+				t.Errorf("(-want +got)\n%s", diff)
+			}
+			split, err := pipe.SplitCommand(c.cmd.String())
+			if err != nil {
+				t.Fatalf("could not split String(): %v", err)
+			}
+			if diff := cmp.Diff(got, split); diff != "" {
+				t.Errorf("String() does not match Args() (-Args +String)\n%s", diff)
+			}
+		})
+	}
+}
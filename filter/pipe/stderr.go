@@ -0,0 +1,92 @@
+package pipe
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"sync"
+)
+
+// stderrSize is the number of bytes of stderr that Filter keeps.
+const stderrSize = 4096
+
+// Error is an error of the external application with its stderr.
+type Error struct {
+	Op     string // the operation that failed (e.g. "write", "read", "close")
+	Err    error
+	Stderr string // the last output of stderr (up to 4KB)
+}
+
+func (e *Error) Error() string {
+	s := e.Op + ": " + e.Err.Error()
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		s += ": stderr: " + stderr
+	}
+	return s
+}
+
+// Cause returns the underlying error for errors.Cause.
+func (e *Error) Cause() error {
+	return e.Err
+}
+
+// stderrWriter keeps the last stderrSize bytes written,
+// and prints each line to logger if it is not nil.
+type stderrWriter struct {
+	mu     sync.Mutex
+	buf    []byte
+	line   []byte // an incomplete line
+	logger *log.Logger
+	prefix string
+}
+
+func (w *stderrWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, b...)
+	if over := len(w.buf) - stderrSize; over > 0 {
+		w.buf = append(w.buf[:0], w.buf[over:]...)
+	}
+
+	if w.logger != nil {
+		w.line = append(w.line, b...)
+		for {
+			i := bytes.IndexByte(w.line, '\n')
+			if i < 0 {
+				break
+			}
+			w.logger.Printf("%s: %s", w.prefix, w.line[:i])
+			w.line = w.line[i+1:]
+		}
+		if len(w.line) > stderrSize { // a too long line
+			w.logger.Printf("%s: %s", w.prefix, w.line)
+			w.line = w.line[:0]
+		}
+	}
+	return len(b), nil
+}
+
+// flush prints the incomplete line.
+func (w *stderrWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.logger != nil && len(w.line) > 0 {
+		w.logger.Printf("%s: %s", w.prefix, w.line)
+		w.line = w.line[:0]
+	}
+}
+
+func (w *stderrWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return string(w.buf)
+}
+
+// wrapError returns err as an *Error with stderr.
+func (f *Filter) wrapError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Op: op, Err: err, Stderr: f.stderr.String()}
+}
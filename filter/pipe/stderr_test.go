@@ -0,0 +1,63 @@
+package pipe_test
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/ebiiim/eq/filter/pipe"
+	"github.com/pkg/errors"
+)
+
+func TestFilter_Stderr(t *testing.T) {
+	cases := []struct {
+		name       string
+		args       []string
+		wantStderr string // suffix
+		wantLog    string
+		isErr      bool
+	}{
+		{"ok", []string{"sh", "-c", "echo warning >&2; cat"}, "warning\n", "sh: warning\n", false},
+		{"F_exit", []string{"sh", "-c", "echo 'sox FAIL equalizer: usage' >&2; printf 'no newline' >&2; exit 2"}, "usage\nno newline", "sh: sox FAIL equalizer: usage\nsh: no newline\n", true},
+		{"F_bounded", []string{"sh", "-c", "i=0; while [ $i -lt 500 ]; do echo 0123456789 >&2; i=$((i+1)); done; echo last >&2; exit 1"}, "0123456789\nlast\n", "", true},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			var logBuf bytes.Buffer
+			f := pipe.Filter{Args: c.args, Logger: log.New(&logBuf, "", 0)}
+			f.Write([]byte("in")) // may fail if the command exits first
+			err := f.Close()
+			if !((err != nil) == c.isErr) {
+				t.Errorf("got %v, want %v(isErr) ", err, c.isErr)
+			}
+			if c.wantLog != "" && logBuf.String() != c.wantLog {
+				t.Errorf("got log %q want %q", logBuf.String(), c.wantLog)
+			}
+			if !c.isErr {
+				return
+			}
+			pErr, ok := err.(*pipe.Error)
+			if !ok {
+				t.Fatalf("got %T want *pipe.Error", err)
+			}
+			if pErr.Op != "close" {
+				t.Errorf("got Op %q want %q", pErr.Op, "close")
+			}
+			if !strings.HasSuffix(pErr.Stderr, c.wantStderr) {
+				t.Errorf("got Stderr %q want suffix %q", pErr.Stderr, c.wantStderr)
+			}
+			if len(pErr.Stderr) > 4096 {
+				t.Errorf("got Stderr of %d bytes want <= 4096", len(pErr.Stderr))
+			}
+			if !strings.Contains(err.Error(), "stderr: ") {
+				t.Errorf("stderr is not in the message: %v", err)
+			}
+			if errors.Cause(err) == err {
+				t.Errorf("could not unwrap %v", err)
+			}
+		})
+	}
+}
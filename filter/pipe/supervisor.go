@@ -0,0 +1,430 @@
+package pipe
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ebiiim/eq/filter"
+	"github.com/ebiiim/eq/pcm"
+	"github.com/pkg/errors"
+)
+
+// maxStartAttempts is the number of attempts to restart the external application
+// before Supervisor gives up.
+const maxStartAttempts = 10
+
+// RestartEvent describes a restart of the external application by Supervisor.
+type RestartEvent struct {
+	Restarts int           // the number of restarts so far (including this one)
+	Err      error         // the error that stopped the previous application (*Error if it exited abnormally)
+	Silence  int           // the number of bytes of silence inserted for the lost data
+	Attempts int           // the number of attempts to start the new application
+	Downtime time.Duration // the time from the failure to the restart
+}
+
+// Supervisor is a Filter that restarts the external application
+// when it exits unexpectedly (e.g. crashes) in the middle of the stream.
+//
+// Data written to the application that has not come out are lost,
+// so Supervisor inserts silence of the same length
+// to keep the timing of the downstream intact.
+type Supervisor struct {
+	// New returns a new Filter to start (required).
+	//
+	// e.g. func() *pipe.Filter { return &pipe.Filter{Args: cmd.Args()} }
+	//
+	// InFormat and OutFormat of the Filter determine the length and the value of silence.
+	New func() *Filter
+
+	// MinBackoff and MaxBackoff are the range of the delay before restarting (default: 100ms and 5s).
+	//
+	// The delay doubles on each failed start, and is reset
+	// when the application has been running longer than MaxBackoff.
+	// Supervisor gives up after 10 failed starts in a row,
+	// and then Read and Write return the error.
+	MinBackoff, MaxBackoff time.Duration
+
+	// OnRestart is called after each restart (optional).
+	OnRestart func(RestartEvent)
+
+	initOnce  sync.Once
+	closeOnce sync.Once
+	done      chan struct{}
+
+	mu         sync.Mutex    // guards the fields below
+	cur        *Filter       // the running Filter (or the first one not started yet, or the failed one while restarting)
+	gen        int           // incremented on each restart
+	started    time.Time     // the zero value if cur is not started yet
+	restarting chan struct{} // closed when the running restart finishes (nil if not restarting)
+	stopped    bool          // cur has been closed by restart
+	written    int64         // bytes written to cur
+	read       int64         // bytes read from cur
+	delivered  int64         // bytes returned by Read including silence
+	silence    int           // bytes of silence to be read
+	restarts   int
+	backoff    time.Duration
+	writeEOF   bool
+	closeErr   error
+	restartErr error // the last error of starting the application
+}
+
+func (s *Supervisor) initialize() {
+	if s.MinBackoff == 0 {
+		s.MinBackoff = 100 * time.Millisecond
+	}
+	if s.MaxBackoff == 0 {
+		s.MaxBackoff = 5 * time.Second
+	}
+	s.backoff = s.MinBackoff
+	s.done = make(chan struct{})
+}
+
+// Start starts the external application.
+//
+// Calling this function is optional as Read and Write start it implicitly.
+func (s *Supervisor) Start() error {
+	s.initOnce.Do(s.initialize)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, _, err := s.current()
+	return err
+}
+
+// current returns the running Filter and its generation,
+// starting the first one if needed and waiting for the running restart.
+// It must be called with s.mu held (and releases it while waiting).
+func (s *Supervisor) current() (*Filter, int, error) {
+	for s.restarting != nil && !s.isClosed() {
+		ch := s.restarting
+		s.mu.Unlock()
+		select {
+		case <-ch:
+		case <-s.done:
+		}
+		s.mu.Lock()
+	}
+	if s.isClosed() {
+		return nil, 0, filter.ErrClosed
+	}
+	if s.restartErr != nil {
+		return nil, 0, s.restartErr
+	}
+	f, err := s.first()
+	if err != nil {
+		return nil, 0, err
+	}
+	if s.started.IsZero() {
+		err = f.Start()
+		if err != nil {
+			return nil, 0, err
+		}
+		s.started = time.Now()
+	}
+	return f, s.gen, nil
+}
+
+// first returns cur, creating the first Filter (without starting it) if needed.
+// It must be called with s.mu held.
+func (s *Supervisor) first() (*Filter, error) {
+	if s.cur == nil {
+		if s.New == nil {
+			return nil, errors.New("Supervisor.New is nil")
+		}
+		s.cur = s.New()
+	}
+	return s.cur, nil
+}
+
+// Write writes len(b) bytes from b to the external application.
+//
+// If the application has exited, the function restarts it
+// and the data are treated as lost.
+// The function returns filter.ErrClosed after Close.
+func (s *Supervisor) Write(b []byte) (int, error) {
+	s.initOnce.Do(s.initialize)
+	s.mu.Lock()
+	f, gen, err := s.current()
+	s.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := f.Write(b)
+	s.mu.Lock()
+	if gen == s.gen {
+		s.written += int64(n)
+	}
+	s.mu.Unlock()
+	if err == nil {
+		return n, nil
+	}
+	err = s.restart(gen, err, len(b)-n)
+	if err != nil {
+		return n, err
+	}
+	return len(b), nil // lost
+}
+
+// Read reads data processed by the external application into b.
+//
+// If the application has exited before CloseWrite, the function restarts it
+// and fills the lost span with silence.
+// After CloseWrite, the function returns io.EOF when the application exits.
+// The function returns filter.ErrClosed after Close.
+func (s *Supervisor) Read(b []byte) (int, error) {
+	s.initOnce.Do(s.initialize)
+	for {
+		s.mu.Lock()
+		if s.silence > 0 && !s.isClosed() {
+			n := s.fillSilence(b)
+			s.mu.Unlock()
+			return n, nil
+		}
+		f, gen, err := s.current()
+		writeEOF := s.writeEOF
+		s.mu.Unlock()
+		if err != nil {
+			return 0, err
+		}
+
+		n, err := f.Read(b)
+		s.mu.Lock()
+		if gen == s.gen {
+			s.read += int64(n)
+		}
+		s.delivered += int64(n)
+		s.mu.Unlock()
+		if err == nil || (err == io.EOF && writeEOF) {
+			return n, err
+		}
+		if s.isClosed() {
+			return n, filter.ErrClosed
+		}
+		rErr := s.restart(gen, err, 0)
+		if rErr != nil {
+			return n, rErr
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// fillSilence fills b with silence. It must be called with s.mu held.
+func (s *Supervisor) fillSilence(b []byte) int {
+	n := len(b)
+	if n > s.silence {
+		n = s.silence
+	}
+	f := s.cur.OutFormat
+	var off int // the position in the current sample
+	if ss := int64(f.SampleSize()); ss > 0 {
+		off = int(s.delivered % ss)
+	}
+	tmp := make([]byte, off+n)
+	f.FillSilence(tmp)
+	copy(b, tmp[off:])
+	s.silence -= n
+	s.delivered += int64(n)
+	return n
+}
+
+// outLen converts the length of input data to the length of output data
+// using the formats of the current Filter. It must be called with s.mu held.
+func (s *Supervisor) outLen(n int) int {
+	in, out := s.cur.InFormat, s.cur.OutFormat
+	if in.IsZero() || out.IsZero() {
+		return n
+	}
+	frames := int64(n) / int64(in.FrameSize())
+	outFrames := frames * int64(out.SampleRate) / int64(in.SampleRate)
+	return int(outFrames) * out.FrameSize()
+}
+
+// restart closes the Filter of generation gen that failed with cause
+// and starts a new one, unless it has already been restarted.
+// unsent is the number of bytes that could not be written to the Filter.
+//
+// s.mu is not held while closing the Filter and waiting for the backoff,
+// so that Read can return the silence for the lost data meanwhile.
+func (s *Supervisor) restart(gen int, cause error, unsent int) error {
+	s.mu.Lock()
+	if gen != s.gen {
+		s.silence += s.outLen(unsent)
+		s.mu.Unlock()
+		return nil // restarted by another call
+	}
+	if s.isClosed() {
+		s.mu.Unlock()
+		return filter.ErrClosed
+	}
+	failed := time.Now()
+	old := s.cur
+	if failed.Sub(s.started) > s.MaxBackoff {
+		s.backoff = s.MinBackoff
+	}
+	// data in the application are lost
+	lost := s.outLen(int(s.written)+unsent) - int(s.read)
+	if lost < 0 {
+		lost = 0
+	}
+	if fs := int64(old.OutFormat.FrameSize()); fs > 0 {
+		end := s.delivered + int64(s.silence+lost)
+		lost += int((fs - end%fs) % fs) // keep frames aligned
+	}
+	s.silence += lost
+	s.gen++ // other calls of the old generation do not restart it again
+	s.restarting = make(chan struct{})
+	backoff := s.backoff
+	s.mu.Unlock()
+
+	if err := old.Close(); err != nil {
+		cause = err // contains stderr
+	}
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+	var (
+		f        *Filter
+		attempts int
+		err      error
+	)
+	for {
+		attempts++
+		select {
+		case <-time.After(backoff):
+		case <-s.done:
+			s.finishRestart(nil, backoff, nil)
+			return filter.ErrClosed
+		}
+		backoff *= 2
+		if backoff > s.MaxBackoff {
+			backoff = s.MaxBackoff
+		}
+		f = s.New()
+		err = f.Start()
+		if err == nil {
+			break
+		}
+		if attempts >= maxStartAttempts {
+			err = errors.Wrap(err, "could not restart")
+			s.finishRestart(nil, backoff, err)
+			return err
+		}
+	}
+	if err := s.finishRestart(f, backoff, nil); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.restarts++
+	ev := RestartEvent{Restarts: s.restarts, Err: cause, Silence: lost, Attempts: attempts, Downtime: s.started.Sub(failed)}
+	hook := s.OnRestart
+	s.mu.Unlock()
+	if hook != nil {
+		hook(ev)
+	}
+	return nil
+}
+
+// finishRestart swaps in f started by restart (or records err if f is nil),
+// and wakes up the calls waiting for the restart.
+func (s *Supervisor) finishRestart(f *Filter, backoff time.Duration, err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() {
+		close(s.restarting)
+		s.restarting = nil
+	}()
+	s.backoff = backoff
+	if f == nil {
+		s.restartErr = err
+		return err
+	}
+	if s.isClosed() {
+		f.Close() // Close has missed f
+		return filter.ErrClosed
+	}
+	s.cur, s.stopped = f, false
+	s.started = time.Now()
+	s.written, s.read = 0, 0
+	if s.writeEOF {
+		s.cur.CloseWrite()
+	}
+	return nil
+}
+
+// CloseWrite closes the input of the external application.
+//
+// Read returns io.EOF after the application exits
+// (the application is not restarted after CloseWrite).
+func (s *Supervisor) CloseWrite() error {
+	s.initOnce.Do(s.initialize)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, _, err := s.current()
+	if err != nil {
+		return err
+	}
+	s.writeEOF = true
+	return f.CloseWrite()
+}
+
+func (s *Supervisor) isClosed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close closes the external application.
+//
+// A restart in progress is canceled.
+func (s *Supervisor) Close() error {
+	s.initOnce.Do(s.initialize)
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if ch := s.restarting; ch != nil {
+			s.mu.Unlock()
+			<-ch // the restart closes the Filters
+			s.mu.Lock()
+		}
+		if s.cur != nil && !s.stopped {
+			s.closeErr = s.cur.Close()
+		}
+	})
+	return s.closeErr
+}
+
+// InputFormat returns the input format of the Filter.
+//
+// It does not start the external application.
+func (s *Supervisor) InputFormat() pcm.Format {
+	s.initOnce.Do(s.initialize)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.first()
+	if err != nil {
+		return pcm.Format{}
+	}
+	return f.InFormat
+}
+
+// OutputFormat returns the output format of the Filter.
+//
+// It does not start the external application.
+func (s *Supervisor) OutputFormat() pcm.Format {
+	s.initOnce.Do(s.initialize)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.first()
+	if err != nil {
+		return pcm.Format{}
+	}
+	return f.OutFormat
+}
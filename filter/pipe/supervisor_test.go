@@ -0,0 +1,214 @@
+package pipe_test
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ebiiim/eq/filter"
+	"github.com/ebiiim/eq/filter/pipe"
+	"github.com/ebiiim/eq/pcm"
+	"github.com/google/go-cmp/cmp"
+)
+
+// crashOnce returns a Supervisor.New that starts a command
+// crashing after passing two blocks of 4 bytes, and then starts cmd.
+func crashOnce(t *testing.T, dir string, cmd ...string) func() *pipe.Filter {
+	t.Helper()
+	flag := filepath.Join(dir, "crashed")
+	return func() *pipe.Filter {
+		if _, err := os.Stat(flag); err == nil {
+			return &pipe.Filter{Args: cmd}
+		}
+		return &pipe.Filter{Args: []string{"sh", "-c", `touch "$0"; dd bs=4 count=2 status=none; echo crashed >&2; exit 3`, flag}}
+	}
+}
+
+func TestSupervisor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "supervisor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var mu sync.Mutex
+	var events []pipe.RestartEvent
+	s := &pipe.Supervisor{
+		New:        crashOnce(t, dir, "cat"),
+		MinBackoff: time.Millisecond,
+		OnRestart: func(ev pipe.RestartEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, ev)
+		},
+	}
+	defer s.Close()
+
+	var got []byte
+	for _, in := range []string{"aaaa", "bbbb", "cccc", "dddd"} {
+		_, err := s.Write([]byte(in))
+		if err != nil {
+			t.Fatalf("could not write %q: %v", in, err)
+		}
+		b := make([]byte, len(in))
+		_, err = io.ReadFull(s, b)
+		if err != nil {
+			t.Fatalf("could not read %q: %v", in, err)
+		}
+		got = append(got, b...)
+	}
+	want := []byte("aaaabbbb\x00\x00\x00\x00dddd") // "cccc" is lost
+	if !cmp.Equal(got, want) {
+		t.Errorf("got %q want %q", got, want)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 1 {
+		t.Fatalf("got %d events want 1", len(events))
+	}
+	ev := events[0]
+	if ev.Restarts != 1 || ev.Silence != 4 || ev.Attempts != 1 {
+		t.Errorf("got %+v", ev)
+	}
+	pErr, ok := ev.Err.(*pipe.Error)
+	if !ok || pErr.Stderr != "crashed\n" {
+		t.Errorf("got %v want *pipe.Error with stderr", ev.Err)
+	}
+}
+
+func TestSupervisor_CloseWrite(t *testing.T) {
+	s := &pipe.Supervisor{New: func() *pipe.Filter { return &pipe.Filter{Args: []string{"tr", "a-z", "A-Z"}} }}
+	_, err := s.Write([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.CloseWrite()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(s)
+	if err != nil || string(got) != "HELLO" {
+		t.Errorf("got (%q, %v) want (%q, nil)", got, err, "HELLO")
+	}
+	err = s.Close()
+	if err != nil {
+		t.Errorf("could not close: %v", err)
+	}
+	_, err = s.Write([]byte("x"))
+	if err != filter.ErrClosed {
+		t.Errorf("got %v want %v", err, filter.ErrClosed)
+	}
+}
+
+func TestSupervisor_GiveUp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "supervisor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		name       string
+		maxBackoff time.Duration
+		closeAfter time.Duration
+		wantClosed bool
+	}{
+		{"give_up", time.Millisecond, 0, false},
+		{"close_while_waiting", time.Hour, 50 * time.Millisecond, true},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			d := filepath.Join(dir, c.name)
+			os.Mkdir(d, 0755)
+			s := &pipe.Supervisor{
+				New:        crashOnce(t, d, "/nonexistent"),
+				MinBackoff: c.maxBackoff,
+				MaxBackoff: c.maxBackoff,
+			}
+			defer s.Close()
+			if c.closeAfter > 0 {
+				go func() {
+					time.Sleep(c.closeAfter)
+					s.Close()
+				}()
+			}
+			s.Write(make([]byte, 8))
+			_, err := io.ReadFull(s, make([]byte, 16)) // crashes
+			if err == nil {
+				t.Fatal("got nil want error")
+			}
+			if (err == filter.ErrClosed) != c.wantClosed {
+				t.Errorf("got %v want closed %v", err, c.wantClosed)
+			}
+		})
+	}
+}
+
+func TestSupervisor_Formats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "supervisor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var calls int32
+	newFilter := crashOnce(t, dir, "cat")
+	s := &pipe.Supervisor{
+		New: func() *pipe.Filter {
+			atomic.AddInt32(&calls, 1)
+			f := newFilter()
+			f.InFormat, f.OutFormat = pcm.Default, pcm.Default
+			return f
+		},
+		MinBackoff: time.Hour, // the restart waits until Close
+		MaxBackoff: time.Hour,
+	}
+	defer s.Close()
+
+	// the formats are known before starting the application
+	for i := 0; i < 3; i++ {
+		if !s.InputFormat().Equal(pcm.Default) || !s.OutputFormat().Equal(pcm.Default) {
+			t.Fatalf("got %v and %v want %v", s.InputFormat(), s.OutputFormat(), pcm.Default)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "crashed")); err == nil {
+		t.Errorf("the application has been started")
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("New has been called %d times want 1", n)
+	}
+
+	_, err = s.Write(make([]byte, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(s, make([]byte, 16)) // crashes and waits for the restart
+		errCh <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	format := make(chan pcm.Format, 1)
+	go func() { format <- s.OutputFormat() }()
+	select {
+	case f := <-format:
+		if !f.Equal(pcm.Default) {
+			t.Errorf("got %v want %v", f, pcm.Default)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OutputFormat is blocked by the restart")
+	}
+
+	s.Close()
+	if err := <-errCh; err != filter.ErrClosed {
+		t.Errorf("got %v want %v", err, filter.ErrClosed)
+	}
+}
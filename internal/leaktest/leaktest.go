@@ -0,0 +1,56 @@
+// Package leaktest provides a goroutine leak checker for tests.
+package leaktest
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Goroutines returns stack traces of goroutines
+// that are running functions of the package pkg (e.g. "github.com/ebiiim/eq/streamio/alice").
+func Goroutines(pkg string) []string {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, len(buf)*2)
+	}
+	var ss []string
+	for _, s := range strings.Split(string(buf), "\n\n") {
+		if strings.Contains(s, pkg+".") {
+			ss = append(ss, s)
+		}
+	}
+	return ss
+}
+
+// Main runs the tests and then verifies that
+// no goroutines of the package pkg are left running.
+//
+// Use it in TestMain:
+//
+//	func TestMain(m *testing.M) { leaktest.Main(m, "github.com/ebiiim/eq/streamio/alice") }
+func Main(m *testing.M, pkg string) {
+	code := m.Run()
+	if code == 0 {
+		var ss []string
+		for i := 0; i < 100; i++ { // goroutines may take a while to exit
+			if ss = Goroutines(pkg); len(ss) == 0 {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		if len(ss) != 0 {
+			fmt.Fprintf(os.Stderr, "leaktest: %d goroutine(s) leaked\n\n%s\n", len(ss), strings.Join(ss, "\n\n"))
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,51 @@
+// Package param provides checks of the parameters of effects and filters
+// shared by the command generators (sox and ffmpeg).
+package param
+
+import (
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// InRange returns err (wrapped) if v is not in [min, max] (NaN is not in any range).
+//
+// name is the name of the effect or filter, and param is the name of the parameter.
+func InRange(err error, name, param string, v, min, max float64) error {
+	if v >= min && v <= max {
+		return nil
+	}
+	return errors.Wrapf(err, "%s: %s %v is out of range [%v, %v]", name, param, v, min, max)
+}
+
+// Positive returns err (wrapped) if v is not a positive finite number.
+func Positive(err error, name, param string, v float64) error {
+	if v > 0 && !math.IsInf(v, 1) {
+		return nil
+	}
+	return errors.Wrapf(err, "%s: %s %v must be positive", name, param, v)
+}
+
+// Finite returns err (wrapped) if v is NaN or infinite.
+func Finite(err error, name, param string, v float64) error {
+	if !math.IsNaN(v) && !math.IsInf(v, 0) {
+		return nil
+	}
+	return errors.Wrapf(err, "%s: %s %v must be finite", name, param, v)
+}
+
+// FirstErr returns the first non-nil error.
+func FirstErr(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Ms converts d to milliseconds.
+func Ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,44 @@
+package param_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ebiiim/eq/internal/param"
+	"github.com/pkg/errors"
+)
+
+var errInvalid = errors.New("invalid")
+
+func TestChecks(t *testing.T) {
+	cases := []struct {
+		name  string
+		err   error
+		isErr bool
+	}{
+		{"in_range", param.InRange(errInvalid, "eq", "q", 1, 0.1, 10), false},
+		{"in_range_max", param.InRange(errInvalid, "eq", "q", 10, 0.1, 10), false},
+		{"F_out_of_range", param.InRange(errInvalid, "eq", "q", 11, 0.1, 10), true},
+		{"F_nan_range", param.InRange(errInvalid, "eq", "q", math.NaN(), 0.1, 10), true},
+		{"positive", param.Positive(errInvalid, "delay", "t", 0.5), false},
+		{"F_zero", param.Positive(errInvalid, "delay", "t", 0), true},
+		{"F_inf_positive", param.Positive(errInvalid, "delay", "t", math.Inf(1)), true},
+		{"finite", param.Finite(errInvalid, "gain", "db", -100), false},
+		{"F_nan", param.Finite(errInvalid, "gain", "db", math.NaN()), true},
+		{"F_inf", param.Finite(errInvalid, "gain", "db", math.Inf(-1)), true},
+		{"first_err", param.FirstErr(nil, param.Finite(errInvalid, "gain", "db", math.NaN()), nil), true},
+		{"first_err_nil", param.FirstErr(nil, nil), false},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			if !((c.err != nil) == c.isErr) {
+				t.Errorf("got %v, want %v(isErr) ", c.err, c.isErr)
+			}
+			if c.isErr && errors.Cause(c.err) != errInvalid {
+				t.Errorf("got %v want %v", c.err, errInvalid)
+			}
+		})
+	}
+}
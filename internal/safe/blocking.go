@@ -0,0 +1,201 @@
+package safe
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrTimeout is returned when a deadline is exceeded.
+var ErrTimeout error = timeoutError{}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// BlockingBuffer provides a thread-safe bounded buffer
+// whose Read blocks until the requested number of bytes are available
+// and whose Write blocks while the buffer is full.
+//
+// The zero value is an empty buffer with no capacity limit.
+type BlockingBuffer struct {
+	// Cap is the maximum number of bytes the buffer holds (0 means unlimited).
+	//
+	// Cap should not be changed after the first call to Read or Write.
+	Cap int
+
+	initOnce sync.Once
+	mu       sync.Mutex
+	cond     *sync.Cond
+	buf      bytes.Buffer
+	eof      bool  // no more Write (Read returns io.EOF when the buffer is empty)
+	err      error // Read and Write return err
+	rDL, wDL time.Time
+}
+
+func (s *BlockingBuffer) initialize() {
+	s.cond = sync.NewCond(&s.mu)
+}
+
+// wait waits for a signal or the deadline dl.
+// It must be called with s.mu held, and returns ErrTimeout if dl is exceeded.
+func (s *BlockingBuffer) wait(dl time.Time) error {
+	if !dl.IsZero() {
+		d := time.Until(dl)
+		if d <= 0 {
+			return ErrTimeout
+		}
+		t := time.AfterFunc(d, func() {
+			s.mu.Lock()
+			s.cond.Broadcast()
+			s.mu.Unlock()
+		})
+		defer t.Stop()
+	}
+	s.cond.Wait()
+	return nil
+}
+
+// Read reads len(p) bytes into p.
+//
+// The function blocks until len(p) bytes (or Cap bytes if len(p) exceeds Cap) are available.
+// After CloseWrite, the function returns the remaining data and then io.EOF.
+// After CloseWithError, the function returns the error.
+// The function returns ErrTimeout if the read deadline is exceeded.
+func (s *BlockingBuffer) Read(p []byte) (n int, err error) {
+	s.initOnce.Do(s.initialize)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	need := len(p)
+	if s.Cap > 0 && need > s.Cap {
+		need = s.Cap
+	}
+	for s.buf.Len() < need && s.err == nil && !s.eof {
+		if err = s.wait(s.rDL); err != nil {
+			return 0, err
+		}
+	}
+	if s.err != nil {
+		return 0, s.err
+	}
+	n, err = s.buf.Read(p) // returns io.EOF if the buffer is empty
+	s.cond.Broadcast()     // wake up writers
+	return n, err
+}
+
+// Write writes len(p) bytes from p.
+//
+// The function blocks while the buffer is full (see Cap).
+// The function returns io.ErrClosedPipe after CloseWrite,
+// the error after CloseWithError,
+// and ErrTimeout if the write deadline is exceeded.
+func (s *BlockingBuffer) Write(p []byte) (n int, err error) {
+	s.initOnce.Do(s.initialize)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for n < len(p) {
+		if s.err != nil {
+			return n, s.err
+		}
+		if s.eof {
+			return n, io.ErrClosedPipe
+		}
+		free := len(p) - n
+		if s.Cap > 0 {
+			free = s.Cap - s.buf.Len()
+			if free > len(p)-n {
+				free = len(p) - n
+			}
+		}
+		if free <= 0 {
+			if err = s.wait(s.wDL); err != nil {
+				return n, err
+			}
+			continue
+		}
+		m, _ := s.buf.Write(p[n : n+free]) // bytes.Buffer.Write never returns an error
+		n += m
+		s.cond.Broadcast() // wake up readers
+	}
+	return n, nil
+}
+
+// WaitLen blocks until the buffer holds n bytes or more.
+//
+// The function returns io.EOF if the buffer can no longer reach n bytes
+// (after CloseWrite), the error after CloseWithError,
+// and ErrTimeout if the read deadline is exceeded.
+func (s *BlockingBuffer) WaitLen(n int) error {
+	s.initOnce.Do(s.initialize)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.buf.Len() < n {
+		if s.err != nil {
+			return s.err
+		}
+		if s.eof {
+			return io.EOF
+		}
+		if err := s.wait(s.rDL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Len returns the number of bytes in the buffer.
+func (s *BlockingBuffer) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Len()
+}
+
+// CloseWrite marks the end of data.
+//
+// Read returns the remaining data and then io.EOF.
+func (s *BlockingBuffer) CloseWrite() {
+	s.initOnce.Do(s.initialize)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.eof = true
+	s.cond.Broadcast()
+}
+
+// CloseWithError discards the data and makes Read and Write return err
+// (io.ErrClosedPipe if err is nil).
+//
+// Only the first error is kept.
+func (s *BlockingBuffer) CloseWithError(err error) {
+	s.initOnce.Do(s.initialize)
+	if err == nil {
+		err = io.ErrClosedPipe
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = err
+		s.buf.Reset()
+	}
+	s.cond.Broadcast()
+}
+
+// SetReadDeadline sets the deadline for Read and WaitLen (the zero value means no deadline).
+func (s *BlockingBuffer) SetReadDeadline(t time.Time) {
+	s.initOnce.Do(s.initialize)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rDL = t
+	s.cond.Broadcast()
+}
+
+// SetWriteDeadline sets the deadline for Write (the zero value means no deadline).
+func (s *BlockingBuffer) SetWriteDeadline(t time.Time) {
+	s.initOnce.Do(s.initialize)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.wDL = t
+	s.cond.Broadcast()
+}
@@ -0,0 +1,157 @@
+package safe_test
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/ebiiim/eq/internal/safe"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBlockingBuffer_Read(t *testing.T) {
+	var b safe.BlockingBuffer
+	go func() {
+		for _, c := range []byte("hello") {
+			time.Sleep(10 * time.Millisecond)
+			b.Write([]byte{c})
+		}
+		b.CloseWrite()
+	}()
+	got := make([]byte, 4)
+	n, err := b.Read(got)
+	if n != 4 || err != nil || string(got) != "hell" {
+		t.Errorf("got (%d, %v, %q) want (4, nil, %q)", n, err, got, "hell")
+	}
+	n, err = b.Read(got)
+	if n != 1 || err != nil || string(got[:n]) != "o" {
+		t.Errorf("got (%d, %v, %q) want (1, nil, %q)", n, err, got[:n], "o")
+	}
+	n, err = b.Read(got)
+	if n != 0 || err != io.EOF {
+		t.Errorf("got (%d, %v) want (0, %v)", n, err, io.EOF)
+	}
+	if _, err = b.Write([]byte("x")); err != io.ErrClosedPipe {
+		t.Errorf("got %v want %v", err, io.ErrClosedPipe)
+	}
+}
+
+func TestBlockingBuffer_Cap(t *testing.T) {
+	b := safe.BlockingBuffer{Cap: 4}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		n, err := b.Write([]byte("0123456789")) // blocks until read
+		if n != 10 || err != nil {
+			t.Errorf("got (%d, %v) want (10, nil)", n, err)
+		}
+		b.CloseWrite()
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if got := b.Len(); got != 4 {
+		t.Errorf("got Len %d want 4", got)
+	}
+	var got []byte
+	buf := make([]byte, 8) // larger than Cap
+	for len(got) < 10 {
+		n, err := b.Read(buf)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		got = append(got, buf[:n]...)
+	}
+	<-done
+	if !cmp.Equal(string(got), "0123456789") {
+		t.Errorf("got %q want %q", got, "0123456789")
+	}
+}
+
+func TestBlockingBuffer_CloseWithError(t *testing.T) {
+	errClosed := errors.New("closed")
+	cases := []struct {
+		name string
+		fn   func(b *safe.BlockingBuffer) error
+	}{
+		{"read", func(b *safe.BlockingBuffer) error { _, err := b.Read(make([]byte, 4)); return err }},
+		{"write", func(b *safe.BlockingBuffer) error { _, err := b.Write(make([]byte, 8)); return err }},
+		{"wait_len", func(b *safe.BlockingBuffer) error { return b.WaitLen(4) }},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			b := safe.BlockingBuffer{Cap: 4}
+			errCh := make(chan error)
+			go func() { errCh <- c.fn(&b) }()
+			time.Sleep(50 * time.Millisecond)
+			b.CloseWithError(errClosed)
+			select {
+			case err := <-errCh:
+				if err != errClosed {
+					t.Errorf("got %v want %v", err, errClosed)
+				}
+			case <-time.After(time.Second):
+				t.Error("not unblocked by CloseWithError")
+			}
+		})
+	}
+}
+
+func TestBlockingBuffer_Deadline(t *testing.T) {
+	cases := []struct {
+		name string
+		fn   func(b *safe.BlockingBuffer) error
+	}{
+		{"read", func(b *safe.BlockingBuffer) error {
+			b.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+			_, err := b.Read(make([]byte, 4))
+			return err
+		}},
+		{"write", func(b *safe.BlockingBuffer) error {
+			b.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
+			_, err := b.Write(make([]byte, 8))
+			return err
+		}},
+		{"wait_len", func(b *safe.BlockingBuffer) error {
+			b.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+			return b.WaitLen(4)
+		}},
+		{"past", func(b *safe.BlockingBuffer) error {
+			b.SetReadDeadline(time.Now().Add(-time.Second))
+			_, err := b.Read(make([]byte, 4))
+			return err
+		}},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			b := safe.BlockingBuffer{Cap: 4}
+			start := time.Now()
+			err := c.fn(&b)
+			if err != safe.ErrTimeout {
+				t.Errorf("got %v want %v", err, safe.ErrTimeout)
+			}
+			if d := time.Since(start); d > time.Second {
+				t.Errorf("took %v", d)
+			}
+		})
+	}
+}
+
+func TestBlockingBuffer_DeadlineExtended(t *testing.T) {
+	var b safe.BlockingBuffer
+	b.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		b.SetReadDeadline(time.Time{}) // no deadline
+		time.Sleep(100 * time.Millisecond)
+		b.Write([]byte("data"))
+	}()
+	got := make([]byte, 4)
+	_, err := b.Read(got)
+	if err != nil || string(got) != "data" {
+		t.Errorf("got (%v, %q) want (nil, %q)", err, got, "data")
+	}
+}
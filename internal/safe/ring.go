@@ -0,0 +1,69 @@
+package safe
+
+import "sync/atomic"
+
+// Ring is a preallocated lock-free ring buffer of int16 samples
+// for a single producer and a single consumer.
+//
+// Write must be called from one goroutine and Read from another (or the same) one,
+// so it can be used in real-time callbacks where locks and allocations should be avoided.
+type Ring struct {
+	r, w uint64 // read/write positions (accessed atomically; placed first for 64-bit alignment)
+	mask uint64
+	buf  []int16
+}
+
+// NewRing initializes a Ring object that holds size samples
+// (rounded up to a power of two).
+func NewRing(size int) *Ring {
+	n := 1
+	for n < size {
+		n <<= 1
+	}
+	return &Ring{mask: uint64(n - 1), buf: make([]int16, n)}
+}
+
+// Write writes samples from p as many as the free space allows,
+// and returns the number of samples written.
+//
+// The function never blocks.
+func (r *Ring) Write(p []int16) int {
+	w := atomic.LoadUint64(&r.w)
+	free := len(r.buf) - int(w-atomic.LoadUint64(&r.r))
+	if len(p) > free {
+		p = p[:free]
+	}
+	i := int(w & r.mask)
+	n := copy(r.buf[i:], p)
+	copy(r.buf, p[n:])
+	atomic.StoreUint64(&r.w, w+uint64(len(p)))
+	return len(p)
+}
+
+// Read reads samples into p as many as available,
+// and returns the number of samples read.
+//
+// The function never blocks.
+func (r *Ring) Read(p []int16) int {
+	rd := atomic.LoadUint64(&r.r)
+	avail := int(atomic.LoadUint64(&r.w) - rd)
+	if len(p) > avail {
+		p = p[:avail]
+	}
+	i := int(rd & r.mask)
+	n := copy(p, r.buf[i:])
+	copy(p[n:], r.buf)
+	atomic.StoreUint64(&r.r, rd+uint64(len(p)))
+	return len(p)
+}
+
+// Len returns the number of samples in the buffer.
+func (r *Ring) Len() int {
+	rd := atomic.LoadUint64(&r.r)
+	return int(atomic.LoadUint64(&r.w) - rd)
+}
+
+// Cap returns the number of samples the buffer can hold.
+func (r *Ring) Cap() int {
+	return len(r.buf)
+}
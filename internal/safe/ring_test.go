@@ -0,0 +1,247 @@
+package safe_test
+
+import (
+	"encoding/binary"
+	"runtime"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ebiiim/eq/internal/safe"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewRing(t *testing.T) {
+	cases := []struct {
+		name string
+		size int
+		want int
+	}{
+		{"1", 1, 1},
+		{"pow2", 8, 8},
+		{"round_up", 9, 16},
+		{"8192", 8192, 8192},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			got := safe.NewRing(c.size).Cap()
+			if got != c.want {
+				t.Errorf("got %d want %d", got, c.want)
+			}
+		})
+	}
+}
+
+func TestRing_ReadWrite(t *testing.T) {
+	r := safe.NewRing(4)
+	steps := []struct {
+		name    string
+		write   []int16
+		wantW   int
+		readLen int
+		want    []int16
+	}{
+		{"partial", []int16{1, 2, 3}, 3, 2, []int16{1, 2}},
+		{"full", []int16{4, 5, 6, 7}, 3, 0, []int16{}},
+		{"wrap", nil, 0, 8, []int16{3, 4, 5, 6}},
+		{"empty", nil, 0, 8, []int16{}},
+		{"wrap_write", []int16{8, 9, 10}, 3, 3, []int16{8, 9, 10}},
+	}
+	for _, s := range steps {
+		n := r.Write(s.write)
+		if n != s.wantW {
+			t.Errorf("%s: got Write %d want %d", s.name, n, s.wantW)
+		}
+		got := make([]int16, s.readLen)
+		n = r.Read(got)
+		if diff := cmp.Diff(s.want, got[:n]); diff != "" {
+			t.Errorf("%s: Read (-want +got)\n%s", s.name, diff)
+		}
+	}
+	if got := r.Len(); got != 0 {
+		t.Errorf("got Len %d want 0", got)
+	}
+}
+
+func TestRing_Concurrent(t *testing.T) {
+	const total = 10000
+	r := safe.NewRing(64)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		buf := make([]int16, 7)
+		for i := 0; i < total; {
+			for j := range buf {
+				buf[j] = int16(i + j)
+			}
+			n := r.Write(buf[:min16(len(buf), total-i)])
+			if n == 0 {
+				runtime.Gosched()
+			}
+			i += n
+		}
+	}()
+	buf := make([]int16, 5)
+	for i := 0; i < total; {
+		n := r.Read(buf)
+		if n == 0 {
+			runtime.Gosched()
+		}
+		for j := 0; j < n; j++ {
+			if buf[j] != int16(i+j) {
+				t.Fatalf("got %d want %d at %d", buf[j], int16(i+j), i+j)
+			}
+		}
+		i += n
+	}
+	wg.Wait()
+}
+
+func min16(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// The benchmarks below compare a device block round trip
+// (bytes from Write -> int16 samples for the device)
+// between the blocking-stream design (safe.Buffer + encoding/binary)
+// and the callback design (safe.Ring + manual conversion).
+
+const benchBlock = 8192 // samples
+
+func BenchmarkBuffer_Binary(b *testing.B) {
+	var buf safe.Buffer
+	in := make([]byte, benchBlock*2)
+	out := make([]int16, benchBlock)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(in)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Write(in)
+		if err := binary.Read(&buf, binary.LittleEndian, out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRing(b *testing.B) {
+	r := safe.NewRing(benchBlock)
+	in := make([]byte, benchBlock*2)
+	scratch := make([]int16, benchBlock)
+	out := make([]int16, benchBlock)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(in)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range scratch {
+			scratch[j] = int16(binary.LittleEndian.Uint16(in[2*j:]))
+		}
+		r.Write(scratch)
+		if n := r.Read(out); n != benchBlock {
+			b.Fatalf("got %d want %d", n, benchBlock)
+		}
+	}
+}
+
+// The benchmarks below measure the latency of each read by the device side
+// (e.g. a PortAudio callback) while another goroutine keeps writing,
+// and log its percentiles (jitter) of the ring and the mutex/cond buffer.
+// Reads are only measured when a block is available, so waiting for data is not counted.
+
+const jitterBlock = 256 // samples (a typical callback size)
+
+// benchLatency calls write in another goroutine until the benchmark ends,
+// measures b.N calls of read that return true, and logs the percentiles.
+// write and read return false if there is no room or no data.
+func benchLatency(b *testing.B, write, read func() bool) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if !write() {
+				runtime.Gosched()
+			}
+		}
+	}()
+
+	lat := make([]time.Duration, 0, b.N)
+	b.ReportAllocs()
+	b.SetBytes(jitterBlock * 2)
+	b.ResetTimer()
+	for len(lat) < b.N {
+		t := time.Now()
+		if !read() {
+			runtime.Gosched()
+			continue
+		}
+		lat = append(lat, time.Since(t))
+	}
+	b.StopTimer()
+	close(done)
+	wg.Wait()
+
+	sort.Slice(lat, func(i, j int) bool { return lat[i] < lat[j] })
+	pct := func(p float64) time.Duration { return lat[int(float64(len(lat)-1)*p)] }
+	b.Logf("N=%d p50=%v p99=%v p99.9=%v max=%v", len(lat), pct(0.5), pct(0.99), pct(0.999), lat[len(lat)-1])
+}
+
+func BenchmarkBlockingBuffer_Latency(b *testing.B) {
+	buf := safe.BlockingBuffer{Cap: jitterBlock * 2 * 8}
+	in := make([]byte, jitterBlock*2)
+	out := make([]byte, jitterBlock*2)
+	samples := make([]int16, jitterBlock)
+	benchLatency(b, func() bool {
+		if buf.Len()+len(in) > buf.Cap {
+			return false
+		}
+		buf.Write(in)
+		return true
+	}, func() bool {
+		if buf.Len() < len(out) {
+			return false
+		}
+		if _, err := buf.Read(out); err != nil {
+			b.Fatal(err)
+		}
+		for j := range samples {
+			samples[j] = int16(binary.LittleEndian.Uint16(out[2*j:]))
+		}
+		return true
+	})
+}
+
+func BenchmarkRing_Latency(b *testing.B) {
+	r := safe.NewRing(jitterBlock * 8)
+	in := make([]byte, jitterBlock*2)
+	scratch := make([]int16, jitterBlock)
+	out := make([]int16, jitterBlock)
+	benchLatency(b, func() bool {
+		if r.Cap()-r.Len() < len(scratch) {
+			return false
+		}
+		for j := range scratch {
+			scratch[j] = int16(binary.LittleEndian.Uint16(in[2*j:]))
+		}
+		r.Write(scratch)
+		return true
+	}, func() bool {
+		if r.Len() < len(out) {
+			return false
+		}
+		r.Read(out)
+		return true
+	})
+}
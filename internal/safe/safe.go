@@ -56,6 +56,15 @@ func (f *Func) Set(fn func([]byte)) {
 	f.fn = fn
 }
 
+// Get returns f.fn (thread-safe).
+//
+// Unlike Do, calls of the returned func are not serialized.
+func (f *Func) Get() func([]byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.fn
+}
+
 // Do calls f.fn (thread-safe).
 func (f *Func) Do(b []byte) {
 	f.mu.Lock()
@@ -0,0 +1,180 @@
+// Package pcm provides the Format type that describes a PCM stream,
+// focusing on connecting streamio.Recorder, filter.Filter and streamio.Player safely.
+package pcm
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// Encoding is a sample encoding.
+type Encoding string
+
+const (
+	Signed   Encoding = "signed"
+	Unsigned Encoding = "unsigned"
+	Float    Encoding = "float"
+)
+
+// Format describes an interleaved PCM stream.
+//
+// The zero value means that the format is unspecified.
+type Format struct {
+	Channels   int
+	SampleRate int
+	BitDepth   int
+	Encoding   Encoding
+	ByteOrder  binary.ByteOrder
+}
+
+// Default is the format used when nothing is specified
+// (2ch, 48000Hz, signed 16-bit little-endian).
+var Default = Format{
+	Channels:   2,
+	SampleRate: 48000,
+	BitDepth:   16,
+	Encoding:   Signed,
+	ByteOrder:  binary.LittleEndian,
+}
+
+// ErrMismatch is returned (as a cause) when connected stages have different formats.
+var ErrMismatch = errors.New("format mismatch")
+
+// SampleSize returns the number of bytes of a sample.
+func (f Format) SampleSize() int {
+	return f.BitDepth / 8
+}
+
+// FrameSize returns the number of bytes of a frame (a sample for each channel).
+func (f Format) FrameSize() int {
+	return f.Channels * f.SampleSize()
+}
+
+// IsZero returns true when f is unspecified.
+func (f Format) IsZero() bool {
+	return f == Format{}
+}
+
+// Validate returns an error if f is not a valid format.
+func (f Format) Validate() error {
+	if f.Channels <= 0 {
+		return errors.New("channels must be >0")
+	}
+	if f.SampleRate <= 0 {
+		return errors.New("sample rate must be >0")
+	}
+	switch f.Encoding {
+	case Signed, Unsigned:
+		if f.BitDepth != 8 && f.BitDepth != 16 && f.BitDepth != 24 && f.BitDepth != 32 {
+			return errors.Errorf("unsupported bit depth %d for %s encoding", f.BitDepth, f.Encoding)
+		}
+	case Float:
+		if f.BitDepth != 32 && f.BitDepth != 64 {
+			return errors.Errorf("unsupported bit depth %d for %s encoding", f.BitDepth, f.Encoding)
+		}
+	default:
+		return errors.Errorf("unknown encoding %q", f.Encoding)
+	}
+	if f.BitDepth > 8 && f.ByteOrder == nil {
+		return errors.New("byte order must be specified")
+	}
+	return nil
+}
+
+// Equal returns true when f and g describe the same stream.
+func (f Format) Equal(g Format) bool {
+	if f.Channels != g.Channels || f.SampleRate != g.SampleRate || f.BitDepth != g.BitDepth || f.Encoding != g.Encoding {
+		return false
+	}
+	if f.BitDepth <= 8 {
+		return true // byte order does not matter
+	}
+	return byteOrderString(f.ByteOrder) == byteOrderString(g.ByteOrder)
+}
+
+// FillSilence fills b with silence in f (b must start at a sample boundary).
+//
+// Silence is all zeros except for the unsigned encoding,
+// whose midpoint (e.g. 0x80 for 8-bit) is silence.
+func (f Format) FillSilence(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+	ss := f.SampleSize()
+	if f.Encoding != Unsigned || ss == 0 {
+		return
+	}
+	msb := ss - 1 // the index of the most significant byte in a sample
+	if f.ByteOrder != nil && f.ByteOrder.String() == binary.BigEndian.String() {
+		msb = 0
+	}
+	for i := msb; i < len(b); i += ss {
+		b[i] = 0x80
+	}
+}
+
+func (f Format) String() string {
+	if f.IsZero() {
+		return "unspecified"
+	}
+	return fmt.Sprintf("%dch %dHz %dbit %s %s", f.Channels, f.SampleRate, f.BitDepth, f.Encoding, byteOrderString(f.ByteOrder))
+}
+
+func byteOrderString(bo binary.ByteOrder) string {
+	if bo == nil {
+		return "<nil>"
+	}
+	return bo.String()
+}
+
+// InputFormatter is implemented by stages that accept data
+// (filter.Filter and streamio.Player).
+//
+// InputFormat returns the zero Format if the stage accepts any format.
+type InputFormatter interface {
+	InputFormat() Format
+}
+
+// OutputFormatter is implemented by stages that produce data
+// (streamio.Recorder and filter.Filter).
+//
+// OutputFormat returns the zero Format if the stage does not change the format.
+type OutputFormatter interface {
+	OutputFormat() Format
+}
+
+// Check verifies that stages (e.g. Recorder, Filters..., Player) can be connected in order.
+//
+// A stage that does not implement InputFormatter or OutputFormatter
+// (or reports the zero Format) is assumed to pass the format through.
+// The function returns an error that has ErrMismatch as its cause
+// when a stage would receive data in a format it does not accept.
+func Check(stages ...interface{}) error {
+	var cur Format
+	for i, s := range stages {
+		if in, ok := s.(InputFormatter); ok {
+			f := in.InputFormat()
+			if !f.IsZero() {
+				if err := f.Validate(); err != nil {
+					return errors.Wrapf(err, "stage #%d: invalid input format", i)
+				}
+				if !cur.IsZero() && !cur.Equal(f) {
+					return errors.Wrapf(ErrMismatch, "stage #%d: got %v, want %v", i, cur, f)
+				}
+				cur = f
+			}
+		}
+		if out, ok := s.(OutputFormatter); ok {
+			f := out.OutputFormat()
+			if !f.IsZero() {
+				if err := f.Validate(); err != nil {
+					return errors.Wrapf(err, "stage #%d: invalid output format", i)
+				}
+				cur = f
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package pcm_test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/ebiiim/eq/pcm"
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+func TestFormat_Validate(t *testing.T) {
+	cases := []struct {
+		name  string
+		f     pcm.Format
+		isErr bool
+	}{
+		{"default", pcm.Default, false},
+		{"u8_no_byteorder", pcm.Format{1, 8000, 8, pcm.Unsigned, nil}, false},
+		{"s24be", pcm.Format{2, 96000, 24, pcm.Signed, binary.BigEndian}, false},
+		{"f32", pcm.Format{2, 48000, 32, pcm.Float, binary.LittleEndian}, false},
+		{"F_zero", pcm.Format{}, true},
+		{"F_no_channels", pcm.Format{0, 48000, 16, pcm.Signed, binary.LittleEndian}, true},
+		{"F_no_rate", pcm.Format{2, 0, 16, pcm.Signed, binary.LittleEndian}, true},
+		{"F_12bit", pcm.Format{2, 48000, 12, pcm.Signed, binary.LittleEndian}, true},
+		{"F_f16", pcm.Format{2, 48000, 16, pcm.Float, binary.LittleEndian}, true},
+		{"F_encoding", pcm.Format{2, 48000, 16, "ulaw", binary.LittleEndian}, true},
+		{"F_no_byteorder", pcm.Format{2, 48000, 16, pcm.Signed, nil}, true},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			err := c.f.Validate()
+			if !((err != nil) == c.isErr) {
+				t.Errorf("got %v, want %v(isErr) ", err, c.isErr)
+			}
+		})
+	}
+}
+
+func TestFormat_FrameSize(t *testing.T) {
+	cases := []struct {
+		name string
+		f    pcm.Format
+		want int
+	}{
+		{"s16_2ch", pcm.Default, 4},
+		{"s24_2ch", pcm.Format{2, 48000, 24, pcm.Signed, binary.LittleEndian}, 6},
+		{"f32_6ch", pcm.Format{6, 48000, 32, pcm.Float, binary.LittleEndian}, 24},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			if got := c.f.FrameSize(); got != c.want {
+				t.Errorf("got %v want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestFormat_FillSilence(t *testing.T) {
+	cases := []struct {
+		name string
+		f    pcm.Format
+		want []byte
+	}{
+		{"s16", pcm.Default, []byte{0, 0, 0, 0}},
+		{"u8", pcm.Format{1, 8000, 8, pcm.Unsigned, nil}, []byte{0x80, 0x80, 0x80, 0x80}},
+		{"u16le", pcm.Format{1, 8000, 16, pcm.Unsigned, binary.LittleEndian}, []byte{0, 0x80, 0, 0x80}},
+		{"u16be", pcm.Format{1, 8000, 16, pcm.Unsigned, binary.BigEndian}, []byte{0x80, 0, 0x80, 0}},
+		{"unspecified", pcm.Format{}, []byte{0, 0, 0, 0}},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			got := []byte{1, 2, 3, 4}
+			c.f.FillSilence(got)
+			if diff := cmp.Diff(c.want, got); diff != "" {
+				t.Errorf("(-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+type stage struct {
+	in, out pcm.Format
+}
+
+func (s stage) InputFormat() pcm.Format  { return s.in }
+func (s stage) OutputFormat() pcm.Format { return s.out }
+
+func TestCheck(t *testing.T) {
+	s24 := pcm.Format{2, 48000, 24, pcm.Signed, binary.LittleEndian}
+	cases := []struct {
+		name       string
+		stages     []interface{}
+		isMismatch bool
+		isErr      bool
+	}{
+		{"same", []interface{}{stage{out: pcm.Default}, stage{pcm.Default, pcm.Default}, stage{in: pcm.Default}}, false, false},
+		{"convert", []interface{}{stage{out: s24}, stage{s24, pcm.Default}, stage{in: pcm.Default}}, false, false},
+		{"transparent", []interface{}{stage{out: pcm.Default}, struct{}{}, stage{}, stage{in: pcm.Default}}, false, false},
+		{"unknown_source", []interface{}{struct{}{}, stage{in: pcm.Default}}, false, false},
+		{"F_mismatch", []interface{}{stage{out: s24}, stage{in: pcm.Default}}, true, true},
+		{"F_mismatch_through", []interface{}{stage{out: s24}, struct{}{}, stage{in: pcm.Default}}, true, true},
+		{"F_invalid", []interface{}{stage{out: pcm.Format{Channels: 2}}}, false, true},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			err := pcm.Check(c.stages...)
+			if !((err != nil) == c.isErr) {
+				t.Errorf("got %v, want %v(isErr) ", err, c.isErr)
+			}
+			if (errors.Cause(err) == pcm.ErrMismatch) != c.isMismatch {
+				t.Errorf("got %v, want %v(isMismatch) ", err, c.isMismatch)
+			}
+		})
+	}
+}
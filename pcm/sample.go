@@ -0,0 +1,134 @@
+package pcm
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Decode converts the samples in b into float32 values in [-1, 1) and stores them in dst.
+//
+// It returns the number of samples decoded, which is the smaller of
+// len(dst) and len(b)/f.SampleSize(); a partial sample at the end of b is ignored.
+// f must be valid (see Validate).
+func (f Format) Decode(dst []float32, b []byte) int {
+	ss := f.SampleSize()
+	n := len(b) / ss
+	if n > len(dst) {
+		n = len(dst)
+	}
+	bo := f.byteOrder()
+	for i := 0; i < n; i++ {
+		s := b[i*ss : i*ss+ss]
+		switch f.Encoding {
+		case Float:
+			if ss == 4 {
+				dst[i] = math.Float32frombits(bo.Uint32(s))
+			} else {
+				dst[i] = float32(math.Float64frombits(bo.Uint64(s)))
+			}
+		case Signed:
+			dst[i] = float32(float64(f.int(s, bo)) / f.scale())
+		case Unsigned:
+			v := f.int(s, bo)             // as signed
+			v ^= -1 << uint(f.BitDepth-1) // flips the sign bit
+			dst[i] = float32(float64(v) / f.scale())
+		}
+	}
+	return n
+}
+
+// Encode converts the float32 values in src into samples and stores them in b.
+//
+// Values out of [-1, 1] are clipped, and NaN is encoded as 0. It returns the number of samples encoded,
+// which is the smaller of len(src) and len(b)/f.SampleSize().
+// f must be valid (see Validate).
+func (f Format) Encode(b []byte, src []float32) int {
+	ss := f.SampleSize()
+	n := len(b) / ss
+	if n > len(src) {
+		n = len(src)
+	}
+	bo := f.byteOrder()
+	max := f.scale() - 1
+	for i := 0; i < n; i++ {
+		s := b[i*ss : i*ss+ss]
+		x := src[i]
+		switch {
+		case x > 1:
+			x = 1
+		case x < -1:
+			x = -1
+		case x != x: // NaN
+			x = 0
+		}
+		if f.Encoding == Float {
+			if ss == 4 {
+				bo.PutUint32(s, math.Float32bits(x))
+			} else {
+				bo.PutUint64(s, math.Float64bits(float64(x)))
+			}
+			continue
+		}
+		v := math.Floor(float64(x)*f.scale() + 0.5)
+		if v > max {
+			v = max
+		}
+		iv := int64(v)
+		if f.Encoding == Unsigned {
+			iv ^= -1 << uint(f.BitDepth-1)
+		}
+		f.putInt(s, bo, iv)
+	}
+	return n
+}
+
+// scale returns 2^(BitDepth-1), the magnitude of the minimum integer sample.
+func (f Format) scale() float64 {
+	return float64(int64(1) << uint(f.BitDepth-1))
+}
+
+func (f Format) byteOrder() binary.ByteOrder {
+	if f.ByteOrder == nil {
+		return binary.LittleEndian // does not matter for 8-bit
+	}
+	return f.ByteOrder
+}
+
+// int reads an integer sample as signed (sign-extended).
+func (f Format) int(s []byte, bo binary.ByteOrder) int64 {
+	var v int64
+	switch len(s) {
+	case 1:
+		v = int64(int8(s[0]))
+	case 2:
+		v = int64(int16(bo.Uint16(s)))
+	case 3:
+		if bo.String() == binary.BigEndian.String() {
+			v = int64(s[0])<<16 | int64(s[1])<<8 | int64(s[2])
+		} else {
+			v = int64(s[2])<<16 | int64(s[1])<<8 | int64(s[0])
+		}
+		v = v << 40 >> 40 // sign-extends 24 bits
+	case 4:
+		v = int64(int32(bo.Uint32(s)))
+	}
+	return v
+}
+
+// putInt writes the lower bits of v into an integer sample.
+func (f Format) putInt(s []byte, bo binary.ByteOrder, v int64) {
+	switch len(s) {
+	case 1:
+		s[0] = byte(v)
+	case 2:
+		bo.PutUint16(s, uint16(v))
+	case 3:
+		if bo.String() == binary.BigEndian.String() {
+			s[0], s[1], s[2] = byte(v>>16), byte(v>>8), byte(v)
+		} else {
+			s[0], s[1], s[2] = byte(v), byte(v>>8), byte(v>>16)
+		}
+	case 4:
+		bo.PutUint32(s, uint32(v))
+	}
+}
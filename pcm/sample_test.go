@@ -0,0 +1,73 @@
+package pcm_test
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/ebiiim/eq/pcm"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFormat_Decode(t *testing.T) {
+	cases := []struct {
+		name string
+		f    pcm.Format
+		b    []byte
+		want []float32
+	}{
+		{"s16le", pcm.Default, []byte{0x00, 0x40, 0x00, 0x80, 0xff, 0x7f}, []float32{0.5, -1, 32767.0 / 32768}},
+		{"s24le", pcm.Format{1, 48000, 24, pcm.Signed, binary.LittleEndian}, []byte{0x00, 0x00, 0xc0, 0x00, 0x00, 0x40}, []float32{-0.5, 0.5}},
+		{"s24be", pcm.Format{1, 48000, 24, pcm.Signed, binary.BigEndian}, []byte{0xc0, 0x00, 0x00, 0x80, 0x00, 0x00}, []float32{-0.5, -1}},
+		{"s32le", pcm.Format{1, 48000, 32, pcm.Signed, binary.LittleEndian}, []byte{0x00, 0x00, 0x00, 0x40, 0x00, 0x00, 0x00, 0x80}, []float32{0.5, -1}},
+		{"u8", pcm.Format{1, 8000, 8, pcm.Unsigned, nil}, []byte{0x80, 0x00, 0xc0}, []float32{0, -1, 0.5}},
+		{"u16be", pcm.Format{1, 8000, 16, pcm.Unsigned, binary.BigEndian}, []byte{0x80, 0x00, 0x40, 0x00}, []float32{0, -0.5}},
+		{"f32le", pcm.Format{1, 48000, 32, pcm.Float, binary.LittleEndian}, []byte{0x00, 0x00, 0x00, 0x3f}, []float32{0.5}},
+		{"partial", pcm.Default, []byte{0x00, 0x40, 0x00}, []float32{0.5}},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			got := make([]float32, 8)
+			n := c.f.Decode(got, c.b)
+			if diff := cmp.Diff(c.want, got[:n]); diff != "" {
+				t.Errorf("(-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFormat_Encode(t *testing.T) {
+	cases := []struct {
+		name string
+		f    pcm.Format
+		in   []float32
+		want []byte
+	}{
+		{"s16le_clip", pcm.Default, []float32{0.5, -1, 1, 2, -2}, []byte{0x00, 0x40, 0x00, 0x80, 0xff, 0x7f, 0xff, 0x7f, 0x00, 0x80}},
+		{"s24le", pcm.Format{1, 48000, 24, pcm.Signed, binary.LittleEndian}, []float32{-0.5, 1}, []byte{0x00, 0x00, 0xc0, 0xff, 0xff, 0x7f}},
+		{"s32be", pcm.Format{1, 48000, 32, pcm.Signed, binary.BigEndian}, []float32{0.5, 1}, []byte{0x40, 0x00, 0x00, 0x00, 0x7f, 0xff, 0xff, 0xff}},
+		{"u8", pcm.Format{1, 8000, 8, pcm.Unsigned, nil}, []float32{0, -1, 1}, []byte{0x80, 0x00, 0xff}},
+		{"f32le", pcm.Format{1, 48000, 32, pcm.Float, binary.LittleEndian}, []float32{0.5}, []byte{0x00, 0x00, 0x00, 0x3f}},
+		{"f32le_clip", pcm.Format{1, 48000, 32, pcm.Float, binary.LittleEndian}, []float32{1.5, -2}, []byte{0x00, 0x00, 0x80, 0x3f, 0x00, 0x00, 0x80, 0xbf}},
+		{"s16le_nan", pcm.Default, []float32{float32(math.NaN()), 0.5}, []byte{0x00, 0x00, 0x00, 0x40}},
+		{"u8_nan", pcm.Format{1, 8000, 8, pcm.Unsigned, nil}, []float32{float32(math.NaN())}, []byte{0x80}},
+		{"f32le_nan", pcm.Format{1, 48000, 32, pcm.Float, binary.LittleEndian}, []float32{float32(math.NaN())}, []byte{0x00, 0x00, 0x00, 0x00}},
+		{"f64be_clip", pcm.Format{1, 48000, 64, pcm.Float, binary.BigEndian}, []float32{2}, []byte{0x3f, 0xf0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			got := make([]byte, len(c.want))
+			n := c.f.Encode(got, c.in)
+			if n != len(c.in) {
+				t.Errorf("got %d samples want %d", n, len(c.in))
+			}
+			if diff := cmp.Diff(c.want, got); diff != "" {
+				t.Errorf("(-want +got)\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,356 @@
+// Package pipeline provides Pipeline that connects
+// a streamio.Recorder, filter.Filters and a streamio.Player.
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/ebiiim/eq/filter"
+	"github.com/ebiiim/eq/pcm"
+	"github.com/ebiiim/eq/streamio"
+	"github.com/pkg/errors"
+)
+
+// Pipeline reads data from Recorder, passes them through Filters in order,
+// and writes the processed data to Player.
+type Pipeline struct {
+	Recorder streamio.Recorder
+	Filters  []filter.Filter
+	Player   streamio.Player
+
+	// BufferSize determines the number of bytes to pass through the stages once (default: 8192).
+	//
+	// Pipeline reads the same number of bytes from each Filter as it writes,
+	// so BufferSize should be a multiple of the chunk size of each Filter.
+	BufferSize int
+
+	// Timeout is the deadline of each Read and Write of Filters
+	// that implement filter.Deadliner (optional, 0 means no deadline).
+	//
+	// If a Filter times out, Pipeline passes the whole frames that the Filter has output
+	// to the next stages, and writes silence to Player for the missing part,
+	// so that Player keeps being fed while the Filter stalls.
+	// No data are lost: the data that the Filter accepts or outputs late are played afterwards.
+	Timeout time.Duration
+
+	// OnTimeout is called when Filters[i] times out (optional).
+	OnTimeout func(i int)
+
+	stages []stage // the state of each Filter
+
+	closeOnce []sync.Once // for Recorder, Filters... and Player
+	closeErrs []error
+}
+
+// stage is the state of a Filter that is kept across timeouts.
+type stage struct {
+	unsent []byte // the data that the Filter has not accepted yet
+	carry  []byte // an incomplete frame read from the Filter
+	owed   int    // the number of bytes written to the Filter but not read yet
+}
+
+// Check verifies that the stages can be connected (see pcm.Check).
+func (p *Pipeline) Check() error {
+	if p.Recorder == nil || p.Player == nil {
+		return errors.New("Recorder and Player must be set")
+	}
+	stages := []interface{}{p.Recorder}
+	for _, f := range p.Filters {
+		stages = append(stages, f)
+	}
+	stages = append(stages, p.Player)
+	return pcm.Check(stages...)
+}
+
+// Run runs the pipeline until ctx is done, Recorder reaches the end of the stream,
+// or any stage returns an error.
+//
+// Run closes all stages before returning.
+// When ctx is done, all stages are closed at once
+// to interrupt a stage blocking in Read or Write.
+// The returned error is the first fatal error, ctx.Err() if ctx is done,
+// or nil if Recorder returned io.EOF.
+func (p *Pipeline) Run(ctx context.Context) (err error) {
+	p.closeOnce = make([]sync.Once, len(p.Filters)+2)
+	p.closeErrs = make([]error, len(p.Filters)+2)
+	if err = p.Check(); err != nil {
+		if cErr := p.close(); cErr != nil {
+			err = errors.Wrapf(err, "(%v)", cErr)
+		}
+		return err
+	}
+	if p.BufferSize == 0 {
+		p.BufferSize = 8192
+	}
+	p.stages = make([]stage, len(p.Filters))
+
+	// closing the stages unblocks Read and Write so that the loop notices ctx is done
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			p.close()
+		case <-done:
+		}
+	}()
+
+	err = p.loop(ctx)
+	close(done)
+	wg.Wait()
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+
+	cErr := p.close()
+	if err == nil {
+		err = cErr
+	}
+	return err
+}
+
+func (p *Pipeline) loop(ctx context.Context) error {
+	b := make([]byte, p.BufferSize)
+	for ctx.Err() == nil {
+		n, rErr := io.ReadFull(p.Recorder, b)
+		if rErr == io.EOF || rErr == io.ErrUnexpectedEOF {
+			return p.drain(b[:n])
+		}
+		if rErr != nil {
+			return errors.Wrap(rErr, "recorder: could not read")
+		}
+		if err := p.process(b[:n]); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// process passes b through Filters and writes the result to Player.
+//
+// If a Filter times out, only the data that the Filter has output are passed to the next stages,
+// and the rest of b is filled with silence.
+func (p *Pipeline) process(b []byte) error {
+	size := len(b)
+	for i, f := range p.Filters {
+		if len(b) == 0 {
+			break
+		}
+		err := p.setDeadline(f, false)
+		if err != nil {
+			return errors.Wrapf(err, "filter #%d: could not set write deadline", i)
+		}
+		err = p.write(i, b)
+		if errors.Cause(err) == filter.ErrTimeout {
+			p.timedOut(i)
+			b = b[:0]
+			break
+		}
+		if err != nil {
+			return errors.Wrapf(err, "filter #%d: could not write", i)
+		}
+		err = p.setDeadline(f, true)
+		if err != nil {
+			return errors.Wrapf(err, "filter #%d: could not set read deadline", i)
+		}
+		n, err := p.read(i, b)
+		if errors.Cause(err) == filter.ErrTimeout {
+			p.timedOut(i)
+			b = b[:n]
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "filter #%d: could not read", i)
+		}
+	}
+	if n := len(b); n < size {
+		b = b[:size]
+		p.format().FillSilence(b[n:])
+	}
+	_, err := p.Player.Write(b)
+	if err != nil {
+		return errors.Wrap(err, "player: could not write")
+	}
+	return nil
+}
+
+// write writes the data that Filters[i] has not accepted yet and b to Filters[i].
+//
+// If the Filter times out, the data that it has not accepted are kept for the next call.
+func (p *Pipeline) write(i int, b []byte) error {
+	s := &p.stages[i]
+	if len(s.unsent) > 0 {
+		b = append(s.unsent, b...)
+	}
+	n, err := p.Filters[i].Write(b)
+	s.owed += n
+	if errors.Cause(err) == filter.ErrTimeout {
+		s.unsent = append(s.unsent[:0], b[n:]...)
+		return err
+	}
+	s.unsent = s.unsent[:0]
+	return err
+}
+
+// read reads len(b) bytes from Filters[i] into b and returns the number of bytes read.
+//
+// If the Filter times out, the function returns the whole frames read so far
+// and keeps the incomplete frame for the next call.
+func (p *Pipeline) read(i int, b []byte) (int, error) {
+	s := &p.stages[i]
+	n := copy(b, s.carry)
+	s.carry = s.carry[n:]
+	m, err := io.ReadFull(p.Filters[i], b[n:])
+	s.owed -= m
+	n += m
+	if errors.Cause(err) == filter.ErrTimeout {
+		whole := n - n%p.frameSize(i)
+		s.carry = append(append([]byte{}, b[whole:n]...), s.carry...)
+		return whole, err
+	}
+	return n, err
+}
+
+// frameSize returns the frame size of the output of Filters[i] (1 if unknown).
+func (p *Pipeline) frameSize(i int) int {
+	if out, ok := p.Filters[i].(pcm.OutputFormatter); ok && !out.OutputFormat().IsZero() {
+		return out.OutputFormat().FrameSize()
+	}
+	if fs := p.format().FrameSize(); fs > 0 {
+		return fs
+	}
+	return 1
+}
+
+// setDeadline sets the read (or write) deadline of f to Timeout from now
+// if f implements filter.Deadliner and Timeout is set.
+func (p *Pipeline) setDeadline(f filter.Filter, read bool) error {
+	return p.setDeadlineAt(f, read, time.Now().Add(p.Timeout))
+}
+
+func (p *Pipeline) setDeadlineAt(f filter.Filter, read bool, t time.Time) error {
+	d, ok := f.(filter.Deadliner)
+	if p.Timeout <= 0 || !ok {
+		return nil
+	}
+	if read {
+		return d.SetReadDeadline(t)
+	}
+	return d.SetWriteDeadline(t)
+}
+
+// timedOut is called when Filters[i] has timed out.
+func (p *Pipeline) timedOut(i int) {
+	if p.OnTimeout != nil {
+		p.OnTimeout(i)
+	}
+}
+
+// format returns the format of the data written to Player (the zero Format if unknown).
+func (p *Pipeline) format() pcm.Format {
+	if in, ok := p.Player.(pcm.InputFormatter); ok && !in.InputFormat().IsZero() {
+		return in.InputFormat()
+	}
+	stages := []interface{}{p.Recorder}
+	for _, f := range p.Filters {
+		stages = append(stages, f)
+	}
+	var cur pcm.Format
+	for _, s := range stages {
+		if out, ok := s.(pcm.OutputFormatter); ok && !out.OutputFormat().IsZero() {
+			cur = out.OutputFormat()
+		}
+	}
+	return cur
+}
+
+// drain passes the last data through Filters and writes the result to Player.
+//
+// Filters implementing filter.CloseWriter are flushed and read until io.EOF,
+// so that data held by them (e.g. a partial chunk) also reach Player.
+// The data delayed by timeouts are also read. Deadlines are not applied.
+func (p *Pipeline) drain(b []byte) error {
+	for i, f := range p.Filters {
+		err := p.setDeadlineAt(f, false, time.Time{})
+		if err == nil {
+			err = p.setDeadlineAt(f, true, time.Time{})
+		}
+		if err != nil {
+			return errors.Wrapf(err, "filter #%d: could not clear deadlines", i)
+		}
+		err = p.write(i, b)
+		if err != nil {
+			return errors.Wrapf(err, "filter #%d: could not write", i)
+		}
+		s := &p.stages[i]
+		out := s.carry
+		cw, ok := f.(filter.CloseWriter)
+		if !ok {
+			rest := make([]byte, s.owed)
+			_, err = io.ReadFull(f, rest)
+			if err != nil {
+				return errors.Wrapf(err, "filter #%d: could not read", i)
+			}
+			b = append(out, rest...)
+			continue
+		}
+		err = cw.CloseWrite()
+		if err != nil {
+			return errors.Wrapf(err, "filter #%d: could not close write", i)
+		}
+		rest, err := ioutil.ReadAll(f)
+		if err != nil {
+			return errors.Wrapf(err, "filter #%d: could not read", i)
+		}
+		b = append(out, rest...)
+	}
+	if len(b) == 0 {
+		return nil
+	}
+	_, err := p.Player.Write(b)
+	if err != nil {
+		return errors.Wrap(err, "player: could not write")
+	}
+	return nil
+}
+
+// closeStage closes the i-th stage of Recorder, Filters... and Player only once,
+// and returns the error.
+func (p *Pipeline) closeStage(i int) error {
+	p.closeOnce[i].Do(func() {
+		var c io.Closer
+		var name string
+		switch {
+		case i == 0:
+			c, name = p.Recorder, "recorder"
+		case i <= len(p.Filters):
+			c, name = p.Filters[i-1], fmt.Sprintf("filter #%d", i-1)
+		default:
+			c, name = p.Player, "player"
+		}
+		if c == nil {
+			return
+		}
+		if err := c.Close(); err != nil {
+			p.closeErrs[i] = errors.Wrapf(err, "%s: could not close", name)
+		}
+	})
+	return p.closeErrs[i]
+}
+
+// close closes all stages and returns the first error.
+func (p *Pipeline) close() (err error) {
+	for i := range p.closeOnce {
+		if cErr := p.closeStage(i); cErr != nil && err == nil {
+			err = cErr
+		}
+	}
+	return err
+}
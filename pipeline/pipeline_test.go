@@ -0,0 +1,281 @@
+package pipeline_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ebiiim/eq/filter"
+	"github.com/ebiiim/eq/filter/function"
+	"github.com/ebiiim/eq/pcm"
+	"github.com/ebiiim/eq/pipeline"
+	"github.com/google/go-cmp/cmp"
+)
+
+// recorder reads from r and blocks when r is exhausted (if block is true) until closed.
+type recorder struct {
+	r      io.Reader
+	block  bool
+	err    error
+	format pcm.Format
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newRecorder(r io.Reader, block bool, err error) *recorder {
+	return &recorder{r: r, block: block, err: err, closed: make(chan struct{})}
+}
+
+func (r *recorder) Read(b []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := io.ReadFull(r.r, b)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	if err == io.EOF && r.block {
+		<-r.closed
+		return n, errors.New("closed")
+	}
+	return n, err
+}
+
+func (r *recorder) Close() error {
+	r.once.Do(func() { close(r.closed) })
+	return nil
+}
+
+func (r *recorder) OutputFormat() pcm.Format {
+	return r.format
+}
+
+type player struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	closed bool
+}
+
+func (p *player) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.buf.Write(b)
+}
+
+func (p *player) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return nil
+}
+
+func (p *player) InputFormat() pcm.Format {
+	return pcm.Default
+}
+
+func (p *player) result() ([]byte, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.buf.Bytes(), p.closed
+}
+
+func TestPipeline_Run(t *testing.T) {
+	errRead := errors.New("read error")
+	s24 := pcm.Format{Channels: 2, SampleRate: 48000, BitDepth: 24, Encoding: pcm.Signed, ByteOrder: pcm.Default.ByteOrder}
+	cases := []struct {
+		name      string
+		r         *recorder
+		fns       []func([]byte)
+		chunkSize int
+		cancel    bool
+		want      []byte
+		isErr     bool
+	}{
+		{"eof", newRecorder(bytes.NewReader([]byte("hello, world")), false, nil), []func([]byte){function.ToUpper, function.Rot13}, 1, false, []byte("URYYB, JBEYQ"), false},
+		{"eof_partial_chunk", newRecorder(bytes.NewReader([]byte("hello, world!")), false, nil), []func([]byte){function.ToUpper, function.Rot13}, 2, false, []byte("URYYB, JBEYQ!"), false},
+		{"no_filter", newRecorder(bytes.NewReader([]byte("hello")), false, nil), nil, 1, false, []byte("hello"), false},
+		{"cancel", newRecorder(bytes.NewReader([]byte("hello, w")), true, nil), []func([]byte){function.ToUpper}, 1, true, []byte("HELLO, W"), true},
+		{"F_recorder", newRecorder(nil, false, errRead), []func([]byte){function.ToUpper}, 1, false, nil, true},
+		{"F_format", &recorder{r: bytes.NewReader([]byte("hello")), format: s24, closed: make(chan struct{})}, nil, 1, false, nil, true},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			var fs []filter.Filter
+			for _, fn := range c.fns {
+				f := &function.Filter{ChunkSize: c.chunkSize}
+				f.Func.Set(fn)
+				fs = append(fs, f)
+			}
+			var p player
+			pl := pipeline.Pipeline{Recorder: c.r, Filters: fs, Player: &p, BufferSize: 4}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if c.cancel {
+				go func() {
+					time.Sleep(100 * time.Millisecond)
+					cancel()
+				}()
+			}
+			err := pl.Run(ctx)
+			if !((err != nil) == c.isErr) {
+				t.Errorf("got %v, want %v(isErr) ", err, c.isErr)
+			}
+			if c.cancel && err != context.Canceled {
+				t.Errorf("got %v want %v", err, context.Canceled)
+			}
+			got, closed := p.result()
+			if !closed {
+				t.Error("player is not closed")
+			}
+			if !cmp.Equal(got, c.want, cmp.Comparer(bytes.Equal)) {
+				t.Errorf("got %q want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestPipeline_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	f := &function.Filter{ChunkSize: 4}
+	f.Func.Set(func(b []byte) {
+		<-release // stalls until the first timeout
+		function.ToUpper(b)
+	})
+	var timeouts []int
+	var p player
+	pl := pipeline.Pipeline{
+		Recorder:   newRecorder(bytes.NewReader([]byte("hello, w")), false, nil),
+		Filters:    []filter.Filter{f},
+		Player:     &p,
+		BufferSize: 4,
+		Timeout:    50 * time.Millisecond,
+		OnTimeout: func(i int) {
+			if len(timeouts) == 0 {
+				close(release)
+			}
+			timeouts = append(timeouts, i)
+		},
+	}
+	err := pl.Run(context.Background())
+	if err != nil {
+		t.Fatalf("could not run: %v", err)
+	}
+	if diff := cmp.Diff([]int{0}, timeouts); diff != "" {
+		t.Errorf("timeouts (-want +got)\n%s", diff)
+	}
+	// silence, and then the delayed data
+	got, _ := p.result()
+	if want := []byte("\x00\x00\x00\x00HELLO, W"); !bytes.Equal(got, want) {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+// lagFilter passes data through, but accepts only a part of the first write
+// and outputs only a part of the first read before timing out.
+type lagFilter struct {
+	buf         bytes.Buffer
+	wrote, read bool
+}
+
+func (f *lagFilter) Write(b []byte) (int, error) {
+	if !f.wrote {
+		f.wrote = true
+		n, _ := f.buf.Write(b[:5])
+		return n, filter.ErrTimeout
+	}
+	return f.buf.Write(b)
+}
+
+func (f *lagFilter) Read(b []byte) (int, error) {
+	if !f.read {
+		f.read = true
+		n, _ := f.buf.Read(b[:6])
+		return n, filter.ErrTimeout
+	}
+	return f.buf.Read(b)
+}
+
+func (f *lagFilter) Close() error {
+	return nil
+}
+
+func TestPipeline_PartialTimeout(t *testing.T) {
+	var timeouts []int
+	var p player
+	pl := pipeline.Pipeline{
+		Recorder:   newRecorder(bytes.NewReader([]byte("ABCDEFGHIJKLMNOP")), false, nil),
+		Filters:    []filter.Filter{&lagFilter{}},
+		Player:     &p,
+		BufferSize: 8,
+		Timeout:    50 * time.Millisecond,
+		OnTimeout:  func(i int) { timeouts = append(timeouts, i) },
+	}
+	err := pl.Run(context.Background())
+	if err != nil {
+		t.Fatalf("could not run: %v", err)
+	}
+	if diff := cmp.Diff([]int{0, 0}, timeouts); diff != "" {
+		t.Errorf("timeouts (-want +got)\n%s", diff)
+	}
+	// the short write: silence
+	// the partial read of 6 bytes: a whole frame (4 bytes) and silence
+	// and then the rest including the incomplete frame
+	got, _ := p.result()
+	if want := []byte("\x00\x00\x00\x00\x00\x00\x00\x00ABCD\x00\x00\x00\x00EFGHIJKLMNOP"); !bytes.Equal(got, want) {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+// blockingFilter blocks in Read until closed.
+type blockingFilter struct {
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (f *blockingFilter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (f *blockingFilter) Read(b []byte) (int, error) {
+	<-f.closed
+	return 0, errors.New("closed")
+}
+
+func (f *blockingFilter) Close() error {
+	f.once.Do(func() { close(f.closed) })
+	return nil
+}
+
+func TestPipeline_CancelBlockingFilter(t *testing.T) {
+	var p player
+	pl := pipeline.Pipeline{
+		Recorder:   newRecorder(bytes.NewReader(make([]byte, 64)), true, nil),
+		Filters:    []filter.Filter{&blockingFilter{closed: make(chan struct{})}},
+		Player:     &p,
+		BufferSize: 4,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- pl.Run(ctx)
+	}()
+	select {
+	case err := <-errCh:
+		if err != context.DeadlineExceeded {
+			t.Errorf("got %v want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run does not return")
+	}
+	if _, closed := p.result(); !closed {
+		t.Error("player is not closed")
+	}
+}
@@ -4,17 +4,19 @@ package alice
 import (
 	"io"
 	"sync"
-	"time"
 
 	"github.com/ebiiim/eq/internal/safe"
+	"github.com/ebiiim/eq/streamio"
 	"github.com/pkg/errors"
 )
 
 // Player is a slow writable device that emulates an audio output device.
 type Player struct {
 	initOnce     sync.Once
+	closeOnce    sync.Once
+	wg           sync.WaitGroup
 	writer       io.Writer
-	writerBuffer safe.Buffer
+	writerBuffer safe.BlockingBuffer // closed with streamio.ErrClosed by Close, or with an error occurred in the goroutine
 	bufLen       int
 }
 
@@ -25,22 +27,25 @@ func NewPlayer(writer io.Writer, bufferSize int) (p *Player, err error) {
 }
 
 func (p *Player) initialize() {
+	p.wg.Add(1)
 	go func() {
+		defer p.wg.Done()
 		for {
 			gErr := p.play()
+			if errors.Cause(gErr) == streamio.ErrClosed {
+				return
+			}
 			if gErr != nil {
-				panic(gErr) // this error should not occur
+				p.writerBuffer.CloseWithError(gErr)
+				return
 			}
 		}
 	}()
 }
 
 func (p *Player) play() error {
-	for p.writerBuffer.Len() < p.bufLen {
-		time.Sleep(100 * time.Millisecond) // wait for record
-	}
 	buf := make([]byte, p.bufLen)
-	_, err := p.writerBuffer.Read(buf)
+	_, err := p.writerBuffer.Read(buf) // blocks until len(buf) bytes are written
 	if err != nil {
 		return errors.Wrap(err, "failed to get data from writerBuffer")
 	}
@@ -55,13 +60,22 @@ func (p *Player) play() error {
 //
 // The first call to this function invokes a goroutine
 // that reads the playback buffer sequentially to emulate an audio output device.
+//
+// The function returns streamio.ErrClosed after Close,
+// or the error that stopped the goroutine (e.g. the writer failed).
 func (p *Player) Write(b []byte) (n int, err error) {
 	p.initOnce.Do(p.initialize)
 	return p.writerBuffer.Write(b)
 }
 
 // Close terminates Player.
+//
+// The function blocks until the goroutine exits.
 func (p *Player) Close() error {
-	// TODO: terminate the goroutine
+	p.closeOnce.Do(func() {
+		p.initOnce.Do(func() {}) // never start the goroutine after Close
+		p.writerBuffer.CloseWithError(streamio.ErrClosed)
+		p.wg.Wait()
+	})
 	return nil
 }
@@ -2,13 +2,21 @@ package alice_test
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/ebiiim/eq/internal/leaktest"
+	"github.com/ebiiim/eq/streamio"
 	"github.com/ebiiim/eq/streamio/alice"
 )
 
+func TestMain(m *testing.M) {
+	leaktest.Main(m, "github.com/ebiiim/eq/streamio/alice")
+}
+
 func TestNewPlayer(t *testing.T) {
 	cases := []struct {
 		name    string
@@ -32,6 +40,7 @@ func TestNewPlayer(t *testing.T) {
 			if !((err != nil) == c.isErr) {
 				t.Errorf("got %v, want %v(isErr) ", err, c.isErr)
 			}
+			got.Close()
 		})
 	}
 
@@ -85,6 +94,7 @@ func TestPlayer_Write(t *testing.T) {
 					t.Errorf("invalid read length idx %d got %d want %d data %v", i, n, c.bufLen, got)
 				}
 			}
+			c.p.Close()
 		})
 	}
 }
@@ -109,6 +119,38 @@ func TestPlayer_Close(t *testing.T) {
 			if !((err != nil) == c.isErr) {
 				t.Errorf("got %v, want %v(isErr) ", err, c.isErr)
 			}
+			_, err = c.p.Write(make([]byte, 8))
+			if err != streamio.ErrClosed {
+				t.Errorf("got %v want %v", err, streamio.ErrClosed)
+			}
+			err = c.p.Close()
+			if err != nil {
+				t.Errorf("could not close twice: %v", err)
+			}
 		})
 	}
 }
+
+type errWriter struct{}
+
+func (errWriter) Write(b []byte) (int, error) {
+	return 0, errors.New("write error")
+}
+
+func TestPlayer_WriteError(t *testing.T) {
+	p, err := alice.NewPlayer(errWriter{}, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	for i := 0; i < 50; i++ { // the goroutine stops within 100ms
+		_, err = p.Write(make([]byte, 8))
+		if err != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err == nil || err == streamio.ErrClosed {
+		t.Errorf("got %v want write error", err)
+	}
+}
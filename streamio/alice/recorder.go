@@ -5,57 +5,80 @@ import (
 	"time"
 
 	"github.com/ebiiim/eq/internal/safe"
+	"github.com/ebiiim/eq/streamio"
 )
 
+const text = "Down the Rabbit-Hole\nAlice was beginning to get very tired of sitting by her sister on the bank, and of having nothing to do: once or twice she had peeped into the book her sister was reading, but it had no pictures or conversations in it, `and what is the use of a book,' thought Alice `without pictures or conversation?'\nSo she was considering in her own mind (as well as she could, for the hot day made her feel very sleepy and stupid), whether the pleasure of making a daisy-chain would be worth the trouble of getting up and picking the daisies, when suddenly a White Rabbit with pink eyes ran close by her.\n"
+
 // Recorder is a slow readable device that emulates an audio input device.
 type Recorder struct {
+	// Once makes Recorder a finite source that stops after the text is recorded once,
+	// so that Read returns io.EOF at the end (default: false, repeats the text forever).
+	Once bool
+
 	initOnce     sync.Once
-	readerBuffer safe.Buffer
+	closeOnce    sync.Once
+	done         chan struct{} // This channel should only be initialized by initialize() and by closed by Close()
+	wg           sync.WaitGroup
+	readerBuffer safe.BlockingBuffer
 }
 
 func (r *Recorder) initialize() {
+	r.done = make(chan struct{})
+	r.wg.Add(1)
 	go func() {
+		defer r.wg.Done()
 		for {
-			gErr := r.record()
-			if gErr != nil {
-				panic(gErr) // this error should not occur
+			if !r.record() {
+				return
+			}
+			if r.Once {
+				r.readerBuffer.CloseWrite()
+				return
 			}
 		}
 	}()
 }
 
-func (r *Recorder) record() error {
-	bs := []byte("Down the Rabbit-Hole\nAlice was beginning to get very tired of sitting by her sister on the bank, and of having nothing to do: once or twice she had peeped into the book her sister was reading, but it had no pictures or conversations in it, `and what is the use of a book,' thought Alice `without pictures or conversation?'\nSo she was considering in her own mind (as well as she could, for the hot day made her feel very sleepy and stupid), whether the pleasure of making a daisy-chain would be worth the trouble of getting up and picking the daisies, when suddenly a White Rabbit with pink eyes ran close by her.\n")
-	for i := 0; i < len(bs); i++ {
-		_, err := r.readerBuffer.Write([]byte{bs[i]})
-		if err != nil {
-			return err
+// record writes the text into the record buffer character by character
+// and returns false if Recorder is closed.
+func (r *Recorder) record() bool {
+	for i := 0; i < len(text); i++ {
+		select {
+		case <-r.done:
+			return false
+		case <-time.After(8 * time.Millisecond):
 		}
-		time.Sleep(8 * time.Millisecond)
+		r.readerBuffer.Write([]byte{text[i]}) // fails only after Close
 	}
-	return nil
+	return true
 }
 
 // Read reads len(b) bytes from the record buffer into b.
 //
 // The function blocks until it reads len(b) bytes or more.
-// The function does not support ioutil.ReadAll (blocks permanently).
+// If Once is true, the function returns the remaining data at the end of the text
+// and then io.EOF, so ioutil.ReadAll is supported.
+// The function returns streamio.ErrClosed after Close.
 //
 // The first call to this function invokes a goroutine
 // that sequentially writes characters (from "Alice's Adventures in Wonderland")
 // into the record buffer, to emulate an audio input device.
 func (r *Recorder) Read(b []byte) (n int, err error) {
 	r.initOnce.Do(r.initialize)
-
-	readLen := len(b)
-	for r.readerBuffer.Len() < readLen {
-		time.Sleep(500 * time.Millisecond) // wait for record
-	}
 	return r.readerBuffer.Read(b)
 }
 
 // Close terminates Recorder.
+//
+// The function blocks until the goroutine exits,
+// and unblocks Read waiting for data.
 func (r *Recorder) Close() error {
-	// TODO: terminate the goroutine
+	r.closeOnce.Do(func() {
+		r.initOnce.Do(func() { r.done = make(chan struct{}) }) // never start the goroutine after Close
+		r.readerBuffer.CloseWithError(streamio.ErrClosed)
+		close(r.done)
+		r.wg.Wait()
+	})
 	return nil
 }
@@ -1,8 +1,13 @@
 package alice_test
 
 import (
+	"io"
+	"io/ioutil"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/ebiiim/eq/streamio"
 	"github.com/ebiiim/eq/streamio/alice"
 	"github.com/google/go-cmp/cmp"
 )
@@ -31,6 +36,7 @@ func TestRecorder_Read(t *testing.T) {
 					t.Errorf("idx %v got %v want %v", i, got, v)
 				}
 			}
+			c.r.Close()
 		})
 	}
 }
@@ -54,6 +60,53 @@ func TestRecorder_Close(t *testing.T) {
 			if !((err != nil) == c.isErr) {
 				t.Errorf("got %v, want %v(isErr) ", err, c.isErr)
 			}
+			_, err = c.r.Read(make([]byte, 8))
+			if err != streamio.ErrClosed {
+				t.Errorf("got %v want %v", err, streamio.ErrClosed)
+			}
+			err = c.r.Close()
+			if err != nil {
+				t.Errorf("could not close twice: %v", err)
+			}
 		})
 	}
 }
+
+func TestRecorder_CloseWhileReading(t *testing.T) {
+	r := &alice.Recorder{}
+	errCh := make(chan error)
+	go func() {
+		_, err := r.Read(make([]byte, 4096)) // never fulfilled
+		errCh <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	err := r.Close()
+	if err != nil {
+		t.Errorf("could not close: %v", err)
+	}
+	select {
+	case err = <-errCh:
+		if err != streamio.ErrClosed {
+			t.Errorf("got %v want %v", err, streamio.ErrClosed)
+		}
+	case <-time.After(time.Second):
+		t.Error("Read is not unblocked by Close")
+	}
+}
+
+func TestRecorder_Once(t *testing.T) {
+	t.Parallel()
+	r := &alice.Recorder{Once: true}
+	defer r.Close()
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if !strings.HasPrefix(string(got), "Down the Rabbit-Hole\n") || !strings.HasSuffix(string(got), "ran close by her.\n") {
+		t.Errorf("got %q", got)
+	}
+	n, err := r.Read(make([]byte, 1))
+	if n != 0 || err != io.EOF {
+		t.Errorf("got (%d, %v) want (0, %v)", n, err, io.EOF)
+	}
+}
@@ -0,0 +1,386 @@
+package portaudio
+
+import (
+	"sync"
+
+	"github.com/JulianKnodt/portaudio"
+	"github.com/ebiiim/eq/internal/safe"
+	"github.com/ebiiim/eq/pcm"
+	"github.com/ebiiim/eq/streamio"
+	"github.com/pkg/errors"
+)
+
+// ringBufferCount is the number of device buffers that the ring buffer of callback streams holds.
+const ringBufferCount = 8
+
+// CallbackPlayer is a writable PortAudio output device in callback mode.
+//
+// Unlike Player, CallbackPlayer has no goroutine;
+// PortAudio pulls samples from a preallocated lock-free ring buffer,
+// and plays silence if the ring buffer runs out of data.
+type CallbackPlayer struct {
+	stream    *portaudio.Stream
+	format    pcm.Format
+	ring      *safe.Ring
+	space     chan struct{} // notified by the callback after consuming samples
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+	stats     *stats
+	starving  bool // accessed only by the callback
+
+	writeMu sync.Mutex // Write is the only producer of ring
+	scratch []int16
+	pending []byte // a byte of an incomplete sample
+}
+
+// NewCallbackPlayer initialize a CallbackPlayer object.
+//
+// bufferSize is the number of frames per device buffer.
+// Use OutputDeviceID to get the device ID from a device name (-1 means the default device).
+// Only signed 16-bit formats are supported.
+func NewCallbackPlayer(outputDeviceID int, bufferSize int, format pcm.Format) (p *CallbackPlayer, err error) {
+	err = validateFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	size := ringBufferCount * bufferSize * format.Channels
+	p = &CallbackPlayer{
+		format:   format,
+		stats:    newStats(),
+		ring:     safe.NewRing(size),
+		space:    make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		starving: true, // no underrun until the first Write
+		scratch:  make([]int16, bufferSize*format.Channels),
+		pending:  make([]byte, 0, format.SampleSize()),
+	}
+	// initialize Player
+	err = portaudio.Initialize()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize Player")
+	}
+	// open an output stream
+	p.stream, err = OpenStream(-1, outputDeviceID, 0, format.Channels, float64(format.SampleRate), bufferSize, p.callback)
+	if err != nil {
+		portaudio.Terminate()
+		return nil, errors.Wrap(err, "failed to open stream")
+	}
+	// start the stream
+	err = p.stream.Start()
+	if err != nil {
+		p.stream.Close()
+		portaudio.Terminate()
+		return nil, errors.Wrap(err, "failed to start stream")
+	}
+	return p, nil
+}
+
+// callback is called by PortAudio and must not block.
+func (p *CallbackPlayer) callback(out []int16, _ portaudio.StreamCallbackTimeInfo, flags portaudio.StreamCallbackFlags) {
+	n := p.ring.Read(out)
+	for i := n; i < len(out); i++ {
+		out[i] = 0 // underrun
+	}
+	switch {
+	case n < len(out) && !p.starving: // count once until data arrive again
+		p.stats.underrun(n > 0)
+	case flags&portaudio.OutputUnderflow != 0:
+		p.stats.underrun(false)
+	}
+	p.starving = n < len(out)
+	select {
+	case p.space <- struct{}{}:
+	default:
+	}
+}
+
+// Write writes len(b) bytes from b to the ring buffer.
+//
+// The function blocks while the ring buffer is full.
+// The function returns streamio.ErrClosed after Close.
+func (p *CallbackPlayer) Write(b []byte) (n int, err error) {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	if p.isClosed() {
+		return 0, streamio.ErrClosed
+	}
+
+	ss := p.format.SampleSize()
+	for n < len(b) {
+		// complete the pending sample
+		if len(p.pending) > 0 {
+			m := copy(p.pending[len(p.pending):ss], b[n:])
+			p.pending = p.pending[:len(p.pending)+m]
+			n += m
+			if len(p.pending) < ss {
+				break
+			}
+			p.scratch[0] = int16(p.format.ByteOrder.Uint16(p.pending))
+			p.pending = p.pending[:0]
+			err = p.push(p.scratch[:1])
+			if err != nil {
+				return n, err
+			}
+			continue
+		}
+		// convert []byte -> []int16
+		k := (len(b) - n) / ss
+		if k > len(p.scratch) {
+			k = len(p.scratch)
+		}
+		for i := 0; i < k; i++ {
+			p.scratch[i] = int16(p.format.ByteOrder.Uint16(b[n+i*ss:]))
+		}
+		if k == 0 { // less than a sample
+			p.pending = append(p.pending, b[n:]...)
+			n = len(b)
+			break
+		}
+		n += k * ss
+		err = p.push(p.scratch[:k])
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// push writes s to the ring buffer and waits for the callback if it is full.
+func (p *CallbackPlayer) push(s []int16) error {
+	for {
+		s = s[p.ring.Write(s):]
+		if len(s) == 0 {
+			return nil
+		}
+		select {
+		case <-p.space:
+		case <-p.done:
+			return streamio.ErrClosed
+		}
+	}
+}
+
+func (p *CallbackPlayer) isClosed() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// InputFormat returns the format of the stream that CallbackPlayer accepts.
+func (p *CallbackPlayer) InputFormat() pcm.Format {
+	return p.format
+}
+
+// Stats returns a snapshot of the counters of glitches.
+//
+// An underrun is counted each time the ring buffer runs out of data
+// (once until Write catches up) or the device reports one.
+func (p *CallbackPlayer) Stats() streamio.Stats {
+	return p.stats.get()
+}
+
+// SetStatsHook sets fn to be called with a snapshot after the counters change.
+//
+// fn is not called from the PortAudio callback but from a goroutine of the stats
+// (changes in quick succession are reported once).
+func (p *CallbackPlayer) SetStatsHook(fn func(streamio.Stats)) {
+	p.stats.setHook(fn)
+}
+
+// Close terminates CallbackPlayer.
+//
+// Write waiting for the ring buffer is unblocked,
+// and data that have not been played are discarded.
+func (p *CallbackPlayer) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.done)
+		p.closeErr = terminate(p.stream)
+		p.stats.close()
+	})
+	return p.closeErr
+}
+
+// CallbackRecorder is a readable PortAudio input device in callback mode.
+//
+// Unlike Recorder, CallbackRecorder has no goroutine;
+// PortAudio pushes samples into a preallocated lock-free ring buffer,
+// and drops them if the ring buffer is full.
+type CallbackRecorder struct {
+	stream    *portaudio.Stream
+	format    pcm.Format
+	ring      *safe.Ring
+	data      chan struct{} // notified by the callback after producing samples
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+	stats     *stats
+
+	readMu  sync.Mutex // Read is the only consumer of ring
+	scratch []int16
+	rest    []byte // bytes of a sample that did not fit in the previous Read
+}
+
+// NewCallbackRecorder initialize a CallbackRecorder object.
+//
+// bufferSize is the number of frames per device buffer.
+// Use InputDeviceID to get the device ID from a device name (-1 means the default device).
+// Only signed 16-bit formats are supported.
+func NewCallbackRecorder(inputDeviceID int, bufferSize int, format pcm.Format) (r *CallbackRecorder, err error) {
+	err = validateFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	size := ringBufferCount * bufferSize * format.Channels
+	r = &CallbackRecorder{
+		format:  format,
+		stats:   newStats(),
+		ring:    safe.NewRing(size),
+		data:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		scratch: make([]int16, bufferSize*format.Channels),
+		rest:    make([]byte, 0, format.SampleSize()),
+	}
+	// initialize Recorder
+	err = portaudio.Initialize()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize Recorder")
+	}
+	// open an input stream
+	r.stream, err = OpenStream(inputDeviceID, -1, format.Channels, 0, float64(format.SampleRate), bufferSize, r.callback)
+	if err != nil {
+		portaudio.Terminate()
+		return nil, errors.Wrap(err, "failed to open stream")
+	}
+	// start the stream
+	err = r.stream.Start()
+	if err != nil {
+		r.stream.Close()
+		portaudio.Terminate()
+		return nil, errors.Wrap(err, "failed to start stream")
+	}
+	return r, nil
+}
+
+// callback is called by PortAudio and must not block.
+func (r *CallbackRecorder) callback(in []int16, _ portaudio.StreamCallbackTimeInfo, flags portaudio.StreamCallbackFlags) {
+	n := r.ring.Write(in) // drops samples that do not fit
+	switch {
+	case n < len(in):
+		r.stats.overrun((len(in)-n)*r.format.SampleSize(), n > 0)
+	case flags&portaudio.InputOverflow != 0:
+		r.stats.overrun(0, false)
+	}
+	select {
+	case r.data <- struct{}{}:
+	default:
+	}
+}
+
+// Read reads len(b) bytes from the ring buffer into b.
+//
+// The function blocks until it reads len(b) bytes.
+// The function never returns io.EOF as the device does not reach the end of the stream.
+// The function returns streamio.ErrClosed after Close.
+func (r *CallbackRecorder) Read(b []byte) (n int, err error) {
+	r.readMu.Lock()
+	defer r.readMu.Unlock()
+	if r.isClosed() {
+		return 0, streamio.ErrClosed
+	}
+
+	ss := r.format.SampleSize()
+	n = copy(b, r.rest)
+	r.rest = r.rest[:copy(r.rest, r.rest[n:])]
+	for n < len(b) {
+		k := (len(b) - n + ss - 1) / ss // samples needed (including an incomplete one)
+		if k > len(r.scratch) {
+			k = len(r.scratch)
+		}
+		k = r.ring.Read(r.scratch[:k])
+		if k == 0 {
+			select {
+			case <-r.data:
+				continue
+			case <-r.done:
+				return n, streamio.ErrClosed
+			}
+		}
+		// convert []int16 -> []byte
+		for i := 0; i < k; i++ {
+			if len(b)-n < ss { // the last sample does not fit
+				r.rest = r.rest[:ss]
+				r.format.ByteOrder.PutUint16(r.rest, uint16(r.scratch[i]))
+				m := copy(b[n:], r.rest)
+				n += m
+				r.rest = r.rest[:copy(r.rest, r.rest[m:])]
+				break
+			}
+			r.format.ByteOrder.PutUint16(b[n:], uint16(r.scratch[i]))
+			n += ss
+		}
+	}
+	return n, nil
+}
+
+func (r *CallbackRecorder) isClosed() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// OutputFormat returns the format of the stream that CallbackRecorder produces.
+func (r *CallbackRecorder) OutputFormat() pcm.Format {
+	return r.format
+}
+
+// Stats returns a snapshot of the counters of glitches.
+//
+// An overrun is counted each time the ring buffer is full (Read does not keep up)
+// or the device reports one.
+func (r *CallbackRecorder) Stats() streamio.Stats {
+	return r.stats.get()
+}
+
+// SetStatsHook sets fn to be called with a snapshot after the counters change.
+//
+// fn is not called from the PortAudio callback but from a goroutine of the stats
+// (changes in quick succession are reported once).
+func (r *CallbackRecorder) SetStatsHook(fn func(streamio.Stats)) {
+	r.stats.setHook(fn)
+}
+
+// Close terminates CallbackRecorder.
+//
+// Read waiting for data is unblocked.
+func (r *CallbackRecorder) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.done)
+		r.closeErr = terminate(r.stream)
+		r.stats.close()
+	})
+	return r.closeErr
+}
+
+// terminate stops and closes s, and then terminates PortAudio.
+func terminate(s *portaudio.Stream) (err error) {
+	err = s.Stop()
+	if err != nil {
+		return errors.Wrap(err, "failed to stop stream")
+	}
+	err = s.Close()
+	if err != nil {
+		return errors.Wrap(err, "failed to close stream")
+	}
+	err = portaudio.Terminate()
+	if err != nil {
+		return errors.Wrap(err, "failed to terminate PortAudio")
+	}
+	return nil
+}
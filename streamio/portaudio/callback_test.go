@@ -0,0 +1,94 @@
+package portaudio_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ebiiim/eq/pcm"
+	"github.com/ebiiim/eq/streamio"
+	"github.com/ebiiim/eq/streamio/portaudio"
+)
+
+func TestNewCallbackPlayer(t *testing.T) {
+	cases := []struct {
+		name  string
+		f     pcm.Format
+		isErr bool
+	}{
+		{"float", pcm.Format{Channels: 2, SampleRate: 48000, BitDepth: 32, Encoding: pcm.Float, ByteOrder: pcm.Default.ByteOrder}, true},
+		{"zero", pcm.Format{}, true},
+		// NOTE: valid formats are tested in TestCallbackPlayer_Close as the result depends on sound devices
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := portaudio.NewCallbackPlayer(-1, 1024, c.f)
+			if !((err != nil) == c.isErr) {
+				t.Errorf("got %v, want %v(isErr) ", err, c.isErr)
+			}
+		})
+	}
+}
+
+func TestCallbackPlayer_Close(t *testing.T) {
+	cases := []struct {
+		name string
+		fn   func(p *portaudio.CallbackPlayer)
+	}{
+		{"init", func(p *portaudio.CallbackPlayer) {}},
+		{"after_write", func(p *portaudio.CallbackPlayer) { p.Write(make([]byte, 1025)) }},
+		{"while_writing", func(p *portaudio.CallbackPlayer) {
+			go p.Write(make([]byte, 1024*1024)) // larger than the ring buffer
+			time.Sleep(100 * time.Millisecond)
+		}},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			p, err := portaudio.NewCallbackPlayer(-1, 1024, pcm.Default)
+			if err != nil {
+				t.Fatalf("could not init player: %v", err)
+			}
+			c.fn(p)
+			err = p.Close()
+			if err != nil {
+				t.Errorf("could not close: %v", err)
+			}
+			_, err = p.Write(make([]byte, 1024))
+			if err != streamio.ErrClosed {
+				t.Errorf("got %v want %v", err, streamio.ErrClosed)
+			}
+		})
+	}
+}
+
+func TestCallbackRecorder_Close(t *testing.T) {
+	r, err := portaudio.NewCallbackRecorder(-1, 1024, pcm.Default)
+	if err != nil {
+		t.Fatalf("could not init recorder: %v", err)
+	}
+	errCh := make(chan error)
+	go func() {
+		_, err := r.Read(make([]byte, 1024*1024)) // larger than the ring buffer
+		errCh <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	err = r.Close()
+	if err != nil {
+		t.Errorf("could not close: %v", err)
+	}
+	select {
+	case err = <-errCh:
+		if err != streamio.ErrClosed {
+			t.Errorf("got %v want %v", err, streamio.ErrClosed)
+		}
+	case <-time.After(time.Second):
+		t.Error("Read is not unblocked by Close")
+	}
+	_, err = r.Read(make([]byte, 1024))
+	if err != streamio.ErrClosed {
+		t.Errorf("got %v want %v", err, streamio.ErrClosed)
+	}
+}
@@ -3,36 +3,162 @@ package portaudio
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/JulianKnodt/portaudio"
+	"github.com/ebiiim/eq/pcm"
 	"github.com/pkg/errors"
 )
 
-// ListDevices returns a slice of string containing device info on each line.
-func ListDevices() ([]string, error) {
-	err := portaudio.Initialize()
+// Device holds information about an audio device.
+type Device struct {
+	// ID is the index of the device that NewRecorder and NewPlayer accept.
+	//
+	// IDs may change when devices are added or removed, so use the Name to remember a device.
+	ID                       int
+	Name                     string
+	HostAPI                  string
+	MaxInputChannels         int
+	MaxOutputChannels        int
+	DefaultSampleRate        float64
+	DefaultLowInputLatency   time.Duration
+	DefaultLowOutputLatency  time.Duration
+	DefaultHighInputLatency  time.Duration
+	DefaultHighOutputLatency time.Duration
+	IsDefaultInput           bool
+	IsDefaultOutput          bool
+}
+
+// ErrDeviceNotFound is returned when no device matches the query.
+var ErrDeviceNotFound = errors.New("device not found")
+
+// Devices returns all audio devices.
+func Devices() (ds []Device, err error) {
+	err = portaudio.Initialize()
 	if err != nil {
 		return nil, err
 	}
 	defer func() {
 		tErr := portaudio.Terminate()
-		if tErr != nil {
+		if tErr == nil {
+			return
+		}
+		if err == nil {
+			ds, err = nil, errors.Wrap(tErr, "failed to terminate PortAudio")
+		} else {
 			err = errors.Wrapf(err, "(%v)", tErr)
 		}
 	}()
 
-	ds, err := portaudio.Devices()
+	infos, err := portaudio.Devices()
+	if err != nil {
+		return nil, err
+	}
+	defIn, _ := portaudio.DefaultInputDevice() // nil if no default device
+	defOut, _ := portaudio.DefaultOutputDevice()
+	for i, v := range infos {
+		d := Device{
+			ID:                       i,
+			Name:                     v.Name,
+			MaxInputChannels:         v.MaxInputChannels,
+			MaxOutputChannels:        v.MaxOutputChannels,
+			DefaultSampleRate:        v.DefaultSampleRate,
+			DefaultLowInputLatency:   v.DefaultLowInputLatency,
+			DefaultLowOutputLatency:  v.DefaultLowOutputLatency,
+			DefaultHighInputLatency:  v.DefaultHighInputLatency,
+			DefaultHighOutputLatency: v.DefaultHighOutputLatency,
+			IsDefaultInput:           defIn != nil && v == defIn,
+			IsDefaultOutput:          defOut != nil && v == defOut,
+		}
+		if v.HostApi != nil {
+			d.HostAPI = v.HostApi.Name
+		}
+		ds = append(ds, d)
+	}
+	return ds, nil
+}
+
+// ListDevices returns a slice of string containing device info on each line.
+func ListDevices() ([]string, error) {
+	ds, err := Devices()
 	if err != nil {
 		return nil, err
 	}
 	var ss []string
-	for i, v := range ds {
-		s := fmt.Sprintf("ID: %d, Type: %s, Name: %s, InputCh: %d, OutputCh: %d", i, v.HostApi.Name, v.Name, v.MaxInputChannels, v.MaxOutputChannels)
+	for _, v := range ds {
+		s := fmt.Sprintf("ID: %d, Type: %s, Name: %s, InputCh: %d, OutputCh: %d", v.ID, v.HostAPI, v.Name, v.MaxInputChannels, v.MaxOutputChannels)
 		ss = append(ss, s)
 	}
 	return ss, nil
 }
 
+// FindDevice returns the device in ds whose name matches query.
+//
+// The function looks for the exact name first,
+// and then for names containing query case-insensitively.
+// It returns ErrDeviceNotFound if no device matches,
+// and an error if two or more devices match equally.
+func FindDevice(ds []Device, query string) (Device, error) {
+	var exact, sub []Device
+	q := strings.ToLower(query)
+	for _, d := range ds {
+		if d.Name == query {
+			exact = append(exact, d)
+		} else if strings.Contains(strings.ToLower(d.Name), q) {
+			sub = append(sub, d)
+		}
+	}
+	for _, m := range [][]Device{exact, sub} {
+		switch len(m) {
+		case 0:
+			continue
+		case 1:
+			return m[0], nil
+		default:
+			var names []string
+			for _, d := range m {
+				names = append(names, fmt.Sprintf("%q (ID: %d)", d.Name, d.ID))
+			}
+			return Device{}, errors.Errorf("ambiguous device %q matches %s", query, strings.Join(names, ", "))
+		}
+	}
+	return Device{}, errors.Wrapf(ErrDeviceNotFound, "%q", query)
+}
+
+// InputDeviceID returns the ID of the input device whose name matches name (see FindDevice),
+// or -1 (the default input device) if name is empty.
+func InputDeviceID(name string) (int, error) {
+	return deviceID(name, func(d Device) bool { return d.MaxInputChannels > 0 })
+}
+
+// OutputDeviceID returns the ID of the output device whose name matches name (see FindDevice),
+// or -1 (the default output device) if name is empty.
+func OutputDeviceID(name string) (int, error) {
+	return deviceID(name, func(d Device) bool { return d.MaxOutputChannels > 0 })
+}
+
+func deviceID(name string, ok func(Device) bool) (int, error) {
+	if name == "" {
+		return -1, nil
+	}
+	ds, err := Devices()
+	if err != nil {
+		return 0, err
+	}
+	var cs []Device
+	for _, d := range ds {
+		if ok(d) {
+			cs = append(cs, d)
+		}
+	}
+	d, err := FindDevice(cs, name)
+	if err != nil {
+		return 0, err
+	}
+	return d.ID, nil
+}
+
 // OpenStream opens a stream with device IDs that portaudio.OpenDefaultStream does not support.
 //
 // If the device ID is -1, the function uses the default input/output device.
@@ -82,3 +208,15 @@ func OpenStream(inputDeviceID, outputDeviceID int, numInputChannels, numOutputCh
 	p.FramesPerBuffer = framesPerBuffer
 	return portaudio.OpenStream(p, args...)
 }
+
+// validateFormat returns an error if f can not be used with PortAudio streams.
+func validateFormat(f pcm.Format) error {
+	err := f.Validate()
+	if err != nil {
+		return errors.Wrap(err, "invalid format")
+	}
+	if f.Encoding != pcm.Signed || f.BitDepth != 16 {
+		return errors.Errorf("unsupported format %v (signed 16-bit only)", f)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package portaudio_test
+
+import (
+	"testing"
+
+	"github.com/ebiiim/eq/streamio/portaudio"
+	"github.com/pkg/errors"
+)
+
+func TestFindDevice(t *testing.T) {
+	ds := []portaudio.Device{
+		{ID: 0, Name: "HDA Intel PCH: ALC892 Analog (hw:0,0)"},
+		{ID: 1, Name: "HDA Intel PCH: ALC892 Digital (hw:0,1)"},
+		{ID: 2, Name: "USB Audio"},
+		{ID: 3, Name: "USB Audio Device"},
+		{ID: 4, Name: "pulse"},
+		{ID: 5, Name: "default"},
+	}
+	cases := []struct {
+		name     string
+		query    string
+		want     int
+		isErr    bool
+		notFound bool
+	}{
+		{"exact", "pulse", 4, false, false},
+		{"exact_over_substring", "USB Audio", 2, false, false},
+		{"substring", "digital", 1, false, false},
+		{"substring_case", "usb audio dev", 3, false, false},
+		{"ambiguous", "alc892", 0, true, false},
+		{"not_found", "HDMI", 0, true, true},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := portaudio.FindDevice(ds, c.query)
+			if !((err != nil) == c.isErr) {
+				t.Errorf("got %v, want %v(isErr) ", err, c.isErr)
+			}
+			if (errors.Cause(err) == portaudio.ErrDeviceNotFound) != c.notFound {
+				t.Errorf("got %v, want not found %v", err, c.notFound)
+			}
+			if err == nil && got.ID != c.want {
+				t.Errorf("got ID %d want %d", got.ID, c.want)
+			}
+		})
+	}
+}
@@ -2,21 +2,28 @@ package portaudio
 
 import (
 	"encoding/binary"
-	"fmt"
-	"os"
-	"time"
+	"sync"
 
 	"github.com/JulianKnodt/portaudio"
 	"github.com/ebiiim/eq/internal/safe"
+	"github.com/ebiiim/eq/pcm"
+	"github.com/ebiiim/eq/streamio"
 	"github.com/pkg/errors"
 )
 
+// playerBufferCount is the number of device buffers that the playback buffer holds.
+const playerBufferCount = 8
+
 // Player is a writable PortAudio output device.
 type Player struct {
 	stream       *portaudio.Stream
 	playBuffer   *[]int16
-	byteOrder    binary.ByteOrder
-	writerBuffer safe.Buffer
+	format       pcm.Format
+	writerBuffer safe.BlockingBuffer // closed with streamio.ErrClosed by Close
+	wg           sync.WaitGroup
+	closeOnce    sync.Once
+	closeErr     error
+	stats        *stats
 }
 
 // NewPlayer initialize a Player object.
@@ -24,7 +31,14 @@ type Player struct {
 // This function invokes a goroutine
 // that sequentially reads data from the playback buffer
 // and writes the data to the audio output device.
-func NewPlayer(outputDeviceID int, bufferSize int, channels int, bitDepth int, sampleRate int, byteOrder binary.ByteOrder) (p *Player, err error) {
+//
+// Use OutputDeviceID to get the device ID from a device name (-1 means the default device).
+// Only signed 16-bit formats are supported.
+func NewPlayer(outputDeviceID int, bufferSize int, format pcm.Format) (p *Player, err error) {
+	err = validateFormat(format)
+	if err != nil {
+		return nil, err
+	}
 	playBuffer := make([]int16, bufferSize)
 	// initialize Player
 	err = portaudio.Initialize()
@@ -32,7 +46,7 @@ func NewPlayer(outputDeviceID int, bufferSize int, channels int, bitDepth int, s
 		return nil, errors.Wrap(err, "failed to initialize Player")
 	}
 	// open an input stream
-	stream, err := OpenStream(-1, outputDeviceID, 0, channels, float64(sampleRate), bufferSize, playBuffer)
+	stream, err := OpenStream(-1, outputDeviceID, 0, format.Channels, float64(format.SampleRate), bufferSize, playBuffer)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to open stream")
 	}
@@ -41,33 +55,39 @@ func NewPlayer(outputDeviceID int, bufferSize int, channels int, bitDepth int, s
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to start stream")
 	}
-	p = &Player{stream: stream, playBuffer: &playBuffer, byteOrder: byteOrder}
+	p = &Player{stream: stream, playBuffer: &playBuffer, format: format, stats: newStats()}
+	p.writerBuffer.Cap = playerBufferCount * bufferSize * format.SampleSize() // Write blocks if the device is behind
 	p.initialize()
 	return p, nil
 }
 
 func (p *Player) initialize() {
+	p.wg.Add(1)
 	go func() {
+		defer p.wg.Done()
 		for {
 			gErr := p.play()
+			if errors.Cause(gErr) == streamio.ErrClosed {
+				return
+			}
 			if gErr != nil {
-				// broken data detected
-				// NOTE: this is not a bug (in most cases), so puts a log instead of an error
-				fmt.Fprint(os.Stderr, "x")
+				// the buffer is discarded, but keeps playing as the device may recover
+				p.stats.fail(gErr, len(*p.playBuffer)*p.format.SampleSize())
 			}
 		}
 	}()
 }
 
 func (p *Player) play() error {
-	for p.writerBuffer.Len() < len(*p.playBuffer) {
-		time.Sleep(1 * time.Millisecond) // wait for record
-	}
-	err := binary.Read(&p.writerBuffer, p.byteOrder, p.playBuffer) // convert []int16 -> []byte
+	err := binary.Read(&p.writerBuffer, p.format.ByteOrder, p.playBuffer) // convert []byte -> []int16 (blocks until the data are written)
 	if err != nil {
 		return errors.Wrap(err, "failed to read PCM")
 	}
 	err = p.stream.Write() // write pcm data from the buffer to the play stream
+	if err == portaudio.OutputUnderflowed {
+		p.stats.underrun(false) // the data are played after a gap
+		return nil
+	}
 	if err != nil {
 		return errors.Wrap(err, "failed to play")
 	}
@@ -75,24 +95,41 @@ func (p *Player) play() error {
 }
 
 // Write writes len(b) bytes from b to the playback buffer.
+//
+// The function blocks while the playback buffer is full.
+// The function returns streamio.ErrClosed after Close.
 func (p *Player) Write(b []byte) (n int, err error) {
 	return p.writerBuffer.Write(b)
 }
 
+// InputFormat returns the format of the stream that Player accepts.
+func (p *Player) InputFormat() pcm.Format {
+	return p.format
+}
+
+// Stats returns a snapshot of the counters of glitches.
+//
+// Underruns are reported by the device when Write does not keep up with playback.
+func (p *Player) Stats() streamio.Stats {
+	return p.stats.get()
+}
+
+// SetStatsHook sets fn to be called with a snapshot after the counters change.
+//
+// fn is called from a goroutine of the stats (changes in quick succession are reported once).
+func (p *Player) SetStatsHook(fn func(streamio.Stats)) {
+	p.stats.setHook(fn)
+}
+
 // Close terminates Player.
-func (p *Player) Close() (err error) {
-	// TODO: terminate the goroutine
-	err = p.stream.Stop()
-	if err != nil {
-		return errors.Wrap(err, "failed to stop stream")
-	}
-	err = p.stream.Close()
-	if err != nil {
-		return errors.Wrap(err, "failed to close stream")
-	}
-	err = portaudio.Terminate()
-	if err != nil {
-		return errors.Wrap(err, "failed to terminate Player")
-	}
-	return nil
+//
+// The function blocks until the goroutine exits, and then closes the stream.
+func (p *Player) Close() error {
+	p.closeOnce.Do(func() {
+		p.writerBuffer.CloseWithError(streamio.ErrClosed)
+		p.wg.Wait()
+		p.closeErr = terminate(p.stream)
+		p.stats.close()
+	})
+	return p.closeErr
 }
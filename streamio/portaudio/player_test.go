@@ -1,12 +1,18 @@
 package portaudio_test
 
 import (
-	"encoding/binary"
 	"testing"
 
+	"github.com/ebiiim/eq/internal/leaktest"
+	"github.com/ebiiim/eq/pcm"
+	"github.com/ebiiim/eq/streamio"
 	"github.com/ebiiim/eq/streamio/portaudio"
 )
 
+func TestMain(m *testing.M) {
+	leaktest.Main(m, "github.com/ebiiim/eq/streamio/portaudio")
+}
+
 func TestNewPlayer(t *testing.T) {
 	// NOTE: currently, we do not test this function because the result depends on sound devices
 }
@@ -15,17 +21,17 @@ func initPlayers(t *testing.T) []*portaudio.Player {
 	t.Helper()
 	var ret []*portaudio.Player
 	ps := []struct {
-		bs, ch, b, r int
-		bo           binary.ByteOrder
+		bs int
+		f  pcm.Format
 	}{
-		{8192, 2, 16, 48000, binary.LittleEndian},
-		{8192, 2, 16, 48000, binary.LittleEndian},
-		{8192, 2, 16, 48000, binary.LittleEndian},
-		{8192, 2, 16, 48000, binary.LittleEndian},
-		{8192, 2, 16, 48000, binary.LittleEndian},
+		{8192, pcm.Default},
+		{8192, pcm.Default},
+		{8192, pcm.Default},
+		{8192, pcm.Default},
+		{8192, pcm.Default},
 	}
 	for i, v := range ps {
-		p, err := portaudio.NewPlayer(-1, v.bs, v.ch, v.b, v.r, v.bo)
+		p, err := portaudio.NewPlayer(-1, v.bs, v.f)
 		if err != nil {
 			t.Fatalf("could not init player #%d", i)
 		}
@@ -61,12 +67,18 @@ func TestPlayer_Write(t *testing.T) {
 					t.Errorf("invalid read length idx %d got %d want %d data %v", i, n, c.bufLen, got)
 				}
 			}
+			c.p.Close()
 		})
 	}
 }
 
 func TestPlayer_Close(t *testing.T) {
 	ps := initPlayers(t)
+	defer func() {
+		for _, p := range ps[2:] { // not used
+			p.Close()
+		}
+	}()
 	cases := []struct {
 		name  string
 		p     *portaudio.Player
@@ -85,6 +97,10 @@ func TestPlayer_Close(t *testing.T) {
 			if !((err != nil) == c.isErr) {
 				t.Errorf("got %v, want %v(isErr) ", err, c.isErr)
 			}
+			_, err = c.p.Write(make([]byte, 8192))
+			if err != streamio.ErrClosed {
+				t.Errorf("got %v want %v", err, streamio.ErrClosed)
+			}
 		})
 	}
 }
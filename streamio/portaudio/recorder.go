@@ -2,12 +2,12 @@ package portaudio
 
 import (
 	"encoding/binary"
-	"fmt"
-	"os"
-	"time"
+	"sync"
 
 	"github.com/JulianKnodt/portaudio"
 	"github.com/ebiiim/eq/internal/safe"
+	"github.com/ebiiim/eq/pcm"
+	"github.com/ebiiim/eq/streamio"
 	"github.com/pkg/errors"
 )
 
@@ -15,8 +15,13 @@ import (
 type Recorder struct {
 	stream       *portaudio.Stream
 	recordBuffer *[]int16
-	byteOrder    binary.ByteOrder
-	readerBuffer safe.Buffer
+	format       pcm.Format
+	readerBuffer safe.BlockingBuffer // closed with streamio.ErrClosed by Close
+	done         chan struct{}
+	wg           sync.WaitGroup
+	closeOnce    sync.Once
+	closeErr     error
+	stats        *stats
 }
 
 // NewRecorder initialize a Player object.
@@ -24,7 +29,14 @@ type Recorder struct {
 // This function invokes a goroutine
 // that sequentially reads data from the audio input device
 // and writes the data into the record buffer.
-func NewRecorder(inputDeviceID int, bufferSize int, channels int, bitDepth int, sampleRate int, byteOrder binary.ByteOrder) (r *Recorder, err error) {
+//
+// Use InputDeviceID to get the device ID from a device name (-1 means the default device).
+// Only signed 16-bit formats are supported.
+func NewRecorder(inputDeviceID int, bufferSize int, format pcm.Format) (r *Recorder, err error) {
+	err = validateFormat(format)
+	if err != nil {
+		return nil, err
+	}
 	recordBuffer := make([]int16, bufferSize)
 	// initialize Player
 	err = portaudio.Initialize()
@@ -32,7 +44,7 @@ func NewRecorder(inputDeviceID int, bufferSize int, channels int, bitDepth int,
 		return nil, errors.Wrap(err, "failed to initialize Player")
 	}
 	// open an output stream
-	stream, err := OpenStream(inputDeviceID, -1, channels, 0, float64(sampleRate), bufferSize, recordBuffer)
+	stream, err := OpenStream(inputDeviceID, -1, format.Channels, 0, float64(format.SampleRate), bufferSize, recordBuffer)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to open stream")
 	}
@@ -41,19 +53,28 @@ func NewRecorder(inputDeviceID int, bufferSize int, channels int, bitDepth int,
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to start stream")
 	}
-	r = &Recorder{stream: stream, recordBuffer: &recordBuffer, byteOrder: byteOrder}
+	r = &Recorder{stream: stream, recordBuffer: &recordBuffer, format: format, done: make(chan struct{}), stats: newStats()}
 	r.initialize()
 	return r, nil
 }
 
 func (r *Recorder) initialize() {
+	r.wg.Add(1)
 	go func() {
+		defer r.wg.Done()
 		for {
+			select {
+			case <-r.done:
+				return
+			default:
+			}
 			gErr := r.record()
+			if errors.Cause(gErr) == streamio.ErrClosed {
+				return
+			}
 			if gErr != nil {
-				// broken data detected
-				// NOTE: this is not a bug (in most cases), so puts a log instead of an error
-				fmt.Fprint(os.Stderr, "X")
+				// the buffer is discarded, but keeps recording as the device may recover
+				r.stats.fail(gErr, len(*r.recordBuffer)*r.format.SampleSize())
 			}
 		}
 	}()
@@ -61,10 +82,14 @@ func (r *Recorder) initialize() {
 
 func (r *Recorder) record() error {
 	err := r.stream.Read() // read pcm data from the record stream to the buffer
+	if err == portaudio.InputOverflowed {
+		r.stats.overrun(0, false) // the data are valid but some data before them are lost
+		err = nil
+	}
 	if err != nil {
 		return errors.Wrap(err, "failed to read PCM")
 	}
-	err = binary.Write(&r.readerBuffer, r.byteOrder, r.recordBuffer) // convert []int16 -> []byte
+	err = binary.Write(&r.readerBuffer, r.format.ByteOrder, r.recordBuffer) // convert []int16 -> []byte
 	if err != nil {
 		return errors.Wrap(err, "failed to write PCM")
 	}
@@ -74,29 +99,44 @@ func (r *Recorder) record() error {
 // Read reads len(b) bytes from the record buffer into b.
 //
 // The function blocks until it reads len(b) bytes or more.
-// The function does not support ioutil.ReadAll (blocks permanently).
+// The function never returns io.EOF as the device does not reach the end of the stream,
+// so ioutil.ReadAll blocks until Close.
+// The function returns streamio.ErrClosed after Close.
 func (r *Recorder) Read(b []byte) (n int, err error) {
-	readLen := len(b)
-	for r.readerBuffer.Len() < readLen {
-		time.Sleep(1 * time.Millisecond) // wait for record
-	}
 	return r.readerBuffer.Read(b)
 }
 
+// OutputFormat returns the format of the stream that Recorder produces.
+func (r *Recorder) OutputFormat() pcm.Format {
+	return r.format
+}
+
+// Stats returns a snapshot of the counters of glitches.
+//
+// Overruns are reported by the device when Read does not keep up with recording.
+// DroppedBytes does not include data lost in the device.
+func (r *Recorder) Stats() streamio.Stats {
+	return r.stats.get()
+}
+
+// SetStatsHook sets fn to be called with a snapshot after the counters change.
+//
+// fn is called from a goroutine of the stats (changes in quick succession are reported once).
+func (r *Recorder) SetStatsHook(fn func(streamio.Stats)) {
+	r.stats.setHook(fn)
+}
+
 // Close terminates Recorder.
-func (r *Recorder) Close() (err error) {
-	// TODO: terminate the goroutine
-	err = r.stream.Stop()
-	if err != nil {
-		return errors.Wrap(err, "failed to stop stream")
-	}
-	err = r.stream.Close()
-	if err != nil {
-		return errors.Wrap(err, "failed to close stream")
-	}
-	err = portaudio.Terminate()
-	if err != nil {
-		return errors.Wrap(err, "failed to terminate Player")
-	}
-	return nil
+//
+// The function blocks until the goroutine exits, and then closes the stream.
+// Read waiting for data is unblocked.
+func (r *Recorder) Close() error {
+	r.closeOnce.Do(func() {
+		r.readerBuffer.CloseWithError(streamio.ErrClosed)
+		close(r.done)
+		r.wg.Wait()
+		r.closeErr = terminate(r.stream)
+		r.stats.close()
+	})
+	return r.closeErr
 }
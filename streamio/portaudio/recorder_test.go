@@ -1,9 +1,10 @@
 package portaudio_test
 
 import (
-	"encoding/binary"
 	"testing"
 
+	"github.com/ebiiim/eq/pcm"
+	"github.com/ebiiim/eq/streamio"
 	"github.com/ebiiim/eq/streamio/portaudio"
 )
 
@@ -15,17 +16,17 @@ func initRecorders(t *testing.T) []*portaudio.Recorder {
 	t.Helper()
 	var ret []*portaudio.Recorder
 	rs := []struct {
-		bs, ch, b, r int
-		bo           binary.ByteOrder
+		bs int
+		f  pcm.Format
 	}{
-		{8192, 2, 16, 48000, binary.LittleEndian},
-		{8192, 2, 16, 48000, binary.LittleEndian},
-		{8192, 2, 16, 48000, binary.LittleEndian},
-		{8192, 2, 16, 48000, binary.LittleEndian},
-		{8192, 2, 16, 48000, binary.LittleEndian},
+		{8192, pcm.Default},
+		{8192, pcm.Default},
+		{8192, pcm.Default},
+		{8192, pcm.Default},
+		{8192, pcm.Default},
 	}
 	for i, v := range rs {
-		r, err := portaudio.NewRecorder(-1, v.bs, v.ch, v.b, v.r, v.bo)
+		r, err := portaudio.NewRecorder(-1, v.bs, v.f)
 		if err != nil {
 			t.Fatalf("could not init recorder #%d", i)
 		}
@@ -36,6 +37,7 @@ func initRecorders(t *testing.T) []*portaudio.Recorder {
 
 func TestRecorder_Read(t *testing.T) {
 	rs := initRecorders(t)
+	defer rs[4].Close() // not used
 	cases := []struct {
 		name   string
 		r      *portaudio.Recorder
@@ -60,12 +62,18 @@ func TestRecorder_Read(t *testing.T) {
 					t.Errorf("invalid read length idx %d got %d want %d data %v", i, n, c.bufLen, got)
 				}
 			}
+			c.r.Close()
 		})
 	}
 }
 
 func TestRecorder_Close(t *testing.T) {
 	rs := initRecorders(t)
+	defer func() {
+		for _, r := range rs[2:] { // not used
+			r.Close()
+		}
+	}()
 	cases := []struct {
 		name  string
 		r     *portaudio.Recorder
@@ -84,6 +92,10 @@ func TestRecorder_Close(t *testing.T) {
 			if !((err != nil) == c.isErr) {
 				t.Errorf("got %v, want %v(isErr) ", err, c.isErr)
 			}
+			_, err = c.r.Read(make([]byte, 8192))
+			if err != streamio.ErrClosed {
+				t.Errorf("got %v want %v", err, streamio.ErrClosed)
+			}
 		})
 	}
 }
@@ -0,0 +1,115 @@
+package portaudio
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ebiiim/eq/streamio"
+)
+
+// stats keeps streamio.Stats of a stream and calls the hook after changes.
+//
+// The counters are updated without locks so that the PortAudio callback never blocks,
+// and the hook is called from another goroutine (see deliver).
+type stats struct {
+	// accessed atomically (must be 64-bit aligned, so stats is allocated by newStats)
+	underruns, overruns, dropped, partial uint64
+
+	changed   chan struct{} // notifies deliver without blocking
+	done      chan struct{}
+	startOnce sync.Once
+	closeOnce sync.Once
+
+	mu          sync.Mutex // guards the fields below
+	lastErr     error
+	lastErrTime time.Time
+	hook        func(streamio.Stats)
+}
+
+func newStats() *stats {
+	return &stats{changed: make(chan struct{}, 1), done: make(chan struct{})}
+}
+
+// notify wakes up deliver (changes in quick succession are reported once).
+func (s *stats) notify() {
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// deliver calls the hook with the latest snapshot after changes until close.
+func (s *stats) deliver() {
+	for {
+		select {
+		case <-s.changed:
+			s.mu.Lock()
+			hook := s.hook
+			s.mu.Unlock()
+			if hook != nil {
+				hook(s.get())
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// underrun counts an underrun (partial means that the buffer was partly filled with data).
+func (s *stats) underrun(partial bool) {
+	atomic.AddUint64(&s.underruns, 1)
+	if partial {
+		atomic.AddUint64(&s.partial, 1)
+	}
+	s.notify()
+}
+
+// overrun counts an overrun that discarded dropped bytes
+// (partial means that the buffer was partly stored).
+func (s *stats) overrun(dropped int, partial bool) {
+	atomic.AddUint64(&s.overruns, 1)
+	atomic.AddUint64(&s.dropped, uint64(dropped))
+	if partial {
+		atomic.AddUint64(&s.partial, 1)
+	}
+	s.notify()
+}
+
+// fail records err that discarded dropped bytes.
+//
+// Unlike underrun and overrun, it takes a lock, so it must not be called from the PortAudio callback.
+func (s *stats) fail(err error, dropped int) {
+	atomic.AddUint64(&s.dropped, uint64(dropped))
+	s.mu.Lock()
+	s.lastErr, s.lastErrTime = err, time.Now()
+	s.mu.Unlock()
+	s.notify()
+}
+
+func (s *stats) get() streamio.Stats {
+	st := streamio.Stats{
+		Underruns:     atomic.LoadUint64(&s.underruns),
+		Overruns:      atomic.LoadUint64(&s.overruns),
+		DroppedBytes:  atomic.LoadUint64(&s.dropped),
+		PartialFrames: atomic.LoadUint64(&s.partial),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st.LastError, st.LastErrorTime = s.lastErr, s.lastErrTime
+	return st
+}
+
+func (s *stats) setHook(fn func(streamio.Stats)) {
+	s.mu.Lock()
+	s.hook = fn
+	s.mu.Unlock()
+	if fn != nil {
+		s.startOnce.Do(func() { go s.deliver() })
+	}
+}
+
+// close stops deliver.
+func (s *stats) close() {
+	s.closeOnce.Do(func() { close(s.done) })
+}
@@ -0,0 +1,62 @@
+package portaudio_test
+
+import (
+	"testing"
+
+	"github.com/ebiiim/eq/pcm"
+	"github.com/ebiiim/eq/streamio"
+	"github.com/ebiiim/eq/streamio/portaudio"
+)
+
+func TestStats(t *testing.T) {
+	cases := []struct {
+		name string
+		open func() (streamio.StatsReporter, func() error, error)
+	}{
+		{"player", func() (streamio.StatsReporter, func() error, error) {
+			s, err := portaudio.NewPlayer(-1, 1024, pcm.Default)
+			if err != nil {
+				return nil, nil, err
+			}
+			return s, s.Close, nil
+		}},
+		{"recorder", func() (streamio.StatsReporter, func() error, error) {
+			s, err := portaudio.NewRecorder(-1, 1024, pcm.Default)
+			if err != nil {
+				return nil, nil, err
+			}
+			return s, s.Close, nil
+		}},
+		{"callback_player", func() (streamio.StatsReporter, func() error, error) {
+			s, err := portaudio.NewCallbackPlayer(-1, 1024, pcm.Default)
+			if err != nil {
+				return nil, nil, err
+			}
+			return s, s.Close, nil
+		}},
+		{"callback_recorder", func() (streamio.StatsReporter, func() error, error) {
+			s, err := portaudio.NewCallbackRecorder(-1, 1024, pcm.Default)
+			if err != nil {
+				return nil, nil, err
+			}
+			return s, s.Close, nil
+		}},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			s, closeFn, err := c.open()
+			if err != nil {
+				t.Fatalf("could not open stream: %v", err)
+			}
+			defer closeFn()
+			s.SetStatsHook(func(streamio.Stats) {})
+			s.SetStatsHook(nil)
+			got := s.Stats()
+			// NOTE: counters depend on sound devices, so only checks that no error has occurred
+			if got.LastError != nil || !got.LastErrorTime.IsZero() {
+				t.Errorf("unexpected error %v at %v", got.LastError, got.LastErrorTime)
+			}
+		})
+	}
+}
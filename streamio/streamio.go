@@ -4,12 +4,47 @@ package streamio
 
 import (
 	"io"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
+// ErrClosed is returned by Read and Write of Recorder and Player after Close.
+var ErrClosed = errors.New("use of closed stream")
+
+// Recorder is a readable audio input.
+//
+// Implementations may also implement pcm.OutputFormatter to report the format of the stream.
 type Recorder interface {
 	io.ReadCloser
 }
 
+// Player is a writable audio output.
+//
+// Implementations may also implement pcm.InputFormatter to report the format of the stream.
 type Player interface {
 	io.WriteCloser
 }
+
+// Stats holds counters of glitches that occurred in a stream.
+//
+// Counters only increase, so a growing Underruns or Overruns
+// indicates a glitchy (e.g. overloaded) device,
+// while a recent LastError indicates a broken one.
+type Stats struct {
+	Underruns     uint64 // the number of times the device ran out of data to play
+	Overruns      uint64 // the number of times the device produced data faster than they were consumed
+	DroppedBytes  uint64 // the number of bytes discarded due to overruns or errors
+	PartialFrames uint64 // the number of device buffers that were only partly filled with data
+	LastError     error  // the last error that occurred in the device (nil if none)
+	LastErrorTime time.Time
+}
+
+// StatsReporter is implemented by streams that keep Stats.
+type StatsReporter interface {
+	// Stats returns a snapshot of the counters.
+	Stats() Stats
+	// SetStatsHook sets fn to be called with a snapshot after the counters change
+	// (nil removes the hook).
+	SetStatsHook(fn func(Stats))
+}
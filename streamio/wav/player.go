@@ -0,0 +1,126 @@
+package wav
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/ebiiim/eq/pcm"
+	"github.com/ebiiim/eq/streamio"
+	"github.com/pkg/errors"
+)
+
+// Player is a writable WAVE file.
+//
+// Write appends data to the data chunk,
+// and Close fixes up the RIFF and data chunk sizes.
+type Player struct {
+	mu       sync.Mutex
+	writer   io.WriteSeeker
+	closer   io.Closer
+	format   pcm.Format
+	start    int64 // the offset of the header in writer
+	dataSize int64
+	maxData  int64 // see maxDataSize
+	closed   bool
+}
+
+// NewPlayer writes a WAVE header to writer at the current offset and initializes a Player object.
+//
+// Supported formats are signed 16/24/32-bit integer and 32-bit float little-endian PCM.
+func NewPlayer(writer io.WriteSeeker, format pcm.Format) (p *Player, err error) {
+	err = validateFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	start, err := writer.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get the offset")
+	}
+	err = writeHeader(writer, format, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not write header")
+	}
+	return &Player{writer: writer, format: format, start: start, maxData: maxDataSize(format)}, nil
+}
+
+// CreatePlayer creates the named file and initializes a Player object.
+//
+// Close closes the file.
+func CreatePlayer(name string, format pcm.Format) (p *Player, err error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create file")
+	}
+	p, err = NewPlayer(f, format)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	p.closer = f
+	return p, nil
+}
+
+// Write writes len(b) bytes from b to the data chunk.
+//
+// The function returns an error without writing b
+// if the data chunk would exceed the size limit of WAVE (about 4GB).
+//
+// The function returns streamio.ErrClosed after Close.
+func (p *Player) Write(b []byte) (n int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return 0, streamio.ErrClosed
+	}
+	if p.dataSize+int64(len(b)) > p.maxData {
+		return 0, errors.Errorf("data chunk exceeds %d bytes", p.maxData)
+	}
+	n, err = p.writer.Write(b)
+	p.dataSize += int64(n)
+	return n, err
+}
+
+// InputFormat returns the format of the file.
+func (p *Player) InputFormat() pcm.Format {
+	return p.format
+}
+
+// Close writes the chunk sizes into the header and terminates Player.
+func (p *Player) Close() (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	defer func() {
+		if p.closer == nil {
+			return
+		}
+		cErr := p.closer.Close()
+		if cErr != nil && err == nil {
+			err = errors.Wrap(cErr, "could not close file")
+		}
+	}()
+
+	if p.dataSize%2 == 1 {
+		if _, err = p.writer.Write([]byte{0}); err != nil {
+			return errors.Wrap(err, "could not write pad byte")
+		}
+	}
+	end, err := p.writer.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return errors.Wrap(err, "could not get the offset")
+	}
+	if _, err = p.writer.Seek(p.start, io.SeekStart); err != nil {
+		return errors.Wrap(err, "could not seek to header")
+	}
+	if err = writeHeader(p.writer, p.format, uint32(p.dataSize)); err != nil {
+		return errors.Wrap(err, "could not write header")
+	}
+	if _, err = p.writer.Seek(end, io.SeekStart); err != nil {
+		return errors.Wrap(err, "could not seek to end")
+	}
+	return nil
+}
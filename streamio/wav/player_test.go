@@ -0,0 +1,214 @@
+package wav_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ebiiim/eq/pcm"
+	"github.com/ebiiim/eq/streamio"
+	"github.com/ebiiim/eq/streamio/wav"
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+func TestPlayer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		name   string
+		format pcm.Format
+		data   []byte
+		size   int // file size
+		isErr  bool
+	}{
+		{"s16", format(2, 16, pcm.Signed), make([]byte, 400), 44 + 400, false},
+		{"s24", format(2, 24, pcm.Signed), make([]byte, 600), 44 + 600, false},
+		{"s32", format(1, 32, pcm.Signed), make([]byte, 400), 44 + 400, false},
+		{"f32", format(2, 32, pcm.Float), make([]byte, 800), 58 + 800, false},
+		{"odd", format(1, 16, pcm.Signed), make([]byte, 3), 44 + 4, false},
+		{"empty", format(2, 16, pcm.Signed), nil, 44, false},
+		{"F_u8", format(2, 8, pcm.Unsigned), nil, 0, true},
+		{"F_big_endian", pcm.Format{Channels: 2, SampleRate: 48000, BitDepth: 16, Encoding: pcm.Signed, ByteOrder: binary.BigEndian}, nil, 0, true},
+	}
+	t.Run("group", func(t *testing.T) { // wait for parallel subtests before removing dir
+		for i, c := range cases {
+			c := c
+			for j := range c.data {
+				c.data[j] = byte(i + j)
+			}
+			name := filepath.Join(dir, c.name+".wav")
+			t.Run(c.name, func(t *testing.T) {
+				t.Parallel()
+				p, err := wav.CreatePlayer(name, c.format)
+				if !((err != nil) == c.isErr) {
+					t.Fatalf("got %v, want %v(isErr) ", err, c.isErr)
+				}
+				if c.isErr {
+					return
+				}
+				for k := 0; k < len(c.data); k += 100 { // write in chunks
+					end := k + 100
+					if end > len(c.data) {
+						end = len(c.data)
+					}
+					if _, err := p.Write(c.data[k:end]); err != nil {
+						t.Errorf("unexpected error %v", err)
+					}
+				}
+				if err := p.Close(); err != nil {
+					t.Errorf("could not close: %v", err)
+				}
+				if _, err := p.Write(c.data); err != streamio.ErrClosed {
+					t.Errorf("got %v want %v", err, streamio.ErrClosed)
+				}
+
+				file, err := ioutil.ReadFile(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(file) != c.size {
+					t.Errorf("got file size %d want %d", len(file), c.size)
+				}
+				r, err := wav.NewRecorder(bytes.NewReader(file))
+				if err != nil {
+					t.Fatalf("could not read written file: %v", err)
+				}
+				if !r.OutputFormat().Equal(c.format) {
+					t.Errorf("got %v want %v", r.OutputFormat(), c.format)
+				}
+				got, _ := ioutil.ReadAll(r)
+				if !cmp.Equal(got, c.data, cmp.Comparer(bytes.Equal)) {
+					t.Errorf("got %v want %v", got, c.data)
+				}
+			})
+		}
+	})
+}
+
+func TestPlayer_Offset(t *testing.T) {
+	f, err := ioutil.TempFile("", "wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	prefix := []byte("prefix")
+	if _, err := f.Write(prefix); err != nil {
+		t.Fatal(err)
+	}
+	p, err := wav.NewPlayer(f, format(2, 16, pcm.Signed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte{1, 2, 3, 4}
+	if _, err := p.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("could not close: %v", err)
+	}
+
+	file, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(file, prefix) {
+		t.Fatalf("the prefix is overwritten: %q", file[:len(prefix)])
+	}
+	r, err := wav.NewRecorder(bytes.NewReader(file[len(prefix):]))
+	if err != nil {
+		t.Fatalf("could not read the header: %v", err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil || !cmp.Equal(got, data) {
+		t.Errorf("got (%v, %v) want (%v, nil)", got, err, data)
+	}
+}
+
+// sparseFile is an io.WriteSeeker that keeps only the first 64 bytes (the header).
+type sparseFile struct {
+	head [64]byte
+	pos  int64
+}
+
+func (f *sparseFile) Write(b []byte) (int, error) {
+	if f.pos < int64(len(f.head)) {
+		copy(f.head[f.pos:], b)
+	}
+	f.pos += int64(len(b))
+	return len(b), nil
+}
+
+func (f *sparseFile) Seek(offset int64, whence int) (int64, error) {
+	if whence != io.SeekStart && whence != io.SeekCurrent {
+		return 0, errors.New("unsupported whence")
+	}
+	if whence == io.SeekCurrent {
+		offset += f.pos
+	}
+	f.pos = offset
+	return offset, nil
+}
+
+func TestPlayer_MaxSize(t *testing.T) {
+	cases := []struct {
+		name      string
+		format    pcm.Format
+		headerLen int64
+	}{
+		{"s16_stereo", format(2, 16, pcm.Signed), 44},
+		{"s24_mono", format(1, 24, pcm.Signed), 44}, // odd frame size (with a pad byte)
+		{"f32_stereo", format(2, 32, pcm.Float), 58},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			fs := int64(c.format.FrameSize())
+			max := int64(0xFFFFFFFF) - (c.headerLen - 8) - 1 // room for a pad byte
+			max -= max % fs
+
+			f := &sparseFile{}
+			p, err := wav.NewPlayer(f, c.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, fs<<18)
+			for n := int64(0); n < max; {
+				b := buf
+				if rest := max - n; rest < int64(len(b)) {
+					b = b[:rest]
+				}
+				if _, err := p.Write(b); err != nil {
+					t.Fatalf("could not write at %d: %v", n, err)
+				}
+				n += int64(len(b))
+			}
+			if _, err := p.Write(buf[:fs]); err == nil {
+				t.Error("got nil want error (exceeds the limit)")
+			}
+			if err := p.Close(); err != nil {
+				t.Fatalf("could not close: %v", err)
+			}
+
+			riffSize := int64(binary.LittleEndian.Uint32(f.head[4:]))
+			dataSize := int64(binary.LittleEndian.Uint32(f.head[c.headerLen-4:]))
+			if dataSize != max {
+				t.Errorf("got data size %d want %d", dataSize, max)
+			}
+			if want := c.headerLen - 8 + max + max%2; riffSize != want {
+				t.Errorf("got RIFF size %d want %d", riffSize, want)
+			}
+		})
+	}
+}
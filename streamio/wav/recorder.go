@@ -0,0 +1,97 @@
+package wav
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/ebiiim/eq/pcm"
+	"github.com/ebiiim/eq/streamio"
+	"github.com/pkg/errors"
+)
+
+// Recorder is a readable WAVE file.
+//
+// Read returns the data chunk as it is (i.e. interleaved little-endian samples),
+// and OutputFormat reports its format.
+type Recorder struct {
+	reader io.Reader
+	closer io.Closer
+	format pcm.Format
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewRecorder reads a WAVE header from reader and initializes a Recorder object.
+//
+// Supported formats are signed 16/24/32-bit integer and 32-bit float PCM.
+func NewRecorder(reader io.Reader) (r *Recorder, err error) {
+	h, err := readHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+	r = &Recorder{reader: reader, format: h.format}
+	if h.dataSize >= 0 {
+		r.reader = io.LimitReader(reader, h.dataSize)
+	}
+	return r, nil
+}
+
+// OpenRecorder opens the named file and initializes a Recorder object.
+//
+// Close closes the file.
+func OpenRecorder(name string) (r *Recorder, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open file")
+	}
+	r, err = NewRecorder(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.closer = f
+	return r, nil
+}
+
+// Read reads len(b) bytes from the data chunk into b.
+//
+// The function blocks until it reads len(b) bytes or reaches the end of the data chunk,
+// and returns io.EOF once all data have been read.
+// The function returns streamio.ErrClosed after Close.
+func (r *Recorder) Read(b []byte) (n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return 0, streamio.ErrClosed
+	}
+	n, err = io.ReadFull(r.reader, b)
+	if err == io.ErrUnexpectedEOF {
+		err = nil // io.EOF on the next call
+	}
+	return n, err
+}
+
+// OutputFormat returns the format of the file.
+func (r *Recorder) OutputFormat() pcm.Format {
+	return r.format
+}
+
+// Close terminates Recorder.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	if r.closer == nil {
+		return nil
+	}
+	err := r.closer.Close()
+	if err != nil {
+		return errors.Wrap(err, "could not close file")
+	}
+	return nil
+}
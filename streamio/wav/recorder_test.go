@@ -0,0 +1,143 @@
+package wav_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+
+	"github.com/ebiiim/eq/pcm"
+	"github.com/ebiiim/eq/streamio"
+	"github.com/ebiiim/eq/streamio/wav"
+	"github.com/google/go-cmp/cmp"
+)
+
+// chunk returns a RIFF chunk.
+func chunk(id string, data []byte) []byte {
+	b := append([]byte(id), 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(data)))
+	b = append(b, data...)
+	if len(data)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// fmtChunk returns the content of a fmt chunk.
+func fmtChunk(tag uint16, ch, rate, bits int) []byte {
+	b := make([]byte, 16)
+	binary.LittleEndian.PutUint16(b[0:], tag)
+	binary.LittleEndian.PutUint16(b[2:], uint16(ch))
+	binary.LittleEndian.PutUint32(b[4:], uint32(rate))
+	binary.LittleEndian.PutUint32(b[8:], uint32(rate*ch*bits/8))
+	binary.LittleEndian.PutUint16(b[12:], uint16(ch*bits/8))
+	binary.LittleEndian.PutUint16(b[14:], uint16(bits))
+	return b
+}
+
+// extensible returns the content of a WAVE_FORMAT_EXTENSIBLE fmt chunk.
+func extensible(tag uint16, ch, rate, bits int) []byte {
+	b := fmtChunk(0xFFFE, ch, rate, bits)
+	ext := make([]byte, 24)
+	binary.LittleEndian.PutUint16(ext[0:], 22)
+	binary.LittleEndian.PutUint16(ext[2:], uint16(bits))
+	binary.LittleEndian.PutUint16(ext[8:], tag)
+	return append(b, ext...)
+}
+
+func riff(chunks ...[]byte) []byte {
+	b := []byte("WAVE")
+	for _, c := range chunks {
+		b = append(b, c...)
+	}
+	return chunk("RIFF", b)
+}
+
+// streaming returns a file written by a streaming writer
+// (with riffSize and dataSize that do not match the data).
+func streaming(riffSize, dataSize uint32, data []byte) []byte {
+	b := riff(chunk("fmt ", fmtChunk(1, 2, 44100, 16)), chunk("data", nil))
+	binary.LittleEndian.PutUint32(b[4:], riffSize)
+	binary.LittleEndian.PutUint32(b[len(b)-4:], dataSize)
+	return append(b, data...)
+}
+
+func format(ch, bits int, enc pcm.Encoding) pcm.Format {
+	return pcm.Format{Channels: ch, SampleRate: 44100, BitDepth: bits, Encoding: enc, ByteOrder: binary.LittleEndian}
+}
+
+func TestRecorder_Read(t *testing.T) {
+	data := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	cases := []struct {
+		name   string
+		file   []byte
+		format pcm.Format
+		want   []byte
+		isErr  bool
+	}{
+		{"s16", riff(chunk("fmt ", fmtChunk(1, 2, 44100, 16)), chunk("data", data)), format(2, 16, pcm.Signed), data, false},
+		{"s24", riff(chunk("fmt ", fmtChunk(1, 2, 44100, 24)), chunk("data", data)), format(2, 24, pcm.Signed), data, false},
+		{"s32", riff(chunk("fmt ", fmtChunk(1, 1, 44100, 32)), chunk("data", data)), format(1, 32, pcm.Signed), data, false},
+		{"f32", riff(chunk("fmt ", append(fmtChunk(3, 1, 44100, 32), 0, 0)), chunk("fact", []byte{3, 0, 0, 0}), chunk("data", data)), format(1, 32, pcm.Float), data, false},
+		{"extensible_s24", riff(chunk("fmt ", extensible(1, 2, 44100, 24)), chunk("data", data)), format(2, 24, pcm.Signed), data, false},
+		{"skip_chunks", riff(chunk("LIST", []byte("odd")), chunk("fmt ", fmtChunk(1, 2, 44100, 16)), chunk("data", data[:8])), format(2, 16, pcm.Signed), data[:8], false},
+		{"trailing_chunk", riff(chunk("fmt ", fmtChunk(1, 2, 44100, 16)), chunk("data", data[:4]), chunk("LIST", []byte("info"))), format(2, 16, pcm.Signed), data[:4], false},
+		{"empty_trailing_chunk", riff(chunk("fmt ", fmtChunk(1, 2, 44100, 16)), chunk("data", nil), chunk("LIST", []byte("info"))), format(2, 16, pcm.Signed), []byte{}, false},
+		{"streaming", streaming(0xFFFFFFFF, 0, data), format(2, 16, pcm.Signed), data, false},
+		{"streaming_data_last", streaming(36, 0, data), format(2, 16, pcm.Signed), data, false},
+		{"streaming_data_size", streaming(0, 0xFFFFFFFF, data), format(2, 16, pcm.Signed), data, false},
+		{"F_not_wave", chunk("RIFX", []byte("WAVE")), pcm.Format{}, nil, true},
+		{"F_u8", riff(chunk("fmt ", fmtChunk(1, 2, 44100, 8)), chunk("data", data)), pcm.Format{}, nil, true},
+		{"F_f64", riff(chunk("fmt ", fmtChunk(3, 2, 44100, 64)), chunk("data", data)), pcm.Format{}, nil, true},
+		{"F_alaw", riff(chunk("fmt ", fmtChunk(6, 2, 44100, 8)), chunk("data", data)), pcm.Format{}, nil, true},
+		{"F_no_fmt", riff(chunk("data", data)), pcm.Format{}, nil, true},
+		{"F_truncated", riff(chunk("fmt ", fmtChunk(1, 2, 44100, 16)))[:20], pcm.Format{}, nil, true},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			r, err := wav.NewRecorder(bytes.NewReader(c.file))
+			if !((err != nil) == c.isErr) {
+				t.Errorf("got %v, want %v(isErr) ", err, c.isErr)
+			}
+			if c.isErr {
+				return
+			}
+			if !r.OutputFormat().Equal(c.format) {
+				t.Errorf("got %v want %v", r.OutputFormat(), c.format)
+			}
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+			if !cmp.Equal(got, c.want) {
+				t.Errorf("got %v want %v", got, c.want)
+			}
+			if err := r.Close(); err != nil {
+				t.Errorf("could not close: %v", err)
+			}
+			if _, err := r.Read(make([]byte, 4)); err != streamio.ErrClosed {
+				t.Errorf("got %v want %v", err, streamio.ErrClosed)
+			}
+		})
+	}
+}
+
+func TestRecorder_ReadPartial(t *testing.T) {
+	data := []byte{1, 2, 3, 4, 5, 6}
+	r, err := wav.NewRecorder(bytes.NewReader(riff(chunk("fmt ", fmtChunk(1, 1, 44100, 16)), chunk("data", data))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 4)
+	for i, want := range []struct {
+		n     int
+		isErr bool
+	}{{4, false}, {2, false}, {0, true}} {
+		n, err := r.Read(b)
+		if n != want.n || (err != nil) != want.isErr {
+			t.Errorf("idx %d got (%d, %v) want (%d, %v(isErr))", i, n, err, want.n, want.isErr)
+		}
+	}
+}
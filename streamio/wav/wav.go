@@ -0,0 +1,184 @@
+// Package wav provides an implementation of streamio.Player and streamio.Recorder
+// that reads and writes RIFF/WAVE PCM files.
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+
+	"github.com/ebiiim/eq/pcm"
+	"github.com/pkg/errors"
+)
+
+const (
+	formatPCM        = 0x0001
+	formatFloat      = 0x0003
+	formatExtensible = 0xFFFE
+)
+
+// header holds information of a WAVE file needed to read its data chunk.
+type header struct {
+	format   pcm.Format
+	dataSize int64 // -1 if unknown (streaming)
+}
+
+// readHeader reads chunks from r until the beginning of the data chunk.
+func readHeader(r io.Reader) (h header, err error) {
+	var riff struct {
+		ID   [4]byte
+		Size uint32
+		Type [4]byte
+	}
+	if err = binary.Read(r, binary.LittleEndian, &riff); err != nil {
+		return h, errors.Wrap(err, "could not read RIFF header")
+	}
+	if string(riff.ID[:]) != "RIFF" || string(riff.Type[:]) != "WAVE" {
+		return h, errors.New("not a RIFF/WAVE file")
+	}
+
+	var hasFmt bool
+	pos := int64(12) // the offset of the next chunk
+	for {
+		var chunk struct {
+			ID   [4]byte
+			Size uint32
+		}
+		if err = binary.Read(r, binary.LittleEndian, &chunk); err != nil {
+			return h, errors.Wrap(err, "could not read chunk header")
+		}
+		pos += 8
+		switch string(chunk.ID[:]) {
+		case "fmt ":
+			h.format, err = readFmt(r, chunk.Size)
+			if err != nil {
+				return h, err
+			}
+			hasFmt = true
+			pos += int64(chunk.Size + chunk.Size%2)
+		case "data":
+			if !hasFmt {
+				return h, errors.New("data chunk before fmt chunk")
+			}
+			h.dataSize = int64(chunk.Size)
+			// streaming writers set 0xFFFFFFFF or 0 (without anything after the data chunk)
+			riffUnknown := riff.Size == 0 || riff.Size == 0xFFFFFFFF
+			if chunk.Size == 0xFFFFFFFF || (chunk.Size == 0 && (riffUnknown || int64(riff.Size)+8 <= pos)) {
+				h.dataSize = -1
+			}
+			return h, nil
+		default:
+			if _, err = io.CopyN(ioutil.Discard, r, int64(chunk.Size+chunk.Size%2)); err != nil {
+				return h, errors.Wrapf(err, "could not skip %q chunk", chunk.ID)
+			}
+			pos += int64(chunk.Size + chunk.Size%2)
+		}
+	}
+}
+
+func readFmt(r io.Reader, size uint32) (f pcm.Format, err error) {
+	if size < 16 {
+		return f, errors.Errorf("invalid fmt chunk size %d", size)
+	}
+	b := make([]byte, size+size%2)
+	if _, err = io.ReadFull(r, b); err != nil {
+		return f, errors.Wrap(err, "could not read fmt chunk")
+	}
+	tag := binary.LittleEndian.Uint16(b[0:2])
+	if tag == formatExtensible {
+		if size < 40 {
+			return f, errors.Errorf("invalid extensible fmt chunk size %d", size)
+		}
+		tag = binary.LittleEndian.Uint16(b[24:26]) // the first 2 bytes of SubFormat GUID
+	}
+	f.Channels = int(binary.LittleEndian.Uint16(b[2:4]))
+	f.SampleRate = int(binary.LittleEndian.Uint32(b[4:8]))
+	f.BitDepth = int(binary.LittleEndian.Uint16(b[14:16]))
+	f.ByteOrder = binary.LittleEndian
+	switch tag {
+	case formatPCM:
+		f.Encoding = pcm.Signed
+	case formatFloat:
+		f.Encoding = pcm.Float
+	default:
+		return f, errors.Errorf("unsupported format tag 0x%04x", tag)
+	}
+	if err = validateFormat(f); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+// writeHeader writes a WAVE header for a data chunk of dataSize bytes.
+//
+// The length of the header depends only on f,
+// so the header can be rewritten in place once dataSize is known.
+func writeHeader(w io.Writer, f pcm.Format, dataSize uint32) error {
+	tag, fmtSize := uint16(formatPCM), uint32(16)
+	if f.Encoding == pcm.Float {
+		tag, fmtSize = formatFloat, 18 // with cbSize
+	}
+	riffSize := 4 + (8 + fmtSize) + (8 + dataSize + dataSize%2)
+	if f.Encoding == pcm.Float {
+		riffSize += 8 + 4 // fact chunk
+	}
+
+	var b []byte
+	b = append(b, "RIFF"...)
+	b = appendUint32(b, riffSize)
+	b = append(b, "WAVE"...)
+	b = append(b, "fmt "...)
+	b = appendUint32(b, fmtSize)
+	b = appendUint16(b, tag)
+	b = appendUint16(b, uint16(f.Channels))
+	b = appendUint32(b, uint32(f.SampleRate))
+	b = appendUint32(b, uint32(f.SampleRate*f.FrameSize()))
+	b = appendUint16(b, uint16(f.FrameSize()))
+	b = appendUint16(b, uint16(f.BitDepth))
+	if f.Encoding == pcm.Float {
+		b = appendUint16(b, 0) // cbSize
+		b = append(b, "fact"...)
+		b = appendUint32(b, 4)
+		b = appendUint32(b, dataSize/uint32(f.FrameSize()))
+	}
+	b = append(b, "data"...)
+	b = appendUint32(b, dataSize)
+	_, err := w.Write(b)
+	return err
+}
+
+// maxDataSize returns the maximum size of the data chunk in format f
+// so that the RIFF size (the data size plus the header size except "RIFF" and itself,
+// and a pad byte) fits in uint32. It is a multiple of the frame size.
+func maxDataSize(f pcm.Format) int64 {
+	var header bytes.Buffer
+	writeHeader(&header, f, 0)
+	max := int64(0xFFFFFFFF) - int64(header.Len()-8) - 1
+	return max - max%int64(f.FrameSize())
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v), byte(v>>8))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+// validateFormat returns an error if f can not be stored in a WAVE file by this package.
+func validateFormat(f pcm.Format) error {
+	if err := f.Validate(); err != nil {
+		return errors.Wrap(err, "invalid format")
+	}
+	switch {
+	case f.Encoding == pcm.Signed && (f.BitDepth == 16 || f.BitDepth == 24 || f.BitDepth == 32):
+	case f.Encoding == pcm.Float && f.BitDepth == 32:
+	default:
+		return errors.Errorf("unsupported format %v", f)
+	}
+	if f.ByteOrder.String() != binary.LittleEndian.String() {
+		return errors.Errorf("unsupported format %v (little-endian only)", f)
+	}
+	return nil
+}